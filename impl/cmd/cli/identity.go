@@ -16,6 +16,7 @@ import (
 	"github.com/TBD54566975/did-dht/internal/cli"
 	"github.com/TBD54566975/did-dht/internal/util"
 	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 func init() {
@@ -103,7 +104,7 @@ var identityAddCmd = &cobra.Command{
 			Answer: rrds,
 		}
 		// generate put request
-		putReq, err := dht.CreateDNSPublishRequest(privKey, msg)
+		putReq, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(privKey), msg)
 		if err != nil {
 			logrus.WithError(err).Error("failed to create put request")
 			return err
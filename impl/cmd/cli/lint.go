@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+)
+
+var lintFailOn string
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringVar(&lintFailOn, "fail-on", string(did.SeverityError), "lowest severity of finding that fails the command: error, warning, or info")
+}
+
+// severities are the severities of lint findings, from the most to the least serious
+var severities = []did.Severity{did.SeverityError, did.SeverityWarning, did.SeverityInfo}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Lint a DID DHT Document before it is published",
+	Long: `Lint a DID DHT Document before it is published, printing advisory findings with their severities.
+Accepts a path to a json file of the document, along with its types and gateways, such as
+{"did": {"id": "did:dht:..."}, "types": [1]}, or - to read it from stdin. Exits with an error if any
+finding is at least as severe as --fail-on.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failOn := slices.Index(severities, did.Severity(lintFailOn))
+		if failOn < 0 {
+			return errors.Errorf("invalid --fail-on severity: %s", lintFailOn)
+		}
+
+		var in io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				logrus.WithError(err).Error("failed to open document")
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		var doc did.DIDDHTDocument
+		if err := json.NewDecoder(in).Decode(&doc); err != nil {
+			logrus.WithError(err).Error("failed to unmarshal document")
+			return err
+		}
+
+		findings, err := did.LintDocument(doc)
+		if err != nil {
+			logrus.WithError(err).Error("failed to lint document")
+			return err
+		}
+		if len(findings) == 0 {
+			fmt.Printf("No findings for %s\n", doc.Doc.ID)
+			return nil
+		}
+
+		failed := 0
+		for _, finding := range findings {
+			fmt.Println(finding.String())
+			if slices.Index(severities, finding.Severity) <= failOn {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errors.Errorf("%d of %d findings for %s are %s or more severe", failed, len(findings), doc.Doc.ID, lintFailOn)
+		}
+		return nil
+	},
+}
@@ -84,6 +84,11 @@ func run() error {
 	serverErrors := make(chan error, 1)
 	go func() {
 		logrus.WithContext(ctx).WithField("listen_address", s.Addr).Info("starting listener")
+		if s.TLSConfig != nil {
+			// the certificate is already loaded into the tls config
+			serverErrors <- s.ListenAndServeTLS("", "")
+			return
+		}
 		serverErrors <- s.ListenAndServe()
 	}()
 
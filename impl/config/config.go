@@ -28,6 +28,7 @@ const (
 	// BootstrapPeers A comma-separated list of bootstrap peers to connect to on startup.
 	BootstrapPeers EnvironmentVariable = "BOOTSTRAP_PEERS"
 	StorageURI     EnvironmentVariable = "STORAGE_URI"
+	AdminToken     EnvironmentVariable = "ADMIN_TOKEN"
 	LogLevel       EnvironmentVariable = "LOG_LEVEL"
 )
 
@@ -41,9 +42,10 @@ func (e EnvironmentVariable) String() string {
 }
 
 type Config struct {
-	Log          LogConfig        `toml:"log"`
-	ServerConfig ServerConfig     `toml:"server"`
-	DHTConfig    DHTServiceConfig `toml:"dht"`
+	Log             LogConfig        `toml:"log"`
+	ServerConfig    ServerConfig     `toml:"server"`
+	DHTConfig       DHTServiceConfig `toml:"dht"`
+	RetentionConfig RetentionConfig  `toml:"retention"`
 }
 
 type ServerConfig struct {
@@ -53,13 +55,60 @@ type ServerConfig struct {
 	BaseURL     string      `toml:"base_url"`
 	StorageURI  string      `toml:"storage_uri"`
 	Telemetry   bool        `toml:"telemetry"`
+	// FQDN is the fully qualified domain name of the gateway, used to recognize the DIDs it is an authoritative
+	// gateway for https://did-dht.com/#designating-authoritative-gateways
+	FQDN string `toml:"fqdn"`
+	// TLSCertFile and TLSKeyFile are the PEM encoded certificate and key the server serves TLS with, if set
+	TLSCertFile string `toml:"tls_cert_file"`
+	TLSKeyFile  string `toml:"tls_key_file"`
+	// AdminToken is the bearer token that authenticates requests to the admin API. It is best set through the
+	// ADMIN_TOKEN environment variable rather than in a config file.
+	AdminToken string `toml:"admin_token"`
+	// AdminClientCAFile is a PEM file of the certificate authorities whose client certificates authenticate requests
+	// to the admin API, which requires the server to serve TLS. The admin API is only served when it or an admin
+	// token is set.
+	AdminClientCAFile string `toml:"admin_client_ca_file"`
 }
 
 type DHTServiceConfig struct {
-	BootstrapPeers   []string `toml:"bootstrap_peers"`
-	RepublishCRON    string   `toml:"republish_cron"`
-	CacheTTLSeconds  int      `toml:"cache_ttl_seconds"`
-	CacheSizeLimitMB int      `toml:"cache_size_limit_mb"`
+	BootstrapPeers []string `toml:"bootstrap_peers"`
+	// RepublishIntervalSeconds is how often each record is republished, which must be under the roughly 2 hour lifetime
+	// of a record on Mainline. Records are scheduled individually, spread evenly across the interval.
+	RepublishIntervalSeconds int `toml:"republish_interval_seconds"`
+	// RepublishConcurrency is the number of workers republishing records, and so the most records republished at once
+	RepublishConcurrency int `toml:"republish_concurrency"`
+	// RepublishTimeoutSeconds is how long a worker waits for a record to be put to the DHT before it gives up
+	RepublishTimeoutSeconds int `toml:"republish_timeout_seconds"`
+	// RepublishBatchSize is the most records read from storage and queued for the workers at once
+	RepublishBatchSize int `toml:"republish_batch_size"`
+	// RepublishMaxFailures is the number of times in a row a record may fail to be republished, retried with backoff
+	// in between, before it is quarantined and no longer republished
+	RepublishMaxFailures int `toml:"republish_max_failures"`
+	CacheTTLSeconds      int `toml:"cache_ttl_seconds"`
+	CacheSizeLimitMB     int `toml:"cache_size_limit_mb"`
+	// StrictValidation rejects published records whose DNS packets do not decode to a valid DID DHT Document, rather
+	// than only checking their signatures
+	StrictValidation bool `toml:"strict_validation"`
+}
+
+// RetentionConfig configures the retention challenges issued by the gateway https://did-dht.com/#retained-did-set
+type RetentionConfig struct {
+	Enabled bool `toml:"enabled"`
+	// HashSource is the source of challenge hashes, one of "local" or "bitcoin"
+	HashSource string `toml:"hash_source"`
+	// LocalHashSeed seeds the deterministic hash chain used by the "local" hash source, a random seed is used if empty
+	LocalHashSeed string `toml:"local_hash_seed"`
+	// Difficulty is the number of leading zero bits a retention solution must have
+	Difficulty int `toml:"difficulty"`
+	// RefreshCRON is the schedule on which the challenge hash is rotated
+	RefreshCRON string `toml:"refresh_cron"`
+	// GracePeriodSeconds is how long the previous hash is still accepted after a rotation
+	GracePeriodSeconds int `toml:"grace_period_seconds"`
+	// RetentionPeriodSeconds is how long a DID is retained after a valid retention solution is accepted
+	RetentionPeriodSeconds int `toml:"retention_period_seconds"`
+	// DefaultRetentionSeconds is how long a DID is retained after it is published without a retention solution,
+	// including when retention sets are disabled
+	DefaultRetentionSeconds int `toml:"default_retention_seconds"`
 }
 
 type LogConfig struct {
@@ -77,10 +126,23 @@ func GetDefaultConfig() Config {
 			Telemetry:   false,
 		},
 		DHTConfig: DHTServiceConfig{
-			BootstrapPeers:   GetDefaultBootstrapPeers(),
-			RepublishCRON:    "0 */3 * * *",
-			CacheTTLSeconds:  600,
-			CacheSizeLimitMB: 1000,
+			BootstrapPeers:           GetDefaultBootstrapPeers(),
+			RepublishIntervalSeconds: 5400,
+			RepublishConcurrency:     100,
+			RepublishTimeoutSeconds:  10,
+			RepublishBatchSize:       1000,
+			RepublishMaxFailures:     8,
+			CacheTTLSeconds:          600,
+			CacheSizeLimitMB:         1000,
+		},
+		RetentionConfig: RetentionConfig{
+			Enabled:                 true,
+			HashSource:              "local",
+			Difficulty:              26,
+			RefreshCRON:             "*/10 * * * *",
+			GracePeriodSeconds:      600,
+			RetentionPeriodSeconds:  604800,
+			DefaultRetentionSeconds: 86400,
 		},
 		Log: LogConfig{
 			Level: logrus.DebugLevel.String(),
@@ -96,10 +158,9 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, errors.Wrap(err, "validating config path")
 	}
 
-	var cfg Config
+	cfg := GetDefaultConfig()
 	if loadDefaultConfig {
 		logrus.Info("loading default config...")
-		cfg = GetDefaultConfig()
 	} else {
 		if path == "" {
 			logrus.Info("no config path provided, trying default config path...")
@@ -129,11 +190,17 @@ func checkValidConfigPath(path string) (bool, error) {
 	return defaultConfig, nil
 }
 
+// loadTOMLConfig decodes the TOML file at the given path on top of the given config, so that properties missing from
+// the file, such as those added since it was written, keep their current values
 func loadTOMLConfig(path string, cfg *Config) error {
 	// load from TOML file
-	if _, err := toml.DecodeFile(path, cfg); err != nil {
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
 		return errors.Wrapf(err, "could not load config: %s", path)
 	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		logrus.WithField("keys", undecoded).Warn("ignoring unknown config properties")
+	}
 	return nil
 }
 
@@ -157,6 +224,11 @@ func applyEnvVariables(cfg *Config) error {
 		cfg.ServerConfig.StorageURI = storage
 	}
 
+	adminToken, present := os.LookupEnv(AdminToken.String())
+	if present {
+		cfg.ServerConfig.AdminToken = adminToken
+	}
+
 	levelString, present := os.LookupEnv(LogLevel.String())
 	if present {
 		_, err := logrus.ParseLevel(levelString)
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("test load default config", func(t *testing.T) {
+		cfg, err := LoadConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, GetDefaultConfig(), *cfg)
+	})
+
+	t.Run("test load config with bad extension", func(t *testing.T) {
+		_, err := LoadConfig("config.json")
+		assert.ErrorContains(t, err, `file extension for path "config.json" must be ".toml"`)
+	})
+
+	t.Run("test load config missing properties", func(t *testing.T) {
+		// a config written before the republish schedule and retention properties were added, with the since removed
+		// republish_cron property
+		cfg, err := LoadConfig("testdata/legacy-config.toml")
+		require.NoError(t, err)
+
+		defaults := GetDefaultConfig()
+		assert.Equal(t, "bolt://diddht.db", cfg.ServerConfig.StorageURI)
+		assert.Equal(t, defaults.ServerConfig.BaseURL, cfg.ServerConfig.BaseURL)
+		assert.Equal(t, defaults.DHTConfig.BootstrapPeers, cfg.DHTConfig.BootstrapPeers)
+		assert.Equal(t, 5400, cfg.DHTConfig.RepublishIntervalSeconds)
+		assert.Equal(t, 100, cfg.DHTConfig.RepublishConcurrency)
+		assert.Equal(t, 10, cfg.DHTConfig.RepublishTimeoutSeconds)
+		assert.Equal(t, 1000, cfg.DHTConfig.RepublishBatchSize)
+		assert.Equal(t, 8, cfg.DHTConfig.RepublishMaxFailures)
+		assert.Equal(t, defaults.RetentionConfig, cfg.RetentionConfig)
+		assert.Equal(t, defaults.Log, cfg.Log)
+	})
+
+	t.Run("test load config overrides defaults", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(path, []byte("[dht]\nrepublish_interval_seconds = 3600\n"), 0600))
+
+		cfg, err := LoadConfig(path)
+		require.NoError(t, err)
+		expected := GetDefaultConfig()
+		expected.DHTConfig.RepublishIntervalSeconds = 3600
+		assert.Equal(t, expected, *cfg)
+	})
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 var (
@@ -103,7 +104,7 @@ func generateDIDPutRequest() (string, []byte, error) {
 		return "", nil, err
 	}
 
-	bep44Put, err := dht.CreateDNSPublishRequest(sk, *packet)
+	bep44Put, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	if err != nil {
 		return "", nil, err
 	}
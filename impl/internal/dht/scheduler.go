@@ -34,6 +34,20 @@ func (s *Scheduler) Schedule(schedule string, job func()) error {
 	return nil
 }
 
+// ScheduleEvery schedules a job to run at the given interval, starting immediately, and starts it asynchronously
+func (s *Scheduler) ScheduleEvery(interval time.Duration, job func()) error {
+	if s.job != nil {
+		return errors.New("job already scheduled")
+	}
+	j, err := s.scheduler.Every(interval).Do(job)
+	if err != nil {
+		return err
+	}
+	s.job = j
+	s.Start()
+	return nil
+}
+
 // Start starts the scheduler
 func (s *Scheduler) Start() {
 	s.scheduler.StartAsync()
@@ -2,6 +2,7 @@ package did
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
 	"net/http"
@@ -9,16 +10,20 @@ import (
 	"time"
 
 	"github.com/anacrolix/dht/v2/bep44"
-	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 )
 
+// ErrDIDNotFound is returned when no DID document is found for a DID, such as by a did:dht Gateway
+var ErrDIDNotFound = errors.New("did not found")
+
 // GatewayClient is the client for the Gateway API
 type GatewayClient struct {
 	gatewayURL string
 	client     *http.Client
 }
 
+var _ Publisher = (*GatewayClient)(nil)
+
 // NewGatewayClient returns a new instance of the Gateway client
 func NewGatewayClient(gatewayURL string) (*GatewayClient, error) {
 	if _, err := url.Parse(gatewayURL); err != nil {
@@ -47,6 +52,9 @@ func (c *GatewayClient) GetDIDDocument(id string) (*DIDDHTDocument, error) {
 		return nil, errors.Wrap(err, "failed to get did document")
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrDIDNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, errors.Errorf("failed to get did document, status code: %d", resp.StatusCode)
 	}
@@ -54,15 +62,42 @@ func (c *GatewayClient) GetDIDDocument(id string) (*DIDDHTDocument, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read response body")
 	}
-	msg := new(dns.Msg)
-	if err = msg.Unpack(body[72:]); err != nil {
+	msg, err := UnpackDNSPacket(body[72:])
+	if err != nil {
 		return nil, errors.Wrap(err, "failed to unpack records")
 	}
 	return d.FromDNSPacket(msg)
 }
 
+// GetInteroperableDIDDocument gets the DID document of a did:key or did:jwk DID: the document of the DID's own
+// method, merged with the DID DHT Document published for its key, if any, from a did:dht Gateway
+// https://did-dht.com/registry/#interoperable-did-methods
+func (c *GatewayClient) GetInteroperableDIDDocument(id string) (*DIDDHTDocument, error) {
+	dhtID, err := InteroperableDHT(id)
+	if err != nil {
+		return nil, err
+	}
+	published, err := c.GetDIDDocument(dhtID.String())
+	if err != nil && !errors.Is(err, ErrDIDNotFound) {
+		return nil, err
+	}
+	return MergeInteroperableDocument(id, published)
+}
+
 // PutDocument puts a bep44.Put message to a did:dht Gateway
 func (c *GatewayClient) PutDocument(id string, put bep44.Put) error {
+	return c.putDocument(context.Background(), id, put)
+}
+
+// Publish puts a bep44.Put message to a did:dht Gateway for the DID identified by the message's key
+func (c *GatewayClient) Publish(ctx context.Context, put bep44.Put) error {
+	if put.K == nil {
+		return errors.New("put is missing its key")
+	}
+	return c.putDocument(ctx, GetDIDDHTIdentifier(put.K[:]), put)
+}
+
+func (c *GatewayClient) putDocument(ctx context.Context, id string, put bep44.Put) error {
 	d := DHT(id)
 	if !d.IsValid() {
 		return errors.New("invalid did")
@@ -77,7 +112,7 @@ func (c *GatewayClient) PutDocument(id string, put bep44.Put) error {
 	binary.BigEndian.PutUint64(seqBuf[:], uint64(put.Seq))
 	reqBytes := append(put.Sig[:], append(seqBuf[:], put.V.([]byte)...)...)
 
-	req, err := http.NewRequest(http.MethodPut, c.gatewayURL+"/"+suffix, bytes.NewReader(reqBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.gatewayURL+"/"+suffix, bytes.NewReader(reqBytes))
 	if err != nil {
 		return errors.Wrap(err, "could not construct http put request")
 	}
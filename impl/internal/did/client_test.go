@@ -1,4 +1,4 @@
-package did
+package did_test
 
 import (
 	"testing"
@@ -8,26 +8,28 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 func TestClient(t *testing.T) {
-	client, err := NewGatewayClient("https://diddht.tbddev.org")
+	client, err := did.NewGatewayClient("https://diddht.tbddev.org")
 
 	require.NoError(t, err)
 	require.NotNil(t, client)
 
 	start := time.Now()
 
-	sk, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+	sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
 	require.NoError(t, err)
 	require.NotEmpty(t, doc)
 
-	packet, err := DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+	packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, packet)
 
-	bep44Put, err := dht.CreateDNSPublishRequest(sk, *packet)
+	bep44Put, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, bep44Put)
 
@@ -43,13 +45,13 @@ func TestClient(t *testing.T) {
 }
 
 func TestClientInvalidGateway(t *testing.T) {
-	g, err := NewGatewayClient("\n")
+	g, err := did.NewGatewayClient("\n")
 	assert.Error(t, err)
 	assert.Nil(t, g)
 }
 
 func TestInvalidDIDDocument(t *testing.T) {
-	client, err := NewGatewayClient("https://diddht.tbddev.test")
+	client, err := did.NewGatewayClient("https://diddht.tbddev.test")
 	require.NoError(t, err)
 	require.NotEmpty(t, client)
 
@@ -65,7 +67,7 @@ func TestInvalidDIDDocument(t *testing.T) {
 	assert.Error(t, err) // this should error because the gateway URL is invalid
 	assert.Empty(t, gotDID)
 
-	client, err = NewGatewayClient("https://tbd.website")
+	client, err = did.NewGatewayClient("https://tbd.website")
 	require.NoError(t, err)
 	require.NotEmpty(t, client)
 
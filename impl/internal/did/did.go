@@ -1,20 +1,29 @@
 package did
 
 import (
+	gocrypto "crypto"
 	"crypto/ed25519"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/TBD54566975/ssi-sdk/crypto"
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	"github.com/TBD54566975/ssi-sdk/cryptosuite"
 	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/cloudflare/circl/sign/ed448"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"github.com/tv42/zbase32"
+
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 type (
@@ -36,6 +45,15 @@ const (
 	// Version corresponds to the version fo the specification https://did-dht.com/#dids-as-dns-records
 	Version int = 0
 
+	// Ed448 is the Ed448 key type https://www.rfc-editor.org/rfc/rfc8037#section-2
+	Ed448 crypto.KeyType = "Ed448"
+	// BBS is the default algorithm for BLS12-381 G2 keys
+	// https://datatracker.ietf.org/doc/html/draft-ietf-jose-json-proof-algorithms#name-bbs
+	BBS = "BBS"
+
+	// deactivatedRootRecord is the rdata of the root record of a deactivated DID https://did-dht.com/#deactivate
+	deactivatedRootRecord = "deactivated"
+
 	Discoverable           TypeIndex = 0
 	Organization           TypeIndex = 1
 	GovernmentOrganization TypeIndex = 2
@@ -46,6 +64,59 @@ const (
 	FinancialInstitution   TypeIndex = 7
 )
 
+// gatewayHostRegex matches a domain name of two or more letter-digit-hyphen labels
+var gatewayHostRegex = regexp.MustCompile(`^(?i)([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// typeDescriptions holds the descriptions of the types in the Indexed Types registry
+// https://did-dht.com/registry/index.html#indexed-types
+var typeDescriptions = map[TypeIndex]string{
+	Discoverable:           "Discoverable",
+	Organization:           "Organization",
+	GovernmentOrganization: "Government Organization",
+	Corporation:            "Corporation",
+	LocalBusiness:          "Local Business",
+	SoftwarePackage:        "Software Package",
+	WebApplication:         "Web App",
+	FinancialInstitution:   "Financial Institution",
+}
+
+// RegisteredTypes returns the types in the Indexed Types registry in ascending order
+func RegisteredTypes() []TypeIndex {
+	types := make([]TypeIndex, 0, len(typeDescriptions))
+	for t := range typeDescriptions {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// Description returns the description of the type in the Indexed Types registry, or false if the type is not registered
+func (t TypeIndex) Description() (string, bool) {
+	description, ok := typeDescriptions[t]
+	return description, ok
+}
+
+// Host returns the domain name of the gateway, without the trailing dot of a fully qualified domain name
+func (g AuthoritativeGateway) Host() string {
+	return strings.TrimSuffix(string(g), ".")
+}
+
+// URL returns the URL at which the gateway's API is served. Gateways are named by their domain name alone and are
+// always reached over HTTPS; a gateway given as a URL, with a port, or as an IP address is rejected, as publishers
+// choose their gateways without any authentication.
+func (g AuthoritativeGateway) URL() (string, error) {
+	host := g.Host()
+	if !gatewayHostRegex.MatchString(host) || net.ParseIP(host) != nil {
+		return "", fmt.Errorf("authoritative gateway is not a domain name: %s", g)
+	}
+	return "https://" + host, nil
+}
+
+// IsGateway returns true if the gateway has the given fully qualified domain name
+func (g AuthoritativeGateway) IsGateway(fqdn string) bool {
+	return fqdn != "" && strings.EqualFold(g.Host(), strings.TrimSuffix(fqdn, "."))
+}
+
 func (d DHT) IsValid() bool {
 	suffix, err := d.Suffix()
 	if err != nil {
@@ -103,7 +174,8 @@ type VerificationMethod struct {
 	Purposes           []did.PublicKeyPurpose `json:"purposes"`
 }
 
-// GenerateDIDDHT generates a did:dht identifier given a set of options
+// GenerateDIDDHT generates a did:dht identifier given a set of options, with an identity key held in memory. DIDs for
+// identity keys held elsewhere are created with CreateDIDDHTDID from the public key of their signer.Signer.
 func GenerateDIDDHT(opts CreateDIDDHTOpts) (ed25519.PrivateKey, *did.Document, error) {
 	// generate the identity key
 	pubKey, privKey, err := crypto.GenerateEd25519Key()
@@ -265,6 +337,13 @@ func GetDIDDHTIdentifier(pubKey []byte) string {
 
 // ToDNSPacket converts a DID DHT Document to a DNS packet with an optional list of types to include
 func (d DHT) ToDNSPacket(doc did.Document, types []TypeIndex, gateways []AuthoritativeGateway, previousDID *PreviousDID) (*dns.Msg, error) {
+	return d.toDNSPacket(doc, types, gateways, previousDID, false)
+}
+
+// toDNSPacket converts a DID DHT Document to a DNS packet. Key records leave out ids that are the key's JWK
+// thumbprint and algorithms that are the default for the key type; a compact packet also leaves out empty
+// controllers, which decode as the DID, and uses DNS name compression.
+func (d DHT) toDNSPacket(doc did.Document, types []TypeIndex, gateways []AuthoritativeGateway, previousDID *PreviousDID, compact bool) (*dns.Msg, error) {
 	var records []dns.RR
 	var rootRecord []string
 	keyLookup := make(map[string]string)
@@ -335,16 +414,19 @@ func (d DHT) ToDNSPacket(doc did.Document, types []TypeIndex, gateways []Authori
 		records = append(records, &akaAnswer)
 	}
 
-	// add all gateways
+	// add all gateways as NS records targeting each gateway's FQDN https://did-dht.com/#designating-authoritative-gateways
 	for _, gateway := range gateways {
-		gatewayAnswer := dns.TXT{
+		if gateway == "" {
+			return nil, errors.New("gateway cannot be empty")
+		}
+		gatewayAnswer := dns.NS{
 			Hdr: dns.RR_Header{
 				Name:   fmt.Sprintf("_did.%s.", suffix),
 				Rrtype: dns.TypeNS,
 				Class:  dns.ClassINET,
 				Ttl:    7200,
 			},
-			Txt: chunkTextRecord(string(gateway)),
+			Ns: dns.Fqdn(string(gateway)),
 		}
 		records = append(records, &gatewayAnswer)
 	}
@@ -360,14 +442,8 @@ func (d DHT) ToDNSPacket(doc did.Document, types []TypeIndex, gateways []Authori
 			return nil, fmt.Errorf("unsupported key type given alg: %s", vm.PublicKeyJWK.ALG)
 		}
 
-		// convert the public key to a base64url encoded string
-		pubKey, err := vm.PublicKeyJWK.ToPublicKey()
-		if err != nil {
-			return nil, err
-		}
-
-		// as per the spec's guidance DNS representations use compressed keys, so we must marshal them as such
-		pubKeyBytes, err := crypto.PubKeyToBytes(pubKey, crypto.ECDSAMarshalCompressed)
+		// convert the public key to its compressed bytes, to be base64url encoded
+		pubKeyBytes, err := publicKeyBytesForJWK(vm.PublicKeyJWK)
 		if err != nil {
 			return nil, err
 		}
@@ -394,7 +470,7 @@ func (d DHT) ToDNSPacket(doc did.Document, types []TypeIndex, gateways []Authori
 		}
 
 		// note the controller if it differs from the DID
-		if vm.Controller != doc.ID {
+		if vm.Controller != doc.ID && (!compact || vm.Controller != "") {
 			// handle the case where the controller of the identity key is not the DID itself
 			if vm.ID == doc.ID+"#0" && (vm.Controller != "" || vm.Controller != doc.ID) {
 				return nil, fmt.Errorf("controller of identity key must be the DID itself, instead it is: %s", vm.Controller)
@@ -430,12 +506,24 @@ func (d DHT) ToDNSPacket(doc did.Document, types []TypeIndex, gateways []Authori
 			sID = sID[strings.LastIndex(service.ID, "#")+1:]
 		}
 
-		svcTxt := fmt.Sprintf("id=%s;t=%s;se=%s", sID, service.Type, parseServiceData(service.ServiceEndpoint))
+		serviceEndpoint, err := encodeServiceData(service.ServiceEndpoint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode endpoint of service %s", service.ID)
+		}
+		svcTxt := fmt.Sprintf("id=%s;t=%s;se=%s", escapeTxtValue(sID), escapeTxtValue(service.Type), serviceEndpoint)
 		if service.Sig != nil {
-			svcTxt += fmt.Sprintf(";sig=%s", parseServiceData(service.Sig))
+			sig, err := encodeServiceData(service.Sig)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to encode sig of service %s", service.ID)
+			}
+			svcTxt += fmt.Sprintf(";sig=%s", sig)
 		}
 		if service.Enc != nil {
-			svcTxt += fmt.Sprintf(";enc=%s", parseServiceData(service.Enc))
+			enc, err := encodeServiceData(service.Enc)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to encode enc of service %s", service.ID)
+			}
+			svcTxt += fmt.Sprintf(";enc=%s", enc)
 		}
 		serviceRecord := dns.TXT{
 			Hdr: dns.RR_Header{
@@ -534,40 +622,47 @@ func (d DHT) ToDNSPacket(doc did.Document, types []TypeIndex, gateways []Authori
 			Response:      true,
 			Authoritative: true,
 		},
-		Answer: records,
+		Compress: compact,
+		Answer:   records,
 	}, nil
 }
 
-// make a best-effort to parse a service endpoints and other service data which we expect as either a single string
-// value or an array of strings
-func parseServiceData(serviceEndpoint any) string {
-	switch se := serviceEndpoint.(type) {
-	case string:
-		return se
-	case []string:
-		if len(se) == 1 {
-			return se[0]
-		}
-		return strings.Join(se, ",")
-	case []any:
-		if len(se) == 1 {
-			return fmt.Sprintf("%v", se[0])
-		}
-		var result []string
-		for _, v := range se {
-			result = append(result, fmt.Sprintf("%v", v))
-		}
-		return strings.Join(result, ",")
+// CreateDeactivatedPacket creates a DNS packet deactivating the DID, whose root record's rdata is the string
+// `deactivated` https://did-dht.com/#deactivate
+func (d DHT) CreateDeactivatedPacket() (*dns.Msg, error) {
+	suffix, err := d.Suffix()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get suffix while creating deactivated DNS packet")
 	}
-	return ""
+
+	return &dns.Msg{
+		MsgHdr: dns.MsgHdr{
+			Id:            0,
+			Response:      true,
+			Authoritative: true,
+		},
+		Answer: []dns.RR{
+			&dns.TXT{
+				Hdr: dns.RR_Header{
+					Name:   fmt.Sprintf("_did.%s.", suffix),
+					Rrtype: dns.TypeTXT,
+					Class:  dns.ClassINET,
+					Ttl:    7200,
+				},
+				Txt: []string{deactivatedRootRecord},
+			},
+		},
+	}, nil
 }
 
-// DIDDHTDocument is a DID DHT Document along with additional metadata the DID supports
+// DIDDHTDocument is a DID DHT Document along with additional metadata the DID supports. A deactivated DID's document
+// holds only its id.
 type DIDDHTDocument struct {
 	Doc         did.Document           `json:"did,omitempty"`
 	Types       []TypeIndex            `json:"types,omitempty"`
 	Gateways    []AuthoritativeGateway `json:"gateways,omitempty"`
 	PreviousDID *PreviousDID           `json:"previousDid,omitempty"`
+	Deactivated bool                   `json:"deactivated,omitempty"`
 }
 
 // FromDNSPacket converts a DNS packet to a DID DHT Document
@@ -594,6 +689,8 @@ func (d DHT) FromDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
 	var types []TypeIndex
 	// track the previous DID
 	var previousDID *PreviousDID
+	// track the root record
+	var rootRecord *string
 	keyLookup := make(map[string]string)
 	for _, rr := range msg.Answer {
 		switch record := rr.(type) {
@@ -631,13 +728,7 @@ func (d DHT) FromDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
 					return nil, err
 				}
 
-				// as per the spec's guidance DNS representations use compressed keys, so we must unmarshall them as such
-				pubKey, err := crypto.BytesToPubKey(pubKeyBytes, keyType, crypto.ECDSAUnmarshalCompressed)
-				if err != nil {
-					return nil, err
-				}
-
-				pubKeyJWK, err := jwx.PublicKeyToPublicKeyJWK(nil, pubKey)
+				pubKeyJWK, pubKey, err := publicKeyJWKForBytes(pubKeyBytes, keyType)
 				if err != nil {
 					return nil, err
 				}
@@ -684,26 +775,24 @@ func (d DHT) FromDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
 			} else if strings.HasPrefix(record.Hdr.Name, "_s") {
 				unchunkedTextRecord := unchunkTextRecord(record.Txt)
 				data := parseTxtData(unchunkedTextRecord)
-				sID := data["id"]
-				serviceType := data["t"]
-				serviceEndpoint := data["se"]
+				sID := unescapeTxtValue(data["id"])
+				serviceEndpoint, err := decodeServiceData(data["se"])
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to decode endpoint of service %s", sID)
+				}
 				service := did.Service{
 					ID:              didID + "#" + sID,
-					Type:            serviceType,
-					ServiceEndpoint: strings.Split(serviceEndpoint, ","),
+					Type:            unescapeTxtValue(data["t"]),
+					ServiceEndpoint: serviceEndpoint,
 				}
 				if data["sig"] != "" {
-					if strings.Contains(data["sig"], ",") {
-						service.Sig = strings.Split(data["sig"], ",")
-					} else {
-						service.Sig = data["sig"]
+					if service.Sig, err = decodeServiceProperty(data["sig"]); err != nil {
+						return nil, errors.Wrapf(err, "failed to decode sig of service %s", sID)
 					}
 				}
 				if data["enc"] != "" {
-					if strings.Contains(data["enc"], ",") {
-						service.Enc = strings.Split(data["enc"], ",")
-					} else {
-						service.Enc = data["enc"]
+					if service.Enc, err = decodeServiceProperty(data["enc"]); err != nil {
+						return nil, errors.Wrapf(err, "failed to decode enc of service %s", sID)
 					}
 				}
 				doc.Services = append(doc.Services, service)
@@ -721,12 +810,6 @@ func (d DHT) FromDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
 					}
 					types = append(types, TypeIndex(tInt))
 				}
-			} else if record.Hdr.Name == fmt.Sprintf("_did.%s.", suffix) && record.Hdr.Rrtype == dns.TypeNS {
-				if record.Txt[0] == "" {
-					return nil, fmt.Errorf("gateway record is empty")
-				}
-				unchunkedTextRecord := unchunkTextRecord(record.Txt)
-				gateways = append(gateways, AuthoritativeGateway(unchunkedTextRecord))
 			} else if record.Hdr.Name == "_prv._did." && record.Hdr.Rrtype == dns.TypeTXT {
 				unchunkedTextRecord := unchunkTextRecord(record.Txt)
 				data := parseTxtData(unchunkedTextRecord)
@@ -740,51 +823,69 @@ func (d DHT) FromDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
 				}
 			} else if record.Hdr.Name == fmt.Sprintf("_did.%s.", suffix) && record.Hdr.Rrtype == dns.TypeTXT {
 				unchunkedTextRecord := unchunkTextRecord(record.Txt)
-				rootItems := strings.Split(unchunkedTextRecord, ";")
+				if unchunkedTextRecord == deactivatedRootRecord {
+					return &DIDDHTDocument{
+						Doc:         did.Document{ID: didID},
+						Deactivated: true,
+					}, nil
+				}
+				// the root record references keys by index, so it is parsed once all key records have been seen
+				rootRecord = &unchunkedTextRecord
+			}
+		case *dns.NS:
+			if record.Hdr.Name == fmt.Sprintf("_did.%s.", suffix) {
+				if record.Ns == "" || record.Ns == "." {
+					return nil, fmt.Errorf("gateway record is empty")
+				}
+				gateways = append(gateways, AuthoritativeGateway(record.Ns))
+			}
+		}
+	}
 
-				seenVersion := false
-				for _, item := range rootItems {
-					kv := strings.Split(item, "=")
-					if len(kv) != 2 {
-						continue
-					}
+	if rootRecord != nil {
+		rootItems := strings.Split(*rootRecord, ";")
 
-					key, values := kv[0], kv[1]
-					valueItems := strings.Split(values, ",")
-
-					switch key {
-					case "v":
-						if len(valueItems) != 1 || valueItems[0] != strconv.Itoa(Version) {
-							return nil, fmt.Errorf("invalid version: %s", values)
-						}
-						seenVersion = true
-					case "auth":
-						for _, valueItem := range valueItems {
-							doc.Authentication = append(doc.Authentication, doc.ID+"#"+keyLookup[valueItem])
-						}
-					case "asm":
-						for _, valueItem := range valueItems {
-							doc.AssertionMethod = append(doc.AssertionMethod, doc.ID+"#"+keyLookup[valueItem])
-						}
-					case "agm":
-						for _, valueItem := range valueItems {
-							doc.KeyAgreement = append(doc.KeyAgreement, doc.ID+"#"+keyLookup[valueItem])
-						}
-					case "inv":
-						for _, valueItem := range valueItems {
-							doc.CapabilityInvocation = append(doc.CapabilityInvocation, doc.ID+"#"+keyLookup[valueItem])
-						}
-					case "del":
-						for _, valueItem := range valueItems {
-							doc.CapabilityDelegation = append(doc.CapabilityDelegation, doc.ID+"#"+keyLookup[valueItem])
-						}
-					}
+		seenVersion := false
+		for _, item := range rootItems {
+			kv := strings.Split(item, "=")
+			if len(kv) != 2 {
+				continue
+			}
+
+			key, values := kv[0], kv[1]
+			valueItems := strings.Split(values, ",")
+
+			switch key {
+			case "v":
+				if len(valueItems) != 1 || valueItems[0] != strconv.Itoa(Version) {
+					return nil, fmt.Errorf("invalid version: %s", values)
+				}
+				seenVersion = true
+			case "auth":
+				for _, valueItem := range valueItems {
+					doc.Authentication = append(doc.Authentication, doc.ID+"#"+keyLookup[valueItem])
+				}
+			case "asm":
+				for _, valueItem := range valueItems {
+					doc.AssertionMethod = append(doc.AssertionMethod, doc.ID+"#"+keyLookup[valueItem])
 				}
-				if !seenVersion {
-					return nil, fmt.Errorf("root record missing version identifier")
+			case "agm":
+				for _, valueItem := range valueItems {
+					doc.KeyAgreement = append(doc.KeyAgreement, doc.ID+"#"+keyLookup[valueItem])
+				}
+			case "inv":
+				for _, valueItem := range valueItems {
+					doc.CapabilityInvocation = append(doc.CapabilityInvocation, doc.ID+"#"+keyLookup[valueItem])
+				}
+			case "del":
+				for _, valueItem := range valueItems {
+					doc.CapabilityDelegation = append(doc.CapabilityDelegation, doc.ID+"#"+keyLookup[valueItem])
 				}
 			}
 		}
+		if !seenVersion {
+			return nil, fmt.Errorf("root record missing version identifier")
+		}
 	}
 
 	return &DIDDHTDocument{
@@ -795,13 +896,24 @@ func (d DHT) FromDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
 	}, nil
 }
 
-// CreatePreviousDIDRecord creates a PreviousDID record for the given previous DID and current DID
-func CreatePreviousDIDRecord(previousDIDPrivateKey ed25519.PrivateKey, previousDID, currentDID DHT) (*PreviousDID, error) {
+// CreatePreviousDIDRecord creates a PreviousDID record for the given previous DID and current DID, signed by the
+// previous DID's identity key
+func CreatePreviousDIDRecord(previousDIDSigner signer.Signer, previousDID, currentDID DHT) (*PreviousDID, error) {
+	previousDIDIdentityKey, err := previousDID.IdentityKey()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get identity key from previousDID: %s", previousDID)
+	}
+	if !previousDIDIdentityKey.Equal(previousDIDSigner.PublicKey()) {
+		return nil, errors.New("signer is not for the previous DID's identity key")
+	}
 	currentDIDIdentityKey, err := currentDID.IdentityKey()
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get identity key from currentDID: %s", currentDID)
 	}
-	previousDIDSignature := ed25519.Sign(previousDIDPrivateKey, currentDIDIdentityKey)
+	previousDIDSignature, err := previousDIDSigner.Sign(currentDIDIdentityKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign current DID's identity key")
+	}
 	return &PreviousDID{
 		PreviousDID: previousDID,
 		Signature:   base64.RawURLEncoding.EncodeToString(previousDIDSignature),
@@ -828,14 +940,17 @@ func ValidatePreviousDIDSignatureValid(currentDID DHT, previousDID PreviousDID)
 	return nil
 }
 
+// parseTxtData parses the `;` separated key=value properties of a text record, splitting only on separators that are
+// not escaped. Values are returned escaped, for the properties that are lists to be split on their own separators.
 func parseTxtData(data string) map[string]string {
-	pairs := strings.Split(data, ";")
 	result := make(map[string]string)
-	for _, pair := range pairs {
-		kv := strings.Split(pair, "=")
-		if len(kv) == 2 {
-			result[kv[0]] = kv[1]
+	for _, pair := range splitTxtValue(data, ';') {
+		kv := splitTxtValue(pair, '=')
+		if len(kv) < 2 {
+			continue
 		}
+		// an unescaped '=' in a value is kept, as records predating escaping may hold one
+		result[kv[0]] = strings.TrimPrefix(pair, kv[0]+"=")
 	}
 	return result
 }
@@ -860,6 +975,18 @@ func algIsDefaultForJWK(jwk jwx.PublicKeyJWK) bool {
 	if jwk.CRV == crypto.X25519.String() && jwk.KTY == jwa.OKP.String() {
 		return jwk.ALG == string(crypto.ECDHESA256KW)
 	}
+	// P-384 : ES384
+	if jwk.CRV == crypto.P384.String() && jwk.KTY == jwa.EC.String() {
+		return jwk.ALG == string(crypto.ES384)
+	}
+	// Ed448 : EdDSA
+	if jwk.CRV == Ed448.String() && jwk.KTY == jwa.OKP.String() {
+		return jwk.ALG == jwa.EdDSA.String()
+	}
+	// BLS12-381 G2 : BBS
+	if jwk.CRV == crypto.BLS12381G2.String() && jwk.KTY == jwa.OKP.String() {
+		return jwk.ALG == BBS
+	}
 	return false
 }
 
@@ -883,6 +1010,18 @@ func defaultAlgForJWK(jwk jwx.PublicKeyJWK) string {
 	if jwk.CRV == crypto.X25519.String() && jwk.KTY == jwa.OKP.String() {
 		return string(crypto.ECDHESA256KW)
 	}
+	// P-384 : ES384
+	if jwk.CRV == crypto.P384.String() && jwk.KTY == jwa.EC.String() {
+		return string(crypto.ES384)
+	}
+	// Ed448 : EdDSA
+	if jwk.CRV == Ed448.String() && jwk.KTY == jwa.OKP.String() {
+		return jwa.EdDSA.String()
+	}
+	// BLS12-381 G2 : BBS
+	if jwk.CRV == crypto.BLS12381G2.String() && jwk.KTY == jwa.OKP.String() {
+		return BBS
+	}
 	return ""
 }
 
@@ -898,6 +1037,12 @@ func keyTypeLookUp(keyType string) crypto.KeyType {
 		return crypto.P256
 	case "3":
 		return crypto.X25519
+	case "4":
+		return crypto.P384
+	case "5":
+		return Ed448
+	case "6":
+		return crypto.BLS12381G2
 	default:
 		return ""
 	}
@@ -922,26 +1067,146 @@ func keyTypeForJWK(jwk jwx.PublicKeyJWK) int {
 	if jwk.CRV == crypto.X25519.String() && jwk.KTY == jwa.OKP.String() {
 		return 3
 	}
+	// P-384 : ES384 : 4
+	if jwk.CRV == crypto.P384.String() && jwk.KTY == jwa.EC.String() {
+		return 4
+	}
+	// Ed448 : EdDSA : 5
+	if jwk.CRV == Ed448.String() && jwk.KTY == jwa.OKP.String() {
+		return 5
+	}
+	// BLS12-381 G2 : BBS : 6
+	if jwk.CRV == crypto.BLS12381G2.String() && jwk.KTY == jwa.OKP.String() {
+		return 6
+	}
 	return -1
 }
 
-// chunkTextRecord splits a text record into chunks of 255 characters, taking into account multi-byte characters
+// publicKeyBytesForJWK returns the compressed bytes of the JWK's public key, which DNS representations use as per
+// the spec's guidance. Ed448 and BLS12-381 keys have no Go public key type, and their JWK's x already holds the key
+// in its compressed form, so it is checked and used as is.
+func publicKeyBytesForJWK(jwk *jwx.PublicKeyJWK) ([]byte, error) {
+	if jwk.KTY == jwa.OKP.String() && (jwk.CRV == Ed448.String() || jwk.CRV == crypto.BLS12381G2.String()) {
+		pubKeyBytes, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s public key", jwk.CRV)
+		}
+		if err = validateOKPPublicKey(crypto.KeyType(jwk.CRV), pubKeyBytes); err != nil {
+			return nil, err
+		}
+		// default the alg, as ToPublicKey does for the other key types
+		if jwk.ALG == "" {
+			jwk.ALG = defaultAlgForJWK(*jwk)
+		}
+		return pubKeyBytes, nil
+	}
+
+	pubKey, err := jwk.ToPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.PubKeyToBytes(pubKey, crypto.ECDSAMarshalCompressed)
+}
+
+// publicKeyJWKForBytes returns the JWK for the compressed public key bytes of a key record, along with the public
+// key, which is nil for key types with no Go public key type
+func publicKeyJWKForBytes(pubKeyBytes []byte, keyType crypto.KeyType) (*jwx.PublicKeyJWK, gocrypto.PublicKey, error) {
+	if keyType == Ed448 || keyType == crypto.BLS12381G2 {
+		if err := validateOKPPublicKey(keyType, pubKeyBytes); err != nil {
+			return nil, nil, err
+		}
+		return &jwx.PublicKeyJWK{
+			KTY: jwa.OKP.String(),
+			CRV: keyType.String(),
+			X:   base64.RawURLEncoding.EncodeToString(pubKeyBytes),
+		}, nil, nil
+	}
+
+	// as per the spec's guidance DNS representations use compressed keys, so we must unmarshall them as such
+	pubKey, err := crypto.BytesToPubKey(pubKeyBytes, keyType, crypto.ECDSAUnmarshalCompressed)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKeyJWK, err := jwx.PublicKeyToPublicKeyJWK(nil, pubKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pubKeyJWK, pubKey, nil
+}
+
+// validateOKPPublicKey checks an Ed448 public key's length, or that a BLS12-381 G2 public key is a compressed point
+// in the G2 subgroup
+func validateOKPPublicKey(keyType crypto.KeyType, pubKeyBytes []byte) error {
+	switch keyType {
+	case Ed448:
+		if len(pubKeyBytes) != ed448.PublicKeySize {
+			return errors.Errorf("invalid Ed448 public key length: %d", len(pubKeyBytes))
+		}
+	case crypto.BLS12381G2:
+		if len(pubKeyBytes) != bls12381.G2SizeCompressed {
+			return errors.Errorf("invalid compressed BLS12-381 G2 public key length: %d", len(pubKeyBytes))
+		}
+		if err := new(bls12381.G2).SetBytes(pubKeyBytes); err != nil {
+			return errors.Wrap(err, "invalid BLS12-381 G2 public key")
+		}
+	default:
+		return errors.Errorf("unsupported key type: %s", keyType)
+	}
+	return nil
+}
+
+// chunkTextRecord splits a text record into character strings of at most 255 bytes, taking into account multi-byte
+// characters. The strings are in the presentation format the dns package packs, with any backslash escaped.
 func chunkTextRecord(record string) []string {
 	var chunks []string
-	runeArray := []rune(record) // Convert to rune slice to properly handle multi-byte characters
-	for len(runeArray) > 0 {
-		if len(runeArray) <= 255 {
-			chunks = append(chunks, string(runeArray))
-			break
+	var chunk strings.Builder
+	size := 0
+	for _, r := range record {
+		runeSize := utf8.RuneLen(r)
+		if runeSize < 0 {
+			runeSize = len(string(r))
 		}
-
-		chunks = append(chunks, string(runeArray[:255]))
-		runeArray = runeArray[255:]
+		if size+runeSize > 255 {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+			size = 0
+		}
+		if r == '\\' {
+			chunk.WriteByte('\\')
+		}
+		chunk.WriteRune(r)
+		size += runeSize
+	}
+	if size > 0 {
+		chunks = append(chunks, chunk.String())
 	}
 	return chunks
 }
 
-// unchunkTextRecord joins chunks of a text record
+// unchunkTextRecord joins the character strings of a text record, removing the escapes of the presentation format the
+// dns package unpacks them to: a backslash before a character, or before the three digit decimal value of a byte
 func unchunkTextRecord(chunks []string) string {
-	return strings.Join(chunks, "")
+	record := strings.Join(chunks, "")
+	if !strings.ContainsRune(record, '\\') {
+		return record
+	}
+	var b strings.Builder
+	for i := 0; i < len(record); i++ {
+		if record[i] != '\\' || i+1 == len(record) {
+			b.WriteByte(record[i])
+			continue
+		}
+		i++
+		if i+2 < len(record) && isDigit(record[i]) && isDigit(record[i+1]) && isDigit(record[i+2]) {
+			b.WriteByte((record[i]-'0')*100 + (record[i+1]-'0')*10 + (record[i+2] - '0'))
+			i += 2
+			continue
+		}
+		b.WriteByte(record[i])
+	}
+	return b.String()
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
 }
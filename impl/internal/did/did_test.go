@@ -10,8 +10,11 @@ import (
 	"github.com/TBD54566975/ssi-sdk/cryptosuite"
 	"github.com/TBD54566975/ssi-sdk/did"
 	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 func TestGenerateDIDDHT(t *testing.T) {
@@ -169,6 +172,100 @@ func TestToDNSPacket(t *testing.T) {
 		assert.EqualValues(t, *doc, didDHTDoc.Doc)
 	})
 
+	t.Run("doc with gateways - test packed dns packet round trip", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		didID := DHT(doc.ID)
+		gateways := []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com.", "gateway2.example-did-dht-gateway.com"}
+		packet, err := didID.ToDNSPacket(*doc, nil, gateways, nil)
+		require.NoError(t, err)
+
+		// gateways are real NS records targeting each gateway's FQDN
+		var nsRecords []*dns.NS
+		for _, rr := range packet.Answer {
+			if ns, ok := rr.(*dns.NS); ok {
+				nsRecords = append(nsRecords, ns)
+			}
+		}
+		require.Len(t, nsRecords, 2)
+		assert.Equal(t, "gateway2.example-did-dht-gateway.com.", nsRecords[1].Ns)
+
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		unpacked := new(dns.Msg)
+		require.NoError(t, unpacked.Unpack(packed))
+
+		didDHTDoc, err := didID.FromDNSPacket(unpacked)
+		require.NoError(t, err)
+		assert.Equal(t, []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com.", "gateway2.example-did-dht-gateway.com."}, didDHTDoc.Gateways)
+		assert.EqualValues(t, *doc, didDHTDoc.Doc)
+	})
+
+	t.Run("doc with legacy gateway records - test from packed dns packet", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		didID := DHT(doc.ID)
+		suffix, err := didID.Suffix()
+		require.NoError(t, err)
+		packet, err := didID.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+
+		// gateways used to be encoded as TXT records with an NS header, which packs but does not unpack as NS records
+		packet.Answer = append(packet.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   fmt.Sprintf("_did.%s.", suffix),
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    7200,
+			},
+			Txt: []string{"gateway1.example-did-dht-gateway.com"},
+		})
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		assert.Error(t, new(dns.Msg).Unpack(packed))
+
+		unpacked, err := UnpackDNSPacket(packed)
+		require.NoError(t, err)
+		didDHTDoc, err := didID.FromDNSPacket(unpacked)
+		require.NoError(t, err)
+		assert.Equal(t, []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}, didDHTDoc.Gateways)
+		assert.EqualValues(t, *doc, didDHTDoc.Doc)
+	})
+
+	t.Run("deactivated doc - test to dns packet round trip", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		didID := DHT(doc.ID)
+		packet, err := didID.CreateDeactivatedPacket()
+		require.NoError(t, err)
+		require.Len(t, packet.Answer, 1)
+
+		// the packet survives packing, as it would when published
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		var unpacked dns.Msg
+		require.NoError(t, unpacked.Unpack(packed))
+
+		didDHTDoc, err := didID.FromDNSPacket(&unpacked)
+		require.NoError(t, err)
+		assert.True(t, didDHTDoc.Deactivated)
+		assert.Equal(t, doc.ID, didDHTDoc.Doc.ID)
+		assert.Empty(t, didDHTDoc.Doc.VerificationMethod)
+
+		// an active doc is not deactivated
+		packet, err = didID.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		didDHTDoc, err = didID.FromDNSPacket(packet)
+		require.NoError(t, err)
+		assert.False(t, didDHTDoc.Deactivated)
+
+		_, err = DHT("did:example:abcd").CreateDeactivatedPacket()
+		assert.Error(t, err)
+	})
+
 	t.Run("doc with multiple keys and services - test to dns packet round trip", func(t *testing.T) {
 		pubKey, _, err := crypto.GenerateSECP256k1Key()
 		require.NoError(t, err)
@@ -384,7 +481,7 @@ func TestDIDDHTFeatures(t *testing.T) {
 		require.NotEmpty(t, previousDoc)
 
 		previousDIDDHT := DHT(previousDoc.ID)
-		previousDID, err := CreatePreviousDIDRecord(previousPrivKey, previousDIDDHT, "did:dht:sr6jgmcc84xig18ix66qbiwnzeiumocaaybh13f5w97bfzus4pcy")
+		previousDID, err := CreatePreviousDIDRecord(signer.NewInMemorySigner(previousPrivKey), previousDIDDHT, "did:dht:sr6jgmcc84xig18ix66qbiwnzeiumocaaybh13f5w97bfzus4pcy")
 		assert.NoError(t, err)
 		assert.NotEmpty(t, previousDID)
 
@@ -392,6 +489,16 @@ func TestDIDDHTFeatures(t *testing.T) {
 		println(previousDID.Signature)
 	})
 
+	t.Run("prev with signer for another key", func(t *testing.T) {
+		_, previousDoc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		otherPrivKey, _, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		_, err = CreatePreviousDIDRecord(signer.NewInMemorySigner(otherPrivKey), DHT(previousDoc.ID), "did:dht:sr6jgmcc84xig18ix66qbiwnzeiumocaaybh13f5w97bfzus4pcy")
+		assert.ErrorContains(t, err, "signer is not for the previous DID's identity key")
+	})
+
 	t.Run("Test Previous DID", func(t *testing.T) {
 		// generate previous DID
 		previousPrivKey, previousDoc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
@@ -407,7 +514,7 @@ func TestDIDDHTFeatures(t *testing.T) {
 		// set previous DID signature
 		previousDIDDHT := DHT(previousDoc.ID)
 		currentDIDDHT := DHT(doc.ID)
-		previousDID, err := CreatePreviousDIDRecord(previousPrivKey, previousDIDDHT, currentDIDDHT)
+		previousDID, err := CreatePreviousDIDRecord(signer.NewInMemorySigner(previousPrivKey), previousDIDDHT, currentDIDDHT)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, previousDID)
 		assert.NotEmpty(t, previousDID.PreviousDID)
@@ -593,3 +700,47 @@ func TestCreationFailures(t *testing.T) {
 	})
 
 }
+
+func TestTypeIndex(t *testing.T) {
+	types := RegisteredTypes()
+	assert.Len(t, types, 8)
+	assert.Equal(t, Discoverable, types[0])
+	assert.Equal(t, FinancialInstitution, types[len(types)-1])
+
+	description, ok := FinancialInstitution.Description()
+	assert.True(t, ok)
+	assert.Equal(t, "Financial Institution", description)
+
+	_, ok = TypeIndex(8).Description()
+	assert.False(t, ok)
+}
+
+func TestAuthoritativeGateway(t *testing.T) {
+	gateway := AuthoritativeGateway("gateway1.example-did-dht-gateway.com.")
+	assert.Equal(t, "gateway1.example-did-dht-gateway.com", gateway.Host())
+	gatewayURL, err := gateway.URL()
+	require.NoError(t, err)
+	assert.Equal(t, "https://gateway1.example-did-dht-gateway.com", gatewayURL)
+	assert.True(t, gateway.IsGateway("gateway1.example-did-dht-gateway.com"))
+	assert.True(t, gateway.IsGateway("Gateway1.Example-DID-DHT-Gateway.com."))
+	assert.False(t, gateway.IsGateway("gateway2.example-did-dht-gateway.com"))
+	assert.False(t, gateway.IsGateway(""))
+
+	// only bare domain names are reached, over https
+	for _, g := range []AuthoritativeGateway{
+		"http://gateway1.example-did-dht-gateway.com",
+		"https://gateway1.example-did-dht-gateway.com",
+		"gateway1.example-did-dht-gateway.com:8305",
+		"gateway1.example-did-dht-gateway.com/did",
+		"user@gateway1.example-did-dht-gateway.com",
+		"localhost",
+		"127.0.0.1",
+		"10.0.0.1.",
+		"[::1]",
+		"::1",
+		"",
+	} {
+		_, err = g.URL()
+		assert.Error(t, err, g)
+	}
+}
@@ -2,6 +2,7 @@ package did
 
 import (
 	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/TBD54566975/ssi-sdk/cryptosuite"
 	"github.com/TBD54566975/ssi-sdk/did"
 	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -290,4 +292,127 @@ func TestVectors(t *testing.T) {
 		require.NoError(t, err)
 		assert.JSONEq(t, string(expectedDIDDocJSON), string(decodedDocJSON))
 	})
+
+	// decode the records of vector 2 as written in the spec, rather than as encoded by ToDNSPacket, to make sure
+	// packets produced by other implementations, with real NS records for gateways, are understood
+	t.Run("test vector 2 from spec dns records", func(t *testing.T) {
+		var expectedDNSRecords []testVectorDNSRecord
+		retrieveTestVectorAs(t, vector2DNSRecords, &expectedDNSRecords)
+
+		msg := new(dns.Msg)
+		for _, record := range expectedDNSRecords {
+			rdata := record.Record[0]
+			if record.RecordType == "TXT" {
+				rdata = strconv.Quote(rdata)
+			}
+			rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", record.Name, record.TTL, record.RecordType, rdata))
+			require.NoError(t, err)
+			msg.Answer = append(msg.Answer, rr)
+		}
+		packed, err := msg.Pack()
+		require.NoError(t, err)
+		unpacked := new(dns.Msg)
+		require.NoError(t, unpacked.Unpack(packed))
+
+		didDHTDoc, err := DHT("did:dht:cyuoqaf7itop8ohww4yn5ojg13qaq83r9zihgqntc5i9zwrfdfoo").FromDNSPacket(unpacked)
+		require.NoError(t, err)
+		assert.Equal(t, []TypeIndex{1, 2, 3}, didDHTDoc.Types)
+		assert.Equal(t, []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com.", "gateway2.example-did-dht-gateway.com."}, didDHTDoc.Gateways)
+
+		var expectedDIDDocument did.Document
+		retrieveTestVectorAs(t, vector2DIDDocument, &expectedDIDDocument)
+		expectedDIDDocJSON, err := json.Marshal(expectedDIDDocument)
+		require.NoError(t, err)
+		decodedDocJSON, err := json.Marshal(didDHTDoc.Doc)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(expectedDIDDocJSON), string(decodedDocJSON))
+	})
+}
+
+// TestKeyTypeVectors covers the key types of the Key Type Index beyond those of the spec's test vectors
+// https://did-dht.com/registry/#key-type-index
+func TestKeyTypeVectors(t *testing.T) {
+	type keyTypeVector struct {
+		KeyType      int              `json:"keyType"`
+		PublicKeyJWK jwx.PublicKeyJWK `json:"publicKeyJwk"`
+		Rdata        string           `json:"rdata"`
+	}
+	var vectors []keyTypeVector
+	retrieveTestVectorAs(t, vectorKeyTypes, &vectors)
+	require.NotEmpty(t, vectors)
+
+	var identityJWK jwx.PublicKeyJWK
+	retrieveTestVectorAs(t, vector1PublicKeyJWK1, &identityJWK)
+	identityKey, err := identityJWK.ToPublicKey()
+	require.NoError(t, err)
+
+	for _, vector := range vectors {
+		t.Run(fmt.Sprintf("test key type %d", vector.KeyType), func(t *testing.T) {
+			expectedJWK := vector.PublicKeyJWK
+			pubKeyJWK := vector.PublicKeyJWK
+			assert.Equal(t, vector.KeyType, keyTypeForJWK(pubKeyJWK))
+			assert.True(t, algIsDefaultForJWK(pubKeyJWK))
+
+			doc, err := CreateDIDDHTDID(identityKey.(ed25519.PublicKey), CreateDIDDHTOpts{
+				VerificationMethods: []VerificationMethod{
+					{
+						VerificationMethod: did.VerificationMethod{
+							ID:           pubKeyJWK.KID,
+							Type:         cryptosuite.JSONWebKeyType,
+							PublicKeyJWK: &pubKeyJWK,
+						},
+						Purposes: []did.PublicKeyPurpose{did.AssertionMethod},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			didID := DHT(doc.ID)
+			packet, err := didID.ToDNSPacket(*doc, nil, nil, nil)
+			require.NoError(t, err)
+			var keyRecord *dns.TXT
+			for _, rr := range packet.Answer {
+				if rr.Header().Name == "_k1._did." {
+					keyRecord = rr.(*dns.TXT)
+				}
+			}
+			require.NotNil(t, keyRecord)
+			assert.Equal(t, vector.Rdata, unchunkTextRecord(keyRecord.Txt))
+
+			// the key decodes to the same JWK, including from a packed packet
+			packed, err := packet.Pack()
+			require.NoError(t, err)
+			msg := new(dns.Msg)
+			require.NoError(t, msg.Unpack(packed))
+			didDHTDoc, err := didID.FromDNSPacket(msg)
+			require.NoError(t, err)
+			require.Len(t, didDHTDoc.Doc.VerificationMethod, 2)
+			vm := didDHTDoc.Doc.VerificationMethod[1]
+			assert.Equal(t, doc.ID+"#"+expectedJWK.KID, vm.ID)
+			assert.Equal(t, expectedJWK, *vm.PublicKeyJWK)
+			assert.Equal(t, []did.VerificationMethodSet{doc.ID + "#0", vm.ID}, didDHTDoc.Doc.AssertionMethod)
+		})
+	}
+
+	t.Run("test invalid keys", func(t *testing.T) {
+		for _, vector := range vectors[1:] {
+			keyBytes, err := base64.RawURLEncoding.DecodeString(vector.PublicKeyJWK.X)
+			require.NoError(t, err)
+
+			_, _, err = publicKeyJWKForBytes(keyBytes[1:], keyTypeLookUp(strconv.Itoa(vector.KeyType)))
+			assert.Error(t, err)
+
+			truncated := vector.PublicKeyJWK
+			truncated.X = base64.RawURLEncoding.EncodeToString(keyBytes[1:])
+			_, err = publicKeyBytesForJWK(&truncated)
+			assert.Error(t, err)
+		}
+
+		// a point that is not on the curve
+		notOnCurve := make([]byte, 96)
+		notOnCurve[0] = 0x80
+		notOnCurve[95] = 0x01
+		_, _, err = publicKeyJWKForBytes(notOnCurve, keyTypeLookUp("6"))
+		assert.Error(t, err)
+	})
 }
@@ -0,0 +1,176 @@
+package did
+
+import (
+	"crypto/ed25519"
+	"slices"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/jwk"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// ed25519DIDKeyPrefix is the prefix of did:key DIDs for Ed25519 keys, the only did:key DIDs interoperable with did:dht
+// https://did-dht.com/registry/#did-key
+const ed25519DIDKeyPrefix = key.Prefix + ":z6Mk"
+
+// IsInteroperable returns true if the DID is of a method interoperable with did:dht, and may have data published
+// to Mainline https://did-dht.com/registry/#interoperable-did-methods
+func IsInteroperable(id string) bool {
+	return strings.HasPrefix(id, key.Prefix+":") || strings.HasPrefix(id, jwk.Prefix+":")
+}
+
+// InteroperableIdentityKey returns the Ed25519 key of a did:key or did:jwk DID, which is the Mainline key the DID's
+// records are published under
+func InteroperableIdentityKey(id string) (ed25519.PublicKey, error) {
+	switch {
+	case strings.HasPrefix(id, key.Prefix+":"):
+		if !strings.HasPrefix(id, ed25519DIDKeyPrefix) {
+			return nil, errors.Errorf("did:key %s is not for an Ed25519 key", id)
+		}
+		pubKey, keyType, err := key.DIDKey(id).Decode()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode did:key")
+		}
+		if keyType != crypto.Ed25519 || len(pubKey) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("did:key %s is not for an Ed25519 key", id)
+		}
+		return pubKey, nil
+	case strings.HasPrefix(id, jwk.Prefix+":"):
+		doc, err := jwk.JWK(id).Expand()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to expand did:jwk")
+		}
+		pubKeyJWK := doc.VerificationMethod[0].PublicKeyJWK
+		if pubKeyJWK.KTY != jwa.OKP.String() || pubKeyJWK.CRV != crypto.Ed25519.String() {
+			return nil, errors.Errorf("did:jwk %s is not for an Ed25519 key", id)
+		}
+		pubKey, err := pubKeyJWK.ToPublicKey()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert did:jwk key")
+		}
+		return pubKey.(ed25519.PublicKey), nil
+	default:
+		return nil, errors.Errorf("did %s is not of a method interoperable with did:dht", id)
+	}
+}
+
+// InteroperableDHT returns the did:dht DID whose identifier is the Mainline key of a did:key or did:jwk DID
+func InteroperableDHT(id string) (DHT, error) {
+	pubKey, err := InteroperableIdentityKey(id)
+	if err != nil {
+		return "", err
+	}
+	return DHT(GetDIDDHTIdentifier(pubKey)), nil
+}
+
+// CreateInteroperableDNSPacket creates the DNS packet publishing additional data for a did:key or did:jwk DID
+// https://did-dht.com/registry/#did-key. The packet holds a DID DHT Document for the DID's key with the given
+// options, and is signed with the DID's private key, like a did:dht DID's packet.
+func CreateInteroperableDNSPacket(id string, opts CreateDIDDHTOpts, types []TypeIndex, gateways []AuthoritativeGateway) (*dns.Msg, error) {
+	pubKey, err := InteroperableIdentityKey(id)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := CreateDIDDHTDID(pubKey, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create did document")
+	}
+	return DHT(doc.ID).ToDNSPacket(*doc, types, gateways, nil)
+}
+
+// MergeInteroperableDocument returns the DID Document of a did:key or did:jwk DID: the document of the DID's own
+// method, amended with the verification methods, services, controller and aliases of the DID DHT Document published
+// for it, which are re-identified under the DID. The published document's identity key is the DID's own key, which
+// the method's document already holds. If no document is published, or it is deactivated, the method's document is
+// returned as is.
+func MergeInteroperableDocument(id string, published *DIDDHTDocument) (*DIDDHTDocument, error) {
+	doc, err := expandInteroperable(id)
+	if err != nil {
+		return nil, err
+	}
+	merged := DIDDHTDocument{Doc: *doc}
+	if published == nil || published.Deactivated {
+		return &merged, nil
+	}
+
+	dhtID, err := InteroperableDHT(id)
+	if err != nil {
+		return nil, err
+	}
+	if published.Doc.ID != dhtID.String() {
+		return nil, errors.Errorf("published document %s is not for %s", published.Doc.ID, dhtID)
+	}
+	identityKeyID := published.Doc.ID + "#0"
+	reidentify := func(s string) string {
+		if s == published.Doc.ID {
+			return id
+		}
+		if strings.HasPrefix(s, published.Doc.ID+"#") {
+			return id + strings.TrimPrefix(s, published.Doc.ID)
+		}
+		return s
+	}
+
+	if published.Doc.Controller != nil {
+		merged.Doc.Controller = published.Doc.Controller
+	}
+	if published.Doc.AlsoKnownAs != nil {
+		merged.Doc.AlsoKnownAs = published.Doc.AlsoKnownAs
+	}
+	for _, vm := range published.Doc.VerificationMethod {
+		if vm.ID == identityKeyID {
+			continue
+		}
+		vm.ID = reidentify(vm.ID)
+		vm.Controller = reidentify(vm.Controller)
+		merged.Doc.VerificationMethod = append(merged.Doc.VerificationMethod, vm)
+	}
+	mergeRelationship := func(own []did.VerificationMethodSet, published []did.VerificationMethodSet) []did.VerificationMethodSet {
+		// the method's relationships may share a backing array
+		own = slices.Clip(own)
+		for _, vm := range published {
+			if vmID, ok := vm.(string); ok && vmID != identityKeyID {
+				own = append(own, reidentify(vmID))
+			}
+		}
+		return own
+	}
+	merged.Doc.Authentication = mergeRelationship(merged.Doc.Authentication, published.Doc.Authentication)
+	merged.Doc.AssertionMethod = mergeRelationship(merged.Doc.AssertionMethod, published.Doc.AssertionMethod)
+	merged.Doc.KeyAgreement = mergeRelationship(merged.Doc.KeyAgreement, published.Doc.KeyAgreement)
+	merged.Doc.CapabilityInvocation = mergeRelationship(merged.Doc.CapabilityInvocation, published.Doc.CapabilityInvocation)
+	merged.Doc.CapabilityDelegation = mergeRelationship(merged.Doc.CapabilityDelegation, published.Doc.CapabilityDelegation)
+	for _, service := range published.Doc.Services {
+		service.ID = reidentify(service.ID)
+		merged.Doc.Services = append(merged.Doc.Services, service)
+	}
+
+	merged.Types = published.Types
+	merged.Gateways = published.Gateways
+	return &merged, nil
+}
+
+// expandInteroperable returns the document of a did:key or did:jwk DID as defined by its own method, with its key as
+// a JWK
+func expandInteroperable(id string) (*did.Document, error) {
+	if _, err := InteroperableIdentityKey(id); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(id, key.Prefix+":") {
+		doc, err := key.DIDKey(id).Expand(key.PublicKeyFormatJSONWebKey2020)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to expand did:key")
+		}
+		return doc, nil
+	}
+	doc, err := jwk.JWK(id).Expand()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to expand did:jwk")
+	}
+	return doc, nil
+}
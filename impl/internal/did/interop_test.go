@@ -0,0 +1,172 @@
+package did
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/jwk"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+func TestInteroperableDIDs(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	didKey, err := key.CreateDIDKey(crypto.Ed25519, pubKey)
+	require.NoError(t, err)
+	pubKeyJWK, err := jwx.PublicKeyToPublicKeyJWK(nil, pubKey)
+	require.NoError(t, err)
+	didJWK, err := jwk.CreateDIDJWK(*pubKeyJWK)
+	require.NoError(t, err)
+
+	t.Run("test interoperable identity key", func(t *testing.T) {
+		for _, id := range []string{didKey.String(), didJWK.String()} {
+			assert.True(t, IsInteroperable(id))
+			identityKey, err := InteroperableIdentityKey(id)
+			require.NoError(t, err)
+			assert.Equal(t, pubKey, identityKey)
+			dhtID, err := InteroperableDHT(id)
+			require.NoError(t, err)
+			assert.Equal(t, DHT(GetDIDDHTIdentifier(pubKey)), dhtID)
+		}
+
+		// only ed25519 keys are interoperable
+		_, secpDIDKey, err := key.GenerateDIDKey(crypto.SECP256k1)
+		require.NoError(t, err)
+		_, err = InteroperableIdentityKey(secpDIDKey.String())
+		assert.ErrorContains(t, err, "is not for an Ed25519 key")
+
+		_, p256DIDJWK, err := jwk.GenerateDIDJWK(crypto.P256)
+		require.NoError(t, err)
+		_, err = InteroperableIdentityKey(p256DIDJWK.String())
+		assert.ErrorContains(t, err, "is not for an Ed25519 key")
+
+		assert.False(t, IsInteroperable(GetDIDDHTIdentifier(pubKey)))
+		_, err = InteroperableIdentityKey("did:web:example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("test publish and resolve did:key", func(t *testing.T) {
+		gateway := newTestGatewayServer(t)
+		client, err := NewGatewayClient(gateway.URL)
+		require.NoError(t, err)
+
+		// nothing is published yet, so the did:key document is resolved as is
+		resolved, err := client.GetInteroperableDIDDocument(didKey.String())
+		require.NoError(t, err)
+		expanded, err := didKey.Expand(key.PublicKeyFormatJSONWebKey2020)
+		require.NoError(t, err)
+		assert.Equal(t, *expanded, resolved.Doc)
+
+		packet, err := CreateInteroperableDNSPacket(didKey.String(), CreateDIDDHTOpts{
+			AlsoKnownAs: []string{"did:example:efgh"},
+			VerificationMethods: []VerificationMethod{{
+				VerificationMethod: did.VerificationMethod{
+					ID:           "key-1",
+					Type:         cryptosuite.JSONWebKeyType,
+					PublicKeyJWK: newTestJWK(t),
+				},
+				Purposes: []did.PublicKeyPurpose{did.AssertionMethod, did.KeyAgreement},
+			}},
+			Services: []did.Service{{ID: "service-1", Type: "TestService", ServiceEndpoint: []string{"https://test-service.com/1"}}},
+		}, []TypeIndex{Organization}, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		put := bep44.Put{V: packed, Seq: 1}
+		require.NoError(t, signer.SignPut(signer.NewInMemorySigner(privKey), &put))
+		require.NoError(t, client.Publish(context.Background(), put))
+
+		resolved, err = client.GetInteroperableDIDDocument(didKey.String())
+		require.NoError(t, err)
+		id := didKey.String()
+		assert.Equal(t, id, resolved.Doc.ID)
+		assert.Equal(t, []string{"did:example:efgh"}, resolved.Doc.AlsoKnownAs)
+		// the published identity key is the did:key's own key, so only key-1 is added
+		require.Len(t, resolved.Doc.VerificationMethod, len(expanded.VerificationMethod)+1)
+		assert.Equal(t, expanded.VerificationMethod, resolved.Doc.VerificationMethod[:len(expanded.VerificationMethod)])
+		vm := resolved.Doc.VerificationMethod[len(expanded.VerificationMethod)]
+		assert.Equal(t, id+"#key-1", vm.ID)
+		assert.Equal(t, id, vm.Controller)
+		assert.Equal(t, expanded.Authentication, resolved.Doc.Authentication)
+		assert.Equal(t, append(expanded.AssertionMethod, id+"#key-1"), resolved.Doc.AssertionMethod)
+		assert.Equal(t, append(expanded.KeyAgreement, id+"#key-1"), resolved.Doc.KeyAgreement)
+		require.Len(t, resolved.Doc.Services, 1)
+		assert.Equal(t, id+"#service-1", resolved.Doc.Services[0].ID)
+		assert.Equal(t, []TypeIndex{Organization}, resolved.Types)
+	})
+
+	t.Run("test merge did:jwk", func(t *testing.T) {
+		doc, err := CreateDIDDHTDID(pubKey, CreateDIDDHTOpts{
+			Controller: []string{"did:example:abcd"},
+			Services:   []did.Service{{ID: "service-1", Type: "TestService", ServiceEndpoint: []string{"https://test-service.com/1"}}},
+		})
+		require.NoError(t, err)
+
+		merged, err := MergeInteroperableDocument(didJWK.String(), &DIDDHTDocument{Doc: *doc})
+		require.NoError(t, err)
+		id := didJWK.String()
+		assert.Equal(t, id, merged.Doc.ID)
+		assert.Equal(t, doc.Controller, merged.Doc.Controller)
+		require.Len(t, merged.Doc.VerificationMethod, 1)
+		assert.Equal(t, id+"#0", merged.Doc.VerificationMethod[0].ID)
+		assert.Equal(t, []did.VerificationMethodSet{id + "#0"}, merged.Doc.AssertionMethod)
+		require.Len(t, merged.Doc.Services, 1)
+		assert.Equal(t, id+"#service-1", merged.Doc.Services[0].ID)
+
+		// a deactivated document withdraws the published data
+		merged, err = MergeInteroperableDocument(id, &DIDDHTDocument{Doc: did.Document{ID: doc.ID}, Deactivated: true})
+		require.NoError(t, err)
+		assert.Empty(t, merged.Doc.Services)
+		assert.Nil(t, merged.Doc.Controller)
+
+		// a document published for another key is rejected
+		_, otherDoc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		_, err = MergeInteroperableDocument(id, &DIDDHTDocument{Doc: *otherDoc})
+		assert.ErrorContains(t, err, "is not for")
+	})
+}
+
+// newTestGatewayServer returns a did:dht Gateway that stores the sig:seq:v bodies put to it in memory
+func newTestGatewayServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	records := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		suffix := strings.TrimPrefix(r.URL.Path, "/")
+		switch r.Method {
+		case http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			records[suffix] = body
+		case http.MethodGet:
+			body, ok := records[suffix]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(body)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
@@ -0,0 +1,91 @@
+package did
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// MaxLineageLength is the most DIDs a chain of rotations is followed through before it is rejected
+const MaxLineageLength = 32
+
+// DocumentFetcher returns the DID DHT Document of a did:dht DID, or nil if no record is found for it
+type DocumentFetcher func(ctx context.Context, id DHT) (*DIDDHTDocument, error)
+
+// LineageOpts are the options for verifying the lineage of a DID
+type LineageOpts struct {
+	// RequireController requires the document of each previous DID to name its successor as a controller
+	// https://did-dht.com/#rotation, which a previous DID with no record, or a deactivated one, cannot do
+	RequireController bool
+}
+
+// LineageLink is a DID in a verified chain of rotations
+type LineageLink struct {
+	// DID is the DID the link is for
+	DID DHT `json:"did"`
+	// Resolved is set when a record was found for the DID. The first DID of a chain may have no record left, as the
+	// link to it is verified by its successor's previous DID record alone.
+	Resolved bool `json:"resolved"`
+	// Deactivated is set when the DID has been deactivated
+	Deactivated bool `json:"deactivated,omitempty"`
+	// ControllerConfirmed is set when the DID's document names the DID it rotated to as a controller
+	ControllerConfirmed bool `json:"controllerConfirmed,omitempty"`
+}
+
+// LineageError is returned when a chain of rotations cannot be verified, naming the DID it fails at
+type LineageError struct {
+	DID    DHT
+	Reason string
+}
+
+func (e *LineageError) Error() string {
+	return fmt.Sprintf("lineage of %s cannot be verified: %s", e.DID, e.Reason)
+}
+
+// VerifyLineage follows the previous DID records of a DID back through the DIDs it was rotated from
+// https://did-dht.com/#rotation, fetching each DID's document with the given fetcher. Each previous DID's signature
+// over its successor's identity key is verified, and a chain that repeats a DID, or is longer than
+// MaxLineageLength, is rejected with a *LineageError. The chain is returned starting at the given DID.
+func VerifyLineage(ctx context.Context, id DHT, fetch DocumentFetcher, opts LineageOpts) ([]LineageLink, error) {
+	doc, err := fetch(ctx, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", id)
+	}
+	if doc == nil {
+		return nil, ErrDIDNotFound
+	}
+
+	lineage := []LineageLink{{DID: id, Resolved: true, Deactivated: doc.Deactivated}}
+	seen := map[DHT]bool{id: true}
+	current := id
+	for doc != nil && doc.PreviousDID != nil {
+		previous := *doc.PreviousDID
+		if err = ValidatePreviousDIDSignatureValid(current, previous); err != nil {
+			return nil, &LineageError{DID: current, Reason: err.Error()}
+		}
+		if seen[previous.PreviousDID] {
+			return nil, &LineageError{DID: current, Reason: fmt.Sprintf("previous did %s repeats in the chain", previous.PreviousDID)}
+		}
+		if len(lineage) == MaxLineageLength {
+			return nil, &LineageError{DID: id, Reason: fmt.Sprintf("chain is longer than %d dids", MaxLineageLength)}
+		}
+		seen[previous.PreviousDID] = true
+
+		if doc, err = fetch(ctx, previous.PreviousDID); err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch %s", previous.PreviousDID)
+		}
+		link := LineageLink{DID: previous.PreviousDID, Resolved: doc != nil}
+		if doc != nil {
+			link.Deactivated = doc.Deactivated
+			link.ControllerConfirmed = slices.Contains(stringOrStrings(doc.Doc.Controller), current.String())
+		}
+		if opts.RequireController && !link.ControllerConfirmed {
+			return nil, &LineageError{DID: link.DID, Reason: fmt.Sprintf("its document does not name %s as a controller", current)}
+		}
+		lineage = append(lineage, link)
+		current = previous.PreviousDID
+	}
+	return lineage, nil
+}
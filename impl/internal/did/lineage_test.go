@@ -0,0 +1,119 @@
+package did
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+func TestVerifyLineage(t *testing.T) {
+	// generate three DIDs, the second rotated from the first and the third from the second
+	var keys []ed25519.PrivateKey
+	var docs []*DIDDHTDocument
+	for i := 0; i < 3; i++ {
+		sk, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		keys = append(keys, sk)
+		docs = append(docs, &DIDDHTDocument{Doc: *doc})
+	}
+	for i := 1; i < 3; i++ {
+		previousDID, err := CreatePreviousDIDRecord(signer.NewInMemorySigner(keys[i-1]), DHT(docs[i-1].Doc.ID), DHT(docs[i].Doc.ID))
+		require.NoError(t, err)
+		docs[i].PreviousDID = previousDID
+	}
+	fetcher := func(docs ...*DIDDHTDocument) DocumentFetcher {
+		return func(_ context.Context, id DHT) (*DIDDHTDocument, error) {
+			for _, doc := range docs {
+				if doc.Doc.ID == id.String() {
+					return doc, nil
+				}
+			}
+			return nil, nil
+		}
+	}
+	ids := func(lineage []LineageLink) []DHT {
+		var result []DHT
+		for _, link := range lineage {
+			result = append(result, link.DID)
+		}
+		return result
+	}
+
+	t.Run("test verify lineage", func(t *testing.T) {
+		lineage, err := VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(docs...), LineageOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, []DHT{DHT(docs[2].Doc.ID), DHT(docs[1].Doc.ID), DHT(docs[0].Doc.ID)}, ids(lineage))
+		for _, link := range lineage {
+			assert.True(t, link.Resolved)
+			assert.False(t, link.ControllerConfirmed)
+		}
+
+		// the first DID's record is not needed to verify the link to it
+		lineage, err = VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(docs[1], docs[2]), LineageOpts{})
+		require.NoError(t, err)
+		require.Len(t, lineage, 3)
+		assert.False(t, lineage[2].Resolved)
+
+		// a DID that was not rotated is its own lineage
+		lineage, err = VerifyLineage(context.Background(), DHT(docs[0].Doc.ID), fetcher(docs...), LineageOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, []DHT{DHT(docs[0].Doc.ID)}, ids(lineage))
+
+		_, err = VerifyLineage(context.Background(), DHT(docs[0].Doc.ID), fetcher(), LineageOpts{})
+		assert.ErrorIs(t, err, ErrDIDNotFound)
+	})
+
+	t.Run("test require controller", func(t *testing.T) {
+		_, err := VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(docs...), LineageOpts{RequireController: true})
+		var lineageErr *LineageError
+		require.True(t, errors.As(err, &lineageErr))
+		assert.Equal(t, DHT(docs[1].Doc.ID), lineageErr.DID)
+
+		// the old documents name their successors as controllers
+		first, second := *docs[0], *docs[1]
+		first.Doc.Controller = []string{docs[1].Doc.ID}
+		second.Doc.Controller = docs[2].Doc.ID
+		lineage, err := VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(&first, &second, docs[2]), LineageOpts{RequireController: true})
+		require.NoError(t, err)
+		require.Len(t, lineage, 3)
+		assert.True(t, lineage[1].ControllerConfirmed)
+		assert.True(t, lineage[2].ControllerConfirmed)
+
+		// a deactivated DID cannot confirm its successor
+		deactivated := &DIDDHTDocument{Doc: first.Doc, Deactivated: true}
+		deactivated.Doc.Controller = nil
+		_, err = VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(deactivated, &second, docs[2]), LineageOpts{RequireController: true})
+		require.True(t, errors.As(err, &lineageErr))
+		assert.Equal(t, DHT(docs[0].Doc.ID), lineageErr.DID)
+	})
+
+	t.Run("test invalid signature", func(t *testing.T) {
+		forged := *docs[2]
+		forged.PreviousDID = &PreviousDID{PreviousDID: DHT(docs[0].Doc.ID), Signature: docs[1].PreviousDID.Signature}
+
+		_, err := VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(docs[0], docs[1], &forged), LineageOpts{})
+		var lineageErr *LineageError
+		require.True(t, errors.As(err, &lineageErr))
+		assert.Equal(t, DHT(docs[2].Doc.ID), lineageErr.DID)
+		assert.Contains(t, err.Error(), "signature is invalid")
+	})
+
+	t.Run("test cycle", func(t *testing.T) {
+		// the first DID claims to have been rotated from the third
+		previousDID, err := CreatePreviousDIDRecord(signer.NewInMemorySigner(keys[2]), DHT(docs[2].Doc.ID), DHT(docs[0].Doc.ID))
+		require.NoError(t, err)
+		first := *docs[0]
+		first.PreviousDID = previousDID
+
+		_, err = VerifyLineage(context.Background(), DHT(docs[2].Doc.ID), fetcher(&first, docs[1], docs[2]), LineageOpts{})
+		var lineageErr *LineageError
+		require.True(t, errors.As(err, &lineageErr))
+		assert.Contains(t, err.Error(), "repeats in the chain")
+	})
+}
@@ -0,0 +1,194 @@
+package did
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// Severity is how serious a lint finding is
+type Severity string
+
+const (
+	// SeverityError is a finding that will stop the DID from being published or resolved as intended
+	SeverityError Severity = "error"
+	// SeverityWarning is a finding that is allowed, but likely a mistake
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is a finding that departs from the recommendations of the spec
+	SeverityInfo Severity = "info"
+)
+
+// LintRule identifies the check that produced a lint finding
+type LintRule string
+
+const (
+	ValidDocumentRule   LintRule = "valid-document"
+	KeyAgreementRule    LintRule = "key-agreement"
+	HTTPSEndpointRule   LintRule = "https-endpoint"
+	RegisteredTypeRule  LintRule = "registered-type"
+	RecordTTLRule       LintRule = "record-ttl"
+	PacketSizeRule      LintRule = "packet-size"
+	ControllerIsDIDRule LintRule = "controller-is-did"
+)
+
+// recommendedTTL is the TTL in seconds the spec recommends for every record of a DID's DNS packet
+// https://did-dht.com/#dids-as-dns-records
+const recommendedTTL = 7200
+
+// packetSizeWarning is the size in bytes past which a DNS packet has little room left under MaxPacketSize
+const packetSizeWarning = MaxPacketSize * 9 / 10
+
+// didPattern matches the DID syntax https://www.w3.org/TR/did-core/#did-syntax
+var didPattern = regexp.MustCompile(`^did:[a-z0-9]+:[A-Za-z0-9._:%-]*[A-Za-z0-9._%-]$`)
+
+// LintFinding is an advisory finding about a DID DHT Document
+type LintFinding struct {
+	// Rule is the check that produced the finding
+	Rule LintRule `json:"rule"`
+	// Severity is how serious the finding is: error, warning, or info
+	Severity Severity `json:"severity"`
+	// Message describes the finding
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s [%s] %s", f.Severity, f.Rule, f.Message)
+}
+
+// LintDocument returns the advisory findings for a DID DHT Document, including the size of the compact DNS packet it
+// would be published as. Problems ValidateDocument finds are reported as errors. A deactivated document has no
+// findings.
+func LintDocument(doc DIDDHTDocument) ([]LintFinding, error) {
+	if doc.Deactivated {
+		return nil, nil
+	}
+	findings := lintDocument(doc)
+
+	size, err := DHT(doc.Doc.ID).EstimatePacketSize(doc.Doc, doc.Types, doc.Gateways, doc.PreviousDID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to estimate dns packet size")
+	}
+	if finding := lintPacketSize(size.Total); finding != nil {
+		findings = append(findings, *finding)
+	}
+	return findings, nil
+}
+
+// LintDNSPacket returns the advisory findings for a DID's DNS packet: those for its records' TTLs and its packed
+// size, and those LintDocument returns for the document it encodes. A packet that ValidateDNSPacket rejects is
+// reported with an error for each problem.
+func (d DHT) LintDNSPacket(msg *dns.Msg) ([]LintFinding, error) {
+	var findings []LintFinding
+	for _, rr := range msg.Answer {
+		if ttl := rr.Header().Ttl; ttl != recommendedTTL {
+			findings = append(findings, LintFinding{
+				Rule:     RecordTTLRule,
+				Severity: SeverityInfo,
+				Message:  fmt.Sprintf("record %s has a TTL of %d, not %d", rr.Header().Name, ttl, recommendedTTL),
+			})
+		}
+	}
+	if finding := lintPacketSize(msg.Len()); finding != nil {
+		findings = append(findings, *finding)
+	}
+
+	doc, err := d.ValidateDNSPacket(msg)
+	if err != nil {
+		var invalidErr *InvalidDocumentError
+		if !errors.As(err, &invalidErr) {
+			return nil, err
+		}
+		return append(findings, invalidDocumentFindings(invalidErr)...), nil
+	}
+	if doc.Deactivated {
+		return findings, nil
+	}
+	return append(findings, lintDocument(*doc)...), nil
+}
+
+// lintDocument returns the findings for a DID DHT Document that do not depend on its DNS packet
+func lintDocument(doc DIDDHTDocument) []LintFinding {
+	var findings []LintFinding
+	if err := ValidateDocument(doc); err != nil {
+		var invalidErr *InvalidDocumentError
+		if errors.As(err, &invalidErr) {
+			findings = append(findings, invalidDocumentFindings(invalidErr)...)
+		}
+	}
+
+	if len(doc.Doc.KeyAgreement) == 0 {
+		findings = append(findings, LintFinding{
+			Rule:     KeyAgreementRule,
+			Severity: SeverityWarning,
+			Message:  "no keyAgreement key, so the DID cannot receive encrypted messages",
+		})
+	}
+
+	// service endpoints may also be DIDs https://www.w3.org/TR/did-core/#services
+	for _, service := range doc.Doc.Services {
+		for _, endpoint := range stringOrStrings(service.ServiceEndpoint) {
+			u, err := url.Parse(endpoint)
+			if err == nil && (u.Scheme == "https" || u.Scheme == "did") {
+				continue
+			}
+			findings = append(findings, LintFinding{
+				Rule:     HTTPSEndpointRule,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("service %s has an endpoint that is not an https url: %s", service.ID, endpoint),
+			})
+		}
+	}
+
+	for _, t := range doc.Types {
+		if _, ok := t.Description(); !ok {
+			findings = append(findings, LintFinding{
+				Rule:     RegisteredTypeRule,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("type %d is not in the Indexed Types registry", t),
+			})
+		}
+	}
+
+	for _, controller := range stringOrStrings(doc.Doc.Controller) {
+		if !didPattern.MatchString(controller) {
+			findings = append(findings, LintFinding{
+				Rule:     ControllerIsDIDRule,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("controller %s is not a DID", controller),
+			})
+		}
+	}
+	return findings
+}
+
+// lintPacketSize returns a finding for a DNS packet of the given size that is over, or close to, MaxPacketSize
+func lintPacketSize(size int) *LintFinding {
+	switch {
+	case size > MaxPacketSize:
+		return &LintFinding{
+			Rule:     PacketSizeRule,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("dns packet is %d bytes, over the %d byte limit", size, MaxPacketSize),
+		}
+	case size > packetSizeWarning:
+		return &LintFinding{
+			Rule:     PacketSizeRule,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("dns packet is %d bytes, close to the %d byte limit", size, MaxPacketSize),
+		}
+	default:
+		return nil
+	}
+}
+
+// invalidDocumentFindings returns an error finding for each problem of an invalid document
+func invalidDocumentFindings(err *InvalidDocumentError) []LintFinding {
+	findings := make([]LintFinding, 0, len(err.Problems))
+	for _, problem := range err.Problems {
+		findings = append(findings, LintFinding{Rule: ValidDocumentRule, Severity: SeverityError, Message: problem})
+	}
+	return findings
+}
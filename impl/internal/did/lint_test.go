@@ -0,0 +1,135 @@
+package did
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	newDocument := func(t *testing.T, opts CreateDIDDHTOpts) DIDDHTDocument {
+		_, doc, err := GenerateDIDDHT(opts)
+		require.NoError(t, err)
+		return DIDDHTDocument{Doc: *doc}
+	}
+	rules := func(findings []LintFinding) map[LintRule]Severity {
+		result := make(map[LintRule]Severity)
+		for _, f := range findings {
+			result[f.Rule] = f.Severity
+		}
+		return result
+	}
+
+	t.Run("test no findings", func(t *testing.T) {
+		doc := newDocument(t, CreateDIDDHTOpts{
+			Controller: []string{"did:example:abcd"},
+			VerificationMethods: []VerificationMethod{{
+				VerificationMethod: did.VerificationMethod{
+					ID:           "key-1",
+					Type:         cryptosuite.JSONWebKeyType,
+					PublicKeyJWK: newTestJWK(t),
+				},
+				Purposes: []did.PublicKeyPurpose{did.KeyAgreement},
+			}},
+			Services: []did.Service{{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"https://example.com/vc/"}}},
+		})
+		doc.Types = []TypeIndex{Organization}
+
+		findings, err := LintDocument(doc)
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+
+		packet, err := DHT(doc.Doc.ID).ToDNSPacket(doc.Doc, doc.Types, nil, nil)
+		require.NoError(t, err)
+		findings, err = DHT(doc.Doc.ID).LintDNSPacket(packet)
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+	})
+
+	t.Run("test document findings", func(t *testing.T) {
+		doc := newDocument(t, CreateDIDDHTOpts{
+			Controller: []string{"example.com"},
+			Services: []did.Service{
+				{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"http://example.com/vc/"}},
+				{ID: "hub", Type: "MessagingService", ServiceEndpoint: "did:example:efgh"},
+			},
+		})
+		doc.Types = []TypeIndex{Organization, TypeIndex(1000)}
+
+		findings, err := LintDocument(doc)
+		require.NoError(t, err)
+		assert.Equal(t, []LintFinding{
+			{Rule: KeyAgreementRule, Severity: SeverityWarning, Message: "no keyAgreement key, so the DID cannot receive encrypted messages"},
+			{Rule: HTTPSEndpointRule, Severity: SeverityWarning, Message: "service " + doc.Doc.ID + "#vcs has an endpoint that is not an https url: http://example.com/vc/"},
+			{Rule: RegisteredTypeRule, Severity: SeverityWarning, Message: "type 1000 is not in the Indexed Types registry"},
+			{Rule: ControllerIsDIDRule, Severity: SeverityWarning, Message: "controller example.com is not a DID"},
+		}, findings)
+
+		// invalid documents are reported as errors
+		doc.Doc.AssertionMethod = append(doc.Doc.AssertionMethod, doc.Doc.ID+"#missing")
+		findings, err = LintDocument(doc)
+		require.NoError(t, err)
+		assert.Contains(t, findings, LintFinding{
+			Rule:     ValidDocumentRule,
+			Severity: SeverityError,
+			Message:  "assertionMethod references missing verification method " + doc.Doc.ID + "#missing",
+		})
+
+		findings, err = LintDocument(DIDDHTDocument{Doc: did.Document{ID: doc.Doc.ID}, Deactivated: true})
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+	})
+
+	t.Run("test packet size", func(t *testing.T) {
+		doc := newDocument(t, CreateDIDDHTOpts{})
+		d := DHT(doc.Doc.ID)
+
+		// add services until the packet is close to the limit
+		for i := 0; ; i++ {
+			size, err := d.EstimatePacketSize(doc.Doc, nil, nil, nil)
+			require.NoError(t, err)
+			if size.Total > MaxPacketSize*9/10 {
+				require.LessOrEqual(t, size.Total, MaxPacketSize)
+				break
+			}
+			doc.Doc.Services = append(doc.Doc.Services, did.Service{
+				ID:              fmt.Sprintf("#service-%d", i),
+				Type:            "TestService",
+				ServiceEndpoint: []string{"https://example.com/" + strings.Repeat("a", 10)},
+			})
+		}
+		findings, err := LintDocument(doc)
+		require.NoError(t, err)
+		assert.Equal(t, SeverityWarning, rules(findings)[PacketSizeRule])
+
+		doc.Doc.Services = append(doc.Doc.Services, doc.Doc.Services...)
+		findings, err = LintDocument(doc)
+		require.NoError(t, err)
+		assert.Equal(t, SeverityError, rules(findings)[PacketSizeRule])
+	})
+
+	t.Run("test packet findings", func(t *testing.T) {
+		doc := newDocument(t, CreateDIDDHTOpts{})
+		d := DHT(doc.Doc.ID)
+		packet, err := d.ToDNSPacket(doc.Doc, nil, nil, nil)
+		require.NoError(t, err)
+		packet.Answer[0].Header().Ttl = 300
+
+		findings, err := d.LintDNSPacket(packet)
+		require.NoError(t, err)
+		assert.Equal(t, map[LintRule]Severity{RecordTTLRule: SeverityInfo, KeyAgreementRule: SeverityWarning}, rules(findings))
+		assert.Contains(t, findings[0].Message, "has a TTL of 300, not 7200")
+
+		// a packet that is not a valid document is reported as errors
+		packet.Answer = []dns.RR{packet.Answer[1]}
+		findings, err = d.LintDNSPacket(packet)
+		require.NoError(t, err)
+		assert.Equal(t, SeverityError, rules(findings)[ValidDocumentRule])
+	})
+}
@@ -0,0 +1,381 @@
+package did
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+// Publisher publishes signed BEP44 put messages, such as a GatewayClient or a Mainline DHT
+type Publisher interface {
+	Publish(ctx context.Context, put bep44.Put) error
+}
+
+var (
+	// ErrNotCreated is returned when a Manager is asked to update a DID it has not created
+	ErrNotCreated = errors.New("did has not been created")
+	// ErrAlreadyCreated is returned when a Manager is asked to create a DID after it has created one
+	ErrAlreadyCreated = errors.New("did has already been created")
+	// ErrDeactivated is returned when a Manager is asked to update a DID it has deactivated
+	ErrDeactivated = errors.New("did has been deactivated")
+)
+
+// Manager manages the lifecycle of a did:dht DID https://did-dht.com/#operations: it owns the DID's identity key
+// through a signer, builds the DNS packet for each operation, signs it with a sequence number greater than the last
+// one it published, and publishes it. A Manager is safe for concurrent use; its state only changes once an operation
+// has been published.
+type Manager struct {
+	mu sync.Mutex
+
+	signer    signer.Signer
+	publisher Publisher
+
+	opts        CreateDIDDHTOpts
+	types       []TypeIndex
+	gateways    []AuthoritativeGateway
+	previousDID *PreviousDID
+
+	doc         *did.Document
+	seq         int64
+	deactivated bool
+}
+
+// NewManager returns a Manager for a DID that has not been created yet, with the given identity key signer
+func NewManager(s signer.Signer, publisher Publisher) (*Manager, error) {
+	if s == nil {
+		return nil, errors.New("signer cannot be nil")
+	}
+	if publisher == nil {
+		return nil, errors.New("publisher cannot be nil")
+	}
+	return &Manager{signer: s, publisher: publisher}, nil
+}
+
+// ResumeManager returns a Manager for a DID that has already been published, given its current DID DHT Document
+// and the sequence number it was last published with
+func ResumeManager(s signer.Signer, publisher Publisher, doc DIDDHTDocument, seq int64) (*Manager, error) {
+	m, err := NewManager(s, publisher)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Doc.ID != GetDIDDHTIdentifier(s.PublicKey()) {
+		return nil, errors.New("signer is not for the DID's identity key")
+	}
+	m.opts = optsFromDocument(doc.Doc)
+	m.types = doc.Types
+	m.gateways = doc.Gateways
+	m.previousDID = doc.PreviousDID
+	m.doc = &doc.Doc
+	m.seq = seq
+	m.deactivated = doc.Deactivated
+	return m, nil
+}
+
+// Document returns the DID Document last published by the Manager, or nil if none has been
+func (m *Manager) Document() *did.Document {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.doc
+}
+
+// SequenceNumber returns the sequence number of the packet last published by the Manager
+func (m *Manager) SequenceNumber() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seq
+}
+
+// Create creates and publishes a DID for the Manager's identity key, with the given types and authoritative gateways
+func (m *Manager) Create(ctx context.Context, opts CreateDIDDHTOpts, types []TypeIndex, gateways []AuthoritativeGateway) (*did.Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.doc != nil {
+		return nil, ErrAlreadyCreated
+	}
+	m.types = types
+	m.gateways = gateways
+	doc, err := m.update(ctx, cloneOpts(opts))
+	if err != nil {
+		m.types = nil
+		m.gateways = nil
+		return nil, err
+	}
+	return doc, nil
+}
+
+// AddVerificationMethod adds the verification method to the DID and publishes the updated DID Document
+func (m *Manager) AddVerificationMethod(ctx context.Context, vm VerificationMethod) (*did.Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUpdatable(); err != nil {
+		return nil, err
+	}
+	opts := cloneOpts(m.opts)
+	opts.VerificationMethods = append(opts.VerificationMethods, vm)
+	return m.update(ctx, opts)
+}
+
+// RemoveService removes the service with the given ID, with or without the DID and '#' prefix, from the DID and
+// publishes the updated DID Document
+func (m *Manager) RemoveService(ctx context.Context, id string) (*did.Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUpdatable(); err != nil {
+		return nil, err
+	}
+	id = unqualifiedID(m.doc.ID, id)
+	opts := cloneOpts(m.opts)
+	opts.Services = slices.DeleteFunc(opts.Services, func(s did.Service) bool { return s.ID == id })
+	if len(opts.Services) == len(m.opts.Services) {
+		return nil, errors.Errorf("service %s not found", id)
+	}
+	return m.update(ctx, opts)
+}
+
+// RotateOpts are the options for rotating a DID to a new identity key
+type RotateOpts struct {
+	// SetController publishes a final update of the current DID, signed by the current identity key, naming the new
+	// DID as a controller, so the rotation is confirmed by both DIDs https://did-dht.com/#rotation
+	SetController bool
+}
+
+// Rotate moves the DID to a new identity key https://did-dht.com/#rotation. The DID Document is published as a new
+// DID for the new key, linked to the current DID by a previous DID record signed by the current identity key, and
+// the Manager continues with the new DID. The current DID is left as it is unless the options set its controller.
+func (m *Manager) Rotate(ctx context.Context, newSigner signer.Signer, rotateOpts RotateOpts) (*did.Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUpdatable(); err != nil {
+		return nil, err
+	}
+	if newSigner == nil {
+		return nil, errors.New("signer cannot be nil")
+	}
+
+	opts := cloneOpts(m.opts)
+	doc, err := CreateDIDDHTDID(newSigner.PublicKey(), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create rotated did")
+	}
+	previousDID, err := CreatePreviousDIDRecord(m.signer, DHT(m.doc.ID), DHT(doc.ID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create previous did record")
+	}
+	packet, err := DHT(doc.ID).ToCompactDNSPacket(*doc, m.types, m.gateways, previousDID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create dns packet")
+	}
+
+	// the current DID names its successor before the new DID is published, so a failed rotation can be retried
+	if rotateOpts.SetController {
+		if err = m.setController(ctx, doc.ID); err != nil {
+			return nil, err
+		}
+	}
+	seq, err := m.publish(ctx, newSigner, packet)
+	if err != nil {
+		return nil, err
+	}
+
+	m.signer = newSigner
+	m.previousDID = previousDID
+	m.doc = doc
+	m.seq = seq
+	return doc, nil
+}
+
+// setController publishes an update of the current DID naming the given DID as a controller, without changing the
+// Manager's state
+func (m *Manager) setController(ctx context.Context, controller string) error {
+	opts := cloneOpts(m.opts)
+	if !slices.Contains(opts.Controller, controller) {
+		opts.Controller = append(opts.Controller, controller)
+	}
+	doc, err := CreateDIDDHTDID(m.signer.PublicKey(), opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to create controlled did")
+	}
+	packet, err := DHT(doc.ID).ToCompactDNSPacket(*doc, m.types, m.gateways, m.previousDID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create dns packet")
+	}
+	_, err = m.publish(ctx, m.signer, packet)
+	return err
+}
+
+// Deactivate publishes the deactivation of the DID https://did-dht.com/#deactivate, after which the Manager
+// refuses further operations
+func (m *Manager) Deactivate(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUpdatable(); err != nil {
+		return err
+	}
+	packet, err := DHT(m.doc.ID).CreateDeactivatedPacket()
+	if err != nil {
+		return errors.Wrap(err, "failed to create deactivated dns packet")
+	}
+	seq, err := m.publish(ctx, m.signer, packet)
+	if err != nil {
+		return err
+	}
+	m.seq = seq
+	m.deactivated = true
+	return nil
+}
+
+// checkUpdatable returns an error if the Manager has no DID to update
+func (m *Manager) checkUpdatable() error {
+	if m.doc == nil {
+		return ErrNotCreated
+	}
+	if m.deactivated {
+		return ErrDeactivated
+	}
+	return nil
+}
+
+// update builds the DID Document for the given options, publishes it, and records it as the Manager's state
+func (m *Manager) update(ctx context.Context, opts CreateDIDDHTOpts) (*did.Document, error) {
+	// CreateDIDDHTDID qualifies the IDs of the options it is given, so the Manager keeps its own copy
+	doc, err := CreateDIDDHTDID(m.signer.PublicKey(), cloneOpts(opts))
+	if err != nil {
+		return nil, err
+	}
+	packet, err := DHT(doc.ID).ToCompactDNSPacket(*doc, m.types, m.gateways, m.previousDID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create dns packet")
+	}
+	seq, err := m.publish(ctx, m.signer, packet)
+	if err != nil {
+		return nil, err
+	}
+
+	m.opts = opts
+	m.doc = doc
+	m.seq = seq
+	return doc, nil
+}
+
+// publish signs the packet with the next sequence number and publishes it, returning the sequence number used
+func (m *Manager) publish(ctx context.Context, s signer.Signer, packet *dns.Msg) (int64, error) {
+	packed, err := packet.Pack()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to pack dns packet")
+	}
+	put := bep44.Put{V: packed, Seq: m.nextSeq()}
+	if err = signer.SignPut(s, &put); err != nil {
+		return 0, errors.Wrap(err, "failed to sign dns packet")
+	}
+	if err = m.publisher.Publish(ctx, put); err != nil {
+		return 0, errors.Wrap(err, "failed to publish dns packet")
+	}
+	return put.Seq, nil
+}
+
+// nextSeq returns the current Unix Timestamp in seconds, or one more than the last sequence number published if that
+// is not greater, so that each packet published supersedes the last
+func (m *Manager) nextSeq() int64 {
+	return max(time.Now().Unix(), m.seq+1)
+}
+
+// cloneOpts returns a copy of the options that CreateDIDDHTDID can modify without changing the original
+func cloneOpts(opts CreateDIDDHTOpts) CreateDIDDHTOpts {
+	clone := CreateDIDDHTOpts{
+		Controller:          slices.Clone(opts.Controller),
+		AlsoKnownAs:         slices.Clone(opts.AlsoKnownAs),
+		VerificationMethods: make([]VerificationMethod, 0, len(opts.VerificationMethods)),
+		Services:            slices.Clone(opts.Services),
+	}
+	for _, vm := range opts.VerificationMethods {
+		if vm.VerificationMethod.PublicKeyJWK != nil {
+			jwk := *vm.VerificationMethod.PublicKeyJWK
+			vm.VerificationMethod.PublicKeyJWK = &jwk
+		}
+		vm.Purposes = slices.Clone(vm.Purposes)
+		clone.VerificationMethods = append(clone.VerificationMethods, vm)
+	}
+	return clone
+}
+
+// optsFromDocument returns the options that CreateDIDDHTDID builds the DID Document from
+func optsFromDocument(doc did.Document) CreateDIDDHTOpts {
+	var opts CreateDIDDHTOpts
+	opts.Controller = stringOrStrings(doc.Controller)
+	opts.AlsoKnownAs = stringOrStrings(doc.AlsoKnownAs)
+
+	purposes := []struct {
+		purpose did.PublicKeyPurpose
+		set     []did.VerificationMethodSet
+	}{
+		{did.Authentication, doc.Authentication},
+		{did.AssertionMethod, doc.AssertionMethod},
+		{did.KeyAgreement, doc.KeyAgreement},
+		{did.CapabilityInvocation, doc.CapabilityInvocation},
+		{did.CapabilityDelegation, doc.CapabilityDelegation},
+	}
+	for _, vm := range doc.VerificationMethod {
+		if vm.ID == doc.ID+"#0" {
+			continue
+		}
+		var vmPurposes []did.PublicKeyPurpose
+		for _, p := range purposes {
+			if slices.Contains(p.set, did.VerificationMethodSet(vm.ID)) {
+				vmPurposes = append(vmPurposes, p.purpose)
+			}
+		}
+		vm.ID = unqualifiedID(doc.ID, vm.ID)
+		// the DID is the default controller, which must follow the DID through rotations
+		if vm.Controller == doc.ID {
+			vm.Controller = ""
+		}
+		opts.VerificationMethods = append(opts.VerificationMethods, VerificationMethod{
+			VerificationMethod: vm,
+			Purposes:           vmPurposes,
+		})
+	}
+	for _, s := range doc.Services {
+		s.ID = unqualifiedID(doc.ID, s.ID)
+		opts.Services = append(opts.Services, s)
+	}
+	return opts
+}
+
+// unqualifiedID returns the fragment of an ID given with or without the DID and '#' prefix
+func unqualifiedID(didID, id string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(id, didID), "#")
+}
+
+// stringOrStrings returns the values of a DID Document property that is either a string or a list of strings
+func stringOrStrings(v any) []string {
+	switch value := v.(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []any:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,257 @@
+package did
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+func TestManager(t *testing.T) {
+	t.Run("test lifecycle", func(t *testing.T) {
+		publisher := new(testPublisher)
+		m, err := NewManager(newTestSigner(t), publisher)
+		require.NoError(t, err)
+
+		_, err = m.AddVerificationMethod(context.Background(), VerificationMethod{})
+		assert.ErrorIs(t, err, ErrNotCreated)
+
+		// create
+		doc, err := m.Create(context.Background(), CreateDIDDHTOpts{
+			Services: []did.Service{
+				{ID: "service-1", Type: "TestService", ServiceEndpoint: []string{"https://test-service.com/1"}},
+				{ID: "service-2", Type: "TestService", ServiceEndpoint: []string{"https://test-service.com/2"}},
+			},
+		}, []TypeIndex{Organization}, []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."})
+		require.NoError(t, err)
+		require.Len(t, publisher.puts, 1)
+		published := publisher.decodeLast(t, doc.ID)
+		assert.Equal(t, *doc, published.Doc)
+		assert.Equal(t, []TypeIndex{Organization}, published.Types)
+		assert.Equal(t, []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}, published.Gateways)
+		assert.Equal(t, publisher.puts[0].Seq, m.SequenceNumber())
+
+		_, err = m.Create(context.Background(), CreateDIDDHTOpts{}, nil, nil)
+		assert.ErrorIs(t, err, ErrAlreadyCreated)
+
+		// add a verification method
+		doc, err = m.AddVerificationMethod(context.Background(), VerificationMethod{
+			VerificationMethod: did.VerificationMethod{
+				ID:           "key-1",
+				Type:         cryptosuite.JSONWebKeyType,
+				PublicKeyJWK: newTestJWK(t),
+			},
+			Purposes: []did.PublicKeyPurpose{did.KeyAgreement},
+		})
+		require.NoError(t, err)
+		require.Len(t, publisher.puts, 2)
+		published = publisher.decodeLast(t, doc.ID)
+		assert.Len(t, published.Doc.VerificationMethod, 2)
+		assert.Equal(t, []did.VerificationMethodSet{doc.ID + "#key-1"}, published.Doc.KeyAgreement)
+		assert.Len(t, published.Doc.Services, 2)
+
+		// remove a service
+		doc, err = m.RemoveService(context.Background(), "#service-1")
+		require.NoError(t, err)
+		published = publisher.decodeLast(t, doc.ID)
+		require.Len(t, published.Doc.Services, 1)
+		assert.Equal(t, doc.ID+"#service-2", published.Doc.Services[0].ID)
+		assert.Len(t, published.Doc.VerificationMethod, 2)
+
+		_, err = m.RemoveService(context.Background(), "service-1")
+		assert.ErrorContains(t, err, "service service-1 not found")
+
+		// each packet supersedes the last
+		for i := 1; i < len(publisher.puts); i++ {
+			assert.Greater(t, publisher.puts[i].Seq, publisher.puts[i-1].Seq)
+		}
+
+		// rotate
+		previousID := doc.ID
+		doc, err = m.Rotate(context.Background(), newTestSigner(t), RotateOpts{})
+		require.NoError(t, err)
+		assert.NotEqual(t, previousID, doc.ID)
+		previous, err := publisher.fetch(context.Background(), DHT(previousID))
+		require.NoError(t, err)
+		assert.Empty(t, previous.Doc.Controller)
+		published = publisher.decodeLast(t, doc.ID)
+		require.NotNil(t, published.PreviousDID)
+		assert.Equal(t, DHT(previousID), published.PreviousDID.PreviousDID)
+		assert.NoError(t, ValidatePreviousDIDSignatureValid(DHT(doc.ID), *published.PreviousDID))
+		assert.Len(t, published.Doc.VerificationMethod, 2)
+		assert.Equal(t, doc.ID, published.Doc.VerificationMethod[1].Controller)
+		assert.Equal(t, []TypeIndex{Organization}, published.Types)
+
+		// deactivate
+		require.NoError(t, m.Deactivate(context.Background()))
+		published = publisher.decodeLast(t, doc.ID)
+		assert.True(t, published.Deactivated)
+
+		_, err = m.RemoveService(context.Background(), "service-2")
+		assert.ErrorIs(t, err, ErrDeactivated)
+		assert.ErrorIs(t, m.Deactivate(context.Background()), ErrDeactivated)
+	})
+
+	t.Run("test rotate with controller", func(t *testing.T) {
+		publisher := new(testPublisher)
+		m, err := NewManager(newTestSigner(t), publisher)
+		require.NoError(t, err)
+		first, err := m.Create(context.Background(), CreateDIDDHTOpts{Controller: []string{"did:example:abcd"}}, nil, nil)
+		require.NoError(t, err)
+		second, err := m.Rotate(context.Background(), newTestSigner(t), RotateOpts{SetController: true})
+		require.NoError(t, err)
+		third, err := m.Rotate(context.Background(), newTestSigner(t), RotateOpts{SetController: true})
+		require.NoError(t, err)
+
+		// the final update of each previous DID names its successor alongside its own controllers
+		previous, err := publisher.fetch(context.Background(), DHT(first.ID))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"did:example:abcd", second.ID}, previous.Doc.Controller)
+		assert.Equal(t, "did:example:abcd", third.Controller)
+
+		lineage, err := VerifyLineage(context.Background(), DHT(third.ID), publisher.fetch, LineageOpts{RequireController: true})
+		require.NoError(t, err)
+		require.Len(t, lineage, 3)
+		assert.Equal(t, []DHT{DHT(third.ID), DHT(second.ID), DHT(first.ID)}, []DHT{lineage[0].DID, lineage[1].DID, lineage[2].DID})
+		assert.True(t, lineage[1].ControllerConfirmed)
+		assert.True(t, lineage[2].ControllerConfirmed)
+	})
+
+	t.Run("test failed publish leaves state unchanged", func(t *testing.T) {
+		publisher := new(testPublisher)
+		m, err := NewManager(newTestSigner(t), publisher)
+		require.NoError(t, err)
+		doc, err := m.Create(context.Background(), CreateDIDDHTOpts{
+			Services: []did.Service{{ID: "service-1", Type: "TestService", ServiceEndpoint: []string{"https://test-service.com/1"}}},
+		}, nil, nil)
+		require.NoError(t, err)
+		seq := m.SequenceNumber()
+
+		publisher.err = errors.New("gateway unavailable")
+		_, err = m.RemoveService(context.Background(), "service-1")
+		assert.ErrorContains(t, err, "gateway unavailable")
+		assert.Equal(t, doc, m.Document())
+		assert.Equal(t, seq, m.SequenceNumber())
+
+		publisher.err = nil
+		doc, err = m.RemoveService(context.Background(), "service-1")
+		require.NoError(t, err)
+		assert.Empty(t, doc.Services)
+	})
+
+	t.Run("test resume", func(t *testing.T) {
+		s := newTestSigner(t)
+		publisher := new(testPublisher)
+		m, err := NewManager(s, publisher)
+		require.NoError(t, err)
+		doc, err := m.Create(context.Background(), CreateDIDDHTOpts{
+			Controller: []string{"did:example:abcd"},
+			VerificationMethods: []VerificationMethod{{
+				VerificationMethod: did.VerificationMethod{
+					ID:           "key-1",
+					Type:         cryptosuite.JSONWebKeyType,
+					PublicKeyJWK: newTestJWK(t),
+				},
+				Purposes: []did.PublicKeyPurpose{did.AssertionMethod},
+			}},
+			Services: []did.Service{{ID: "service-1", Type: "TestService", ServiceEndpoint: []string{"https://test-service.com/1"}}},
+		}, nil, nil)
+		require.NoError(t, err)
+		published := publisher.decodeLast(t, doc.ID)
+
+		// the resumed manager only knows the DID from its published packet
+		_, err = ResumeManager(newTestSigner(t), publisher, *published, m.SequenceNumber())
+		assert.Error(t, err)
+		resumed, err := ResumeManager(s, publisher, *published, m.SequenceNumber())
+		require.NoError(t, err)
+
+		updated, err := resumed.RemoveService(context.Background(), doc.ID+"#service-1")
+		require.NoError(t, err)
+		assert.Greater(t, resumed.SequenceNumber(), m.SequenceNumber())
+		assert.Empty(t, updated.Services)
+		assert.Equal(t, doc.Controller, updated.Controller)
+		assert.Equal(t, doc.VerificationMethod, updated.VerificationMethod)
+		assert.Equal(t, doc.AssertionMethod, updated.AssertionMethod)
+	})
+
+	t.Run("test bad constructors", func(t *testing.T) {
+		_, err := NewManager(nil, new(testPublisher))
+		assert.Error(t, err)
+		_, err = NewManager(newTestSigner(t), nil)
+		assert.Error(t, err)
+	})
+}
+
+// testPublisher records the put messages it is given, verifying their signatures
+type testPublisher struct {
+	puts []bep44.Put
+	err  error
+}
+
+func (p *testPublisher) Publish(_ context.Context, put bep44.Put) error {
+	if p.err != nil {
+		return p.err
+	}
+	bv, err := bencode.Marshal(put.V)
+	if err != nil {
+		return err
+	}
+	if !bep44.Verify(put.K[:], put.Salt, put.Seq, bv, put.Sig[:]) {
+		return errors.New("invalid signature")
+	}
+	p.puts = append(p.puts, put)
+	return nil
+}
+
+// decodeLast decodes the DID DHT Document from the last put message published
+func (p *testPublisher) decodeLast(t *testing.T, id string) *DIDDHTDocument {
+	require.NotEmpty(t, p.puts)
+	put := p.puts[len(p.puts)-1]
+	assert.Equal(t, id, GetDIDDHTIdentifier(put.K[:]))
+
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(put.V.([]byte)))
+	doc, err := DHT(id).FromDNSPacket(msg)
+	require.NoError(t, err)
+	return doc
+}
+
+// fetch decodes the DID DHT Document from the last put message published for the DID, as a DocumentFetcher
+func (p *testPublisher) fetch(_ context.Context, id DHT) (*DIDDHTDocument, error) {
+	for i := len(p.puts) - 1; i >= 0; i-- {
+		if GetDIDDHTIdentifier(p.puts[i].K[:]) != id.String() {
+			continue
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(p.puts[i].V.([]byte)); err != nil {
+			return nil, err
+		}
+		return id.FromDNSPacket(msg)
+	}
+	return nil, nil
+}
+
+func newTestSigner(t *testing.T) signer.Signer {
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return signer.NewInMemorySigner(privateKey)
+}
+
+func newTestJWK(t *testing.T) *jwx.PublicKeyJWK {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	jwk, err := jwx.PublicKeyToPublicKeyJWK(nil, publicKey)
+	require.NoError(t, err)
+	return jwk
+}
@@ -0,0 +1,107 @@
+package did
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// UnpackDNSPacket unpacks the DNS packet of a DID. Gateways were previously published as NS records whose rdata holds
+// the gateway's domain name as TXT character-strings rather than as a domain name, which fails to unpack as an NS
+// record. Packets holding such records are unpacked record by record, recovering them as NS records.
+func UnpackDNSPacket(packed []byte) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	err := msg.Unpack(packed)
+	if err == nil {
+		return msg, nil
+	}
+	if legacy, legacyErr := unpackLegacyPacket(packed); legacyErr == nil {
+		return legacy, nil
+	}
+	return nil, err
+}
+
+// unpackLegacyPacket unpacks a packet record by record, recovering legacy gateway records
+func unpackLegacyPacket(packed []byte) (*dns.Msg, error) {
+	if len(packed) < dnsHeaderSize {
+		return nil, errors.New("packet is too short to hold a header")
+	}
+
+	// unpack the header alone by clearing its section counts
+	header := slices.Clone(packed[:dnsHeaderSize])
+	clear(header[4:])
+	msg := new(dns.Msg)
+	if err := msg.Unpack(header); err != nil {
+		return nil, err
+	}
+
+	off := dnsHeaderSize
+	for range binary.BigEndian.Uint16(packed[4:]) {
+		name, next, err := dns.UnpackDomainName(packed, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(packed) {
+			return nil, errors.New("question is truncated")
+		}
+		msg.Question = append(msg.Question, dns.Question{
+			Name:   name,
+			Qtype:  binary.BigEndian.Uint16(packed[next:]),
+			Qclass: binary.BigEndian.Uint16(packed[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for i, section := range []*[]dns.RR{&msg.Answer, &msg.Ns, &msg.Extra} {
+		for range binary.BigEndian.Uint16(packed[6+2*i:]) {
+			rr, next, err := unpackLegacyRR(packed, off)
+			if err != nil {
+				return nil, err
+			}
+			*section = append(*section, rr)
+			off = next
+		}
+	}
+	return msg, nil
+}
+
+// unpackLegacyRR unpacks the record at the given offset, recovering an NS record whose rdata holds TXT
+// character-strings naming a gateway
+func unpackLegacyRR(packed []byte, off int) (dns.RR, int, error) {
+	rr, next, err := dns.UnpackRR(packed, off)
+	if err == nil {
+		return rr, next, nil
+	}
+
+	name, rdata, nameErr := dns.UnpackDomainName(packed, off)
+	if nameErr != nil || rdata+10 > len(packed) {
+		return nil, len(packed), err
+	}
+	hdr := dns.RR_Header{
+		Name:     name,
+		Rrtype:   binary.BigEndian.Uint16(packed[rdata:]),
+		Class:    binary.BigEndian.Uint16(packed[rdata+2:]),
+		Ttl:      binary.BigEndian.Uint32(packed[rdata+4:]),
+		Rdlength: binary.BigEndian.Uint16(packed[rdata+8:]),
+	}
+	rdata += 10
+	end := rdata + int(hdr.Rdlength)
+	if hdr.Rrtype != dns.TypeNS || end > len(packed) {
+		return nil, len(packed), err
+	}
+
+	txtHdr := hdr
+	txtHdr.Rrtype = dns.TypeTXT
+	txt, next, txtErr := dns.UnpackRRWithHeader(txtHdr, packed[:end], rdata)
+	if txtErr != nil {
+		return nil, len(packed), err
+	}
+	gateway := strings.Join(txt.(*dns.TXT).Txt, "")
+	if _, ok := dns.IsDomainName(gateway); !ok || gateway == "" {
+		return nil, len(packed), err
+	}
+	return &dns.NS{Hdr: hdr, Ns: dns.Fqdn(gateway)}, next, nil
+}
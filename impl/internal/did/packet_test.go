@@ -0,0 +1,71 @@
+package did
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnpackDNSPacket(t *testing.T) {
+	legacyGateway := func(name, gateway string) dns.RR {
+		return &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 7200},
+			Txt: []string{gateway},
+		}
+	}
+
+	t.Run("test unpack packet", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		packet, err := DHT(doc.ID).ToDNSPacket(*doc, nil, []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+
+		unpacked, err := UnpackDNSPacket(packed)
+		require.NoError(t, err)
+		assert.Equal(t, packet.String(), unpacked.String())
+	})
+
+	t.Run("test unpack packet with legacy gateway records", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.Authoritative = true
+		msg.Answer = []dns.RR{
+			legacyGateway("_did.example.", "gateway1.example-did-dht-gateway.com"),
+			&dns.TXT{
+				Hdr: dns.RR_Header{Name: "_k0._did.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 7200},
+				Txt: []string{"id=0;t=0;k=key"},
+			},
+			legacyGateway("_did.example.", "gateway2.example-did-dht-gateway.com."),
+		}
+		packed, err := msg.Pack()
+		require.NoError(t, err)
+		assert.Error(t, new(dns.Msg).Unpack(packed))
+
+		unpacked, err := UnpackDNSPacket(packed)
+		require.NoError(t, err)
+		assert.True(t, unpacked.Authoritative)
+		require.Len(t, unpacked.Answer, 3)
+		assert.Equal(t, &dns.NS{
+			Hdr: dns.RR_Header{Name: "_did.example.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 7200, Rdlength: 37},
+			Ns:  "gateway1.example-did-dht-gateway.com.",
+		}, unpacked.Answer[0])
+		assert.Equal(t, []string{"id=0;t=0;k=key"}, unpacked.Answer[1].(*dns.TXT).Txt)
+		assert.Equal(t, "gateway2.example-did-dht-gateway.com.", unpacked.Answer[2].(*dns.NS).Ns)
+	})
+
+	t.Run("test unpack bad packets", func(t *testing.T) {
+		_, err := UnpackDNSPacket([]byte("not a dns packet"))
+		assert.Error(t, err)
+
+		// a legacy gateway record must still name a domain
+		msg := new(dns.Msg)
+		msg.Answer = []dns.RR{legacyGateway("_did.example.", "not a domain..")}
+		packed, err := msg.Pack()
+		require.NoError(t, err)
+		_, err = UnpackDNSPacket(packed)
+		assert.Error(t, err)
+	})
+}
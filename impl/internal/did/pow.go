@@ -4,9 +4,12 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"math/big"
 	"strconv"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 // computeSHA256Hash computes the SHA-256 hash of a string and returns it as a hexadecimal string.
@@ -30,8 +33,8 @@ func hasLeadingZeros(hash string, difficulty int) bool {
 	return strings.HasPrefix(binaryHash, target)
 }
 
-// solveRetentionChallenge generates the Retention Challenge Hash and checks if it meets the criteria.
-func solveRetentionChallenge(didIdentifier, inputHash string, difficulty, nonce int) (string, bool) {
+// SolveRetentionChallenge generates the Retention Challenge Hash and checks if it meets the criteria.
+func SolveRetentionChallenge(didIdentifier, inputHash string, difficulty, nonce int) (string, bool) {
 	// Concatenating the DID identifier with the retention value
 	retentionValue := didIdentifier + (inputHash + fmt.Sprintf("%d", nonce))
 
@@ -42,8 +45,19 @@ func solveRetentionChallenge(didIdentifier, inputHash string, difficulty, nonce
 	return hash, hasLeadingZeros(hash, difficulty)
 }
 
-// validateRetentionSolution validates the Retention Solution.
-func validateRetentionSolution(did, hash, retentionSolution string, difficulty int) bool {
+// FindRetentionSolution tries each nonce in turn until one solves the Retention Challenge, returning the Retention
+// Solution in the form accepted by ValidateRetentionSolution. The time taken doubles with each bit of difficulty.
+func FindRetentionSolution(didIdentifier, inputHash string, difficulty int) (string, error) {
+	for nonce := 0; nonce < math.MaxInt; nonce++ {
+		if hash, ok := SolveRetentionChallenge(didIdentifier, inputHash, difficulty, nonce); ok {
+			return fmt.Sprintf("%s:%d", hash, nonce), nil
+		}
+	}
+	return "", errors.New("no retention solution found")
+}
+
+// ValidateRetentionSolution validates the Retention Solution.
+func ValidateRetentionSolution(did, hash, retentionSolution string, difficulty int) bool {
 	parts := strings.Split(retentionSolution, ":")
 	if len(parts) != 2 {
 		return false
@@ -5,10 +5,13 @@ import (
 	"math"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPOW(t *testing.T) {
-	// Example usage of solveRetentionChallenge
+	// Example usage of SolveRetentionChallenge
 	didIdentifier := "did:dht:test"
 	inputHash := "000000000000000000022be0c55caae4152d023dd57e8d63dc1a55c1f6de46e7"
 
@@ -17,13 +20,13 @@ func TestPOW(t *testing.T) {
 
 	timer := time.Now()
 	for nonce := 0; nonce < math.MaxInt; nonce++ {
-		solution, isValid := solveRetentionChallenge(didIdentifier, inputHash, difficulty, nonce)
+		solution, isValid := SolveRetentionChallenge(didIdentifier, inputHash, difficulty, nonce)
 		if isValid {
 			fmt.Printf("Solution: %s\n", solution)
 			fmt.Printf("Valid Retention Solution: %v\n", isValid)
 			fmt.Printf("Nonce: %d\n", nonce)
 
-			isValidRetentionSolution := validateRetentionSolution(didIdentifier, inputHash, fmt.Sprintf("%s:%d", solution, nonce), difficulty)
+			isValidRetentionSolution := ValidateRetentionSolution(didIdentifier, inputHash, fmt.Sprintf("%s:%d", solution, nonce), difficulty)
 			fmt.Printf("Validated Solution: %v\n", isValidRetentionSolution)
 			break
 		}
@@ -31,3 +34,13 @@ func TestPOW(t *testing.T) {
 
 	fmt.Printf("Time taken: %s\n", time.Since(timer))
 }
+
+func TestFindRetentionSolution(t *testing.T) {
+	didIdentifier := "did:dht:test"
+	inputHash := "000000000000000000022be0c55caae4152d023dd57e8d63dc1a55c1f6de46e7"
+
+	solution, err := FindRetentionSolution(didIdentifier, inputHash, 8)
+	require.NoError(t, err)
+	assert.True(t, ValidateRetentionSolution(didIdentifier, inputHash, solution, 8))
+	assert.False(t, ValidateRetentionSolution(didIdentifier, inputHash+"0", solution, 8))
+}
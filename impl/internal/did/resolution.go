@@ -0,0 +1,60 @@
+package did
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+)
+
+// ResolutionResult is the result of resolving a did:dht DID, with the DID Document and DID Resolution metadata
+// described in https://did-dht.com/#did-resolution
+type ResolutionResult struct {
+	ResolutionMetadata ResolutionMetadata `json:"didResolutionMetadata"`
+	Document           did.Document       `json:"didDocument"`
+	DocumentMetadata   DocumentMetadata   `json:"didDocumentMetadata"`
+}
+
+// DocumentMetadata is the DID Document metadata of a resolved DID https://did-dht.com/#did-document-metadata
+type DocumentMetadata struct {
+	// VersionID is the sequence number of the resolved DID Document
+	VersionID string `json:"versionId,omitempty"`
+	// Created is the XML Datetime of the earliest known sequence number for the DID
+	Created string `json:"created,omitempty"`
+	// Updated is the XML Datetime of the latest known sequence number for the DID
+	Updated string `json:"updated,omitempty"`
+	// Deactivated is set when the DID has been deactivated
+	Deactivated bool `json:"deactivated,omitempty"`
+	// Types is the list of types the DID has indexed itself as
+	Types []TypeIndex `json:"types,omitempty"`
+	// Expiry is the Unix Timestamp in seconds at which the DID will be evicted from the gateway's Retained DID Set
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// ResolutionMetadata is the DID Resolution metadata of a resolved DID https://did-dht.com/#did-resolution-metadata
+type ResolutionMetadata struct {
+	// Gateway is the URI of the gateway the DID was resolved from
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// NewResolutionResult returns the resolution result for a DID DHT Document decoded from the packet with the given
+// sequence number, using the other sequence numbers known for the DID to determine when it was created and updated
+func NewResolutionResult(doc DIDDHTDocument, seq int64, knownSeqs []int64) ResolutionResult {
+	seqs := append([]int64{seq}, knownSeqs...)
+	return ResolutionResult{
+		Document: doc.Doc,
+		DocumentMetadata: DocumentMetadata{
+			VersionID:   strconv.FormatInt(seq, 10),
+			Created:     xmlDatetime(slices.Min(seqs)),
+			Updated:     xmlDatetime(slices.Max(seqs)),
+			Deactivated: doc.Deactivated,
+			Types:       doc.Types,
+		},
+	}
+}
+
+// xmlDatetime returns the XML Datetime representation of a sequence number, which is a Unix Timestamp in seconds
+func xmlDatetime(seq int64) string {
+	return time.Unix(seq, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,28 @@
+package did
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResolutionResult(t *testing.T) {
+	_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+	require.NoError(t, err)
+
+	didDHTDoc := DIDDHTDocument{Doc: *doc, Types: []TypeIndex{Organization}}
+	result := NewResolutionResult(didDHTDoc, 1700000100, []int64{1700000000, 1700000100, 1700000200})
+	assert.Equal(t, *doc, result.Document)
+	assert.Equal(t, "1700000100", result.DocumentMetadata.VersionID)
+	assert.Equal(t, "2023-11-14T22:13:20Z", result.DocumentMetadata.Created)
+	assert.Equal(t, "2023-11-14T22:16:40Z", result.DocumentMetadata.Updated)
+	assert.Equal(t, []TypeIndex{Organization}, result.DocumentMetadata.Types)
+	assert.False(t, result.DocumentMetadata.Deactivated)
+
+	// the resolved sequence number counts even if it is not yet known
+	result = NewResolutionResult(DIDDHTDocument{Doc: *doc, Deactivated: true}, 1700000300, nil)
+	assert.Equal(t, "2023-11-14T22:18:20Z", result.DocumentMetadata.Created)
+	assert.Equal(t, result.DocumentMetadata.Created, result.DocumentMetadata.Updated)
+	assert.True(t, result.DocumentMetadata.Deactivated)
+}
@@ -0,0 +1,178 @@
+package did
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/miekg/dns"
+)
+
+// MaxPacketSize is the maximum size in bytes of a packed DNS packet, which BEP44 caps as the 1000 byte value of a
+// mutable item https://did-dht.com/#dids-as-dns-records
+const MaxPacketSize = 1000
+
+// dnsHeaderSize is the size in bytes of a DNS message header
+const dnsHeaderSize = 12
+
+// PacketElement is the part of a DID DHT Document a DNS record encodes
+type PacketElement string
+
+const (
+	RootElement               PacketElement = "root"
+	PreviousDIDElement        PacketElement = "previousDid"
+	ControllerElement         PacketElement = "controller"
+	AlsoKnownAsElement        PacketElement = "alsoKnownAs"
+	GatewayElement            PacketElement = "gateway"
+	VerificationMethodElement PacketElement = "verificationMethod"
+	ServiceElement            PacketElement = "service"
+	TypesElement              PacketElement = "types"
+)
+
+// RecordCost is the number of bytes a DNS record adds to a packed DNS packet
+type RecordCost struct {
+	// Name is the name of the record, such as _k1._did.
+	Name string `json:"name"`
+	// Element is the part of the DID DHT Document the record encodes
+	Element PacketElement `json:"element"`
+	// ID identifies the verification method, service or gateway the record encodes, if any
+	ID   string `json:"id,omitempty"`
+	Size int    `json:"size"`
+}
+
+func (c RecordCost) String() string {
+	if c.ID != "" {
+		return fmt.Sprintf("%s %s (%d bytes)", c.Element, c.ID, c.Size)
+	}
+	return fmt.Sprintf("%s (%d bytes)", c.Element, c.Size)
+}
+
+// PacketSize is the size of a packed DNS packet, broken down by record. The record sizes and the header size add up
+// to the total; with name compression a record's size depends on the records before it.
+type PacketSize struct {
+	Total   int          `json:"total"`
+	Header  int          `json:"header"`
+	Records []RecordCost `json:"records"`
+}
+
+// PacketSizeError is returned when a DID DHT Document's DNS packet is larger than MaxPacketSize
+type PacketSizeError struct {
+	Size  int
+	Limit int
+	// OverBudget holds the largest records that can be removed from the DID DHT Document, at least one of which has
+	// to go, or be made smaller, for the packet to fit
+	OverBudget []RecordCost
+}
+
+func (e *PacketSizeError) Error() string {
+	elements := make([]string, 0, len(e.OverBudget))
+	for _, c := range e.OverBudget {
+		elements = append(elements, c.String())
+	}
+	return fmt.Sprintf("dns packet is %d bytes, %d over the %d byte limit: %s", e.Size, e.Size-e.Limit, e.Limit,
+		strings.Join(elements, ", "))
+}
+
+// EstimatePacketSize returns the size of the compact DNS packet for a DID DHT Document, and the cost of each of its
+// records, without checking it against MaxPacketSize
+func (d DHT) EstimatePacketSize(doc did.Document, types []TypeIndex, gateways []AuthoritativeGateway, previousDID *PreviousDID) (*PacketSize, error) {
+	msg, err := d.toDNSPacket(doc, types, gateways, previousDID, true)
+	if err != nil {
+		return nil, err
+	}
+	return measurePacket(doc, msg), nil
+}
+
+// ToCompactDNSPacket converts a DID DHT Document to the smallest DNS packet that encodes it, returning a
+// *PacketSizeError naming the records over budget if the packet is still larger than MaxPacketSize
+func (d DHT) ToCompactDNSPacket(doc did.Document, types []TypeIndex, gateways []AuthoritativeGateway, previousDID *PreviousDID) (*dns.Msg, error) {
+	msg, err := d.toDNSPacket(doc, types, gateways, previousDID, true)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Len() <= MaxPacketSize {
+		return msg, nil
+	}
+	size := measurePacket(doc, msg)
+	return nil, &PacketSizeError{
+		Size:       size.Total,
+		Limit:      MaxPacketSize,
+		OverBudget: overBudget(size, size.Total-MaxPacketSize),
+	}
+}
+
+// measurePacket returns the size of a DNS packet for the given DID DHT Document, charging each record the bytes it
+// adds to the packet after the records before it
+func measurePacket(doc did.Document, msg *dns.Msg) *PacketSize {
+	size := PacketSize{Header: dnsHeaderSize, Total: dnsHeaderSize}
+	partial := &dns.Msg{MsgHdr: msg.MsgHdr, Compress: msg.Compress}
+	for i, rr := range msg.Answer {
+		partial.Answer = msg.Answer[:i+1]
+		length := partial.Len()
+		element, id := describeRecord(doc, rr)
+		size.Records = append(size.Records, RecordCost{
+			Name:    rr.Header().Name,
+			Element: element,
+			ID:      id,
+			Size:    length - size.Total,
+		})
+		size.Total = length
+	}
+	return &size
+}
+
+// overBudget returns the largest removable records whose sizes add up to at least the given number of bytes. The
+// root record and the identity key are never removable.
+func overBudget(size *PacketSize, excess int) []RecordCost {
+	var removable []RecordCost
+	for _, c := range size.Records {
+		if c.Element == RootElement || (c.Element == VerificationMethodElement && strings.HasSuffix(c.ID, "#0")) {
+			continue
+		}
+		removable = append(removable, c)
+	}
+	slices.SortStableFunc(removable, func(a, b RecordCost) int { return cmp.Compare(b.Size, a.Size) })
+
+	var over []RecordCost
+	for _, c := range removable {
+		if excess <= 0 {
+			break
+		}
+		over = append(over, c)
+		excess -= c.Size
+	}
+	return over
+}
+
+// describeRecord returns the part of the DID DHT Document a record of its DNS packet encodes
+func describeRecord(doc did.Document, rr dns.RR) (PacketElement, string) {
+	if ns, ok := rr.(*dns.NS); ok {
+		return GatewayElement, ns.Ns
+	}
+	name := rr.Header().Name
+	switch {
+	case name == "_prv._did.":
+		return PreviousDIDElement, ""
+	case name == "_cnt._did.":
+		return ControllerElement, ""
+	case name == "_aka._did.":
+		return AlsoKnownAsElement, ""
+	case name == "_typ._did.":
+		return TypesElement, ""
+	case strings.HasPrefix(name, "_k"):
+		if i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "_k"), "._did.")); err == nil && i < len(doc.VerificationMethod) {
+			return VerificationMethodElement, doc.VerificationMethod[i].ID
+		}
+		return VerificationMethodElement, ""
+	case strings.HasPrefix(name, "_s"):
+		if i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "_s"), "._did.")); err == nil && i < len(doc.Services) {
+			return ServiceElement, doc.Services[i].ID
+		}
+		return ServiceElement, ""
+	default:
+		return RootElement, ""
+	}
+}
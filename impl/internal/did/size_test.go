@@ -0,0 +1,146 @@
+package did
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketSize(t *testing.T) {
+	t.Run("test estimate packet size", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{
+			Controller:  []string{"did:example:abcd"},
+			AlsoKnownAs: []string{"did:example:efgh"},
+			Services: []did.Service{
+				{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"https://example.com/vc/"}},
+			},
+		})
+		require.NoError(t, err)
+		gateways := []AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}
+
+		size, err := DHT(doc.ID).EstimatePacketSize(*doc, []TypeIndex{Organization}, gateways, nil)
+		require.NoError(t, err)
+
+		packet, err := DHT(doc.ID).ToCompactDNSPacket(*doc, []TypeIndex{Organization}, gateways, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		assert.Equal(t, len(packed), size.Total)
+
+		total := size.Header
+		elements := make(map[PacketElement]string)
+		for _, c := range size.Records {
+			assert.Positive(t, c.Size)
+			total += c.Size
+			elements[c.Element] = c.ID
+		}
+		assert.Equal(t, size.Total, total)
+		assert.Equal(t, map[PacketElement]string{
+			RootElement:               "",
+			ControllerElement:         "",
+			AlsoKnownAsElement:        "",
+			GatewayElement:            "gateway1.example-did-dht-gateway.com.",
+			VerificationMethodElement: doc.ID + "#0",
+			ServiceElement:            doc.ID + "#vcs",
+			TypesElement:              "",
+		}, elements)
+	})
+
+	t.Run("test compact packet", func(t *testing.T) {
+		pubKey, _, err := crypto.GenerateP256Key()
+		require.NoError(t, err)
+		jwk, err := jwx.PublicKeyToPublicKeyJWK(nil, pubKey)
+		require.NoError(t, err)
+
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{
+			VerificationMethods: []VerificationMethod{{
+				VerificationMethod: did.VerificationMethod{
+					ID:           "key-1",
+					Type:         cryptosuite.JSONWebKeyType,
+					PublicKeyJWK: jwk,
+				},
+				Purposes: []did.PublicKeyPurpose{did.AssertionMethod},
+			}},
+			Services: []did.Service{
+				{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"https://example.com/vc/"}},
+				{ID: "hub", Type: "MessagingService", ServiceEndpoint: []string{"https://example.com/hub/"}},
+			},
+		})
+		require.NoError(t, err)
+		doc.VerificationMethod[1].Controller = ""
+
+		packet, err := DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+
+		compactPacket, err := DHT(doc.ID).ToCompactDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		compactPacked, err := compactPacket.Pack()
+		require.NoError(t, err)
+		assert.Less(t, len(compactPacked), len(packed))
+		assert.Contains(t, packet.String(), ";c=")
+		assert.NotContains(t, compactPacket.String(), ";c=")
+		assert.NotContains(t, compactPacket.String(), ";a=")
+
+		// the compact packet decodes to the same document as the regular one
+		msg := new(dns.Msg)
+		require.NoError(t, msg.Unpack(packed))
+		decoded, err := DHT(doc.ID).FromDNSPacket(msg)
+		require.NoError(t, err)
+
+		compactMsg := new(dns.Msg)
+		require.NoError(t, compactMsg.Unpack(compactPacked))
+		compactDecoded, err := DHT(doc.ID).FromDNSPacket(compactMsg)
+		require.NoError(t, err)
+		assert.Equal(t, decoded.Doc, compactDecoded.Doc)
+		assert.Equal(t, doc.ID, compactDecoded.Doc.VerificationMethod[1].Controller)
+		assert.Equal(t, "ES256", compactDecoded.Doc.VerificationMethod[1].PublicKeyJWK.ALG)
+	})
+
+	t.Run("test packet over budget", func(t *testing.T) {
+		var services []did.Service
+		for i := 0; i < 6; i++ {
+			services = append(services, did.Service{
+				ID:              fmt.Sprintf("service-%d", i),
+				Type:            "TestService",
+				ServiceEndpoint: []string{"https://example.com/" + strings.Repeat("a", 20*(i+1))},
+			})
+		}
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{Services: services})
+		require.NoError(t, err)
+
+		_, err = DHT(doc.ID).ToCompactDNSPacket(*doc, nil, nil, nil)
+		require.Error(t, err)
+		var sizeErr *PacketSizeError
+		require.True(t, errors.As(err, &sizeErr))
+		assert.Equal(t, MaxPacketSize, sizeErr.Limit)
+		assert.Greater(t, sizeErr.Size, MaxPacketSize)
+
+		// the largest services are the ones over budget
+		require.NotEmpty(t, sizeErr.OverBudget)
+		assert.Equal(t, ServiceElement, sizeErr.OverBudget[0].Element)
+		assert.Equal(t, doc.ID+"#service-5", sizeErr.OverBudget[0].ID)
+		overBy := 0
+		for _, c := range sizeErr.OverBudget {
+			assert.Equal(t, ServiceElement, c.Element)
+			overBy += c.Size
+		}
+		assert.GreaterOrEqual(t, overBy, sizeErr.Size-MaxPacketSize)
+		assert.Contains(t, err.Error(), "service "+doc.ID+"#service-5")
+
+		// removing them brings the document within budget
+		doc.Services = doc.Services[:len(doc.Services)-len(sizeErr.OverBudget)]
+		_, err = DHT(doc.ID).ToCompactDNSPacket(*doc, nil, nil, nil)
+		assert.NoError(t, err)
+	})
+}
@@ -27,6 +27,8 @@ const (
 	vector3PublicKeyJWK2 string = "vector-3-public-key-jwk-2.json"
 	vector3DIDDocument   string = "vector-3-did-document.json"
 	vector3DNSRecords    string = "vector-3-dns-records.json"
+
+	vectorKeyTypes string = "vector-key-types.json"
 )
 
 func getTestData(fileName string) ([]byte, error) {
@@ -0,0 +1,139 @@
+package did
+
+import (
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// txtEscape is the character that escapes the next character of a text record's property value, so that a `;`, `,`
+// or `=` in the value is not taken as a separator https://did-dht.com/#services
+const txtEscape = '\\'
+
+// escapeTxtValue escapes the separators `;`, `,` and `=`, and the escape character itself, in a property value
+func escapeTxtValue(value string) string {
+	if !strings.ContainsAny(value, `\;,=`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case txtEscape, ';', ',', '=':
+			b.WriteByte(txtEscape)
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// unescapeTxtValue removes the escapes from a property value
+func unescapeTxtValue(value string) string {
+	if !strings.ContainsRune(value, txtEscape) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == txtEscape {
+			i++
+			if i == len(value) {
+				break
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// splitTxtValue splits a property value on the separators that are not escaped, leaving each part escaped
+func splitTxtValue(value string, separator byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case txtEscape:
+			i++
+		case separator:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// encodeServiceData encodes a service endpoint, or other service data, as a property value. A string, or a list of
+// strings, is comma-separated with each string escaped. Any other value, such as a map-shaped DIDComm endpoint, is
+// encoded as compact JSON, escaped. A string that starts with `{` or `[` has its first character escaped so that it
+// is not taken as JSON.
+func encodeServiceData(data any) (string, error) {
+	var values []string
+	switch d := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		values = []string{d}
+	case []string:
+		values = d
+	case []any:
+		for _, v := range d {
+			s, ok := v.(string)
+			if !ok {
+				return encodeStructuredServiceData(data)
+			}
+			values = append(values, s)
+		}
+	default:
+		return encodeStructuredServiceData(data)
+	}
+
+	encoded := make([]string, 0, len(values))
+	for _, v := range values {
+		escaped := escapeTxtValue(v)
+		if strings.HasPrefix(escaped, "{") || strings.HasPrefix(escaped, "[") {
+			escaped = string(txtEscape) + escaped
+		}
+		encoded = append(encoded, escaped)
+	}
+	return strings.Join(encoded, ","), nil
+}
+
+// encodeStructuredServiceData encodes service data that is not a string, or list of strings, as compact JSON
+func encodeStructuredServiceData(data any) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode structured service data")
+	}
+	return escapeTxtValue(string(encoded)), nil
+}
+
+// decodeServiceData decodes a property value encoded by encodeServiceData. JSON is decoded to the map or list it
+// encodes, and comma-separated strings to a list of strings.
+func decodeServiceData(value string) (any, error) {
+	if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		var data any
+		if err := json.Unmarshal([]byte(unescapeTxtValue(value)), &data); err != nil {
+			return nil, errors.Wrap(err, "failed to decode structured service data")
+		}
+		return data, nil
+	}
+
+	parts := splitTxtValue(value, ',')
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		values = append(values, unescapeTxtValue(part))
+	}
+	return values, nil
+}
+
+// decodeServiceProperty decodes a service property other than its endpoint, such as sig or enc, which is a single
+// string unless it lists several
+func decodeServiceProperty(value string) (any, error) {
+	data, err := decodeServiceData(value)
+	if err != nil {
+		return nil, err
+	}
+	if values, ok := data.([]string); ok && len(values) == 1 {
+		return values[0], nil
+	}
+	return data, nil
+}
@@ -0,0 +1,129 @@
+package did
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceData(t *testing.T) {
+	t.Run("test escaped values round trip", func(t *testing.T) {
+		roundTrip := func(a, b string) bool {
+			data := parseTxtData("a=" + escapeTxtValue(a) + ";b=" + escapeTxtValue(b))
+			return unescapeTxtValue(data["a"]) == a && unescapeTxtValue(data["b"]) == b
+		}
+		require.NoError(t, quick.Check(roundTrip, nil))
+	})
+
+	t.Run("test string endpoints round trip", func(t *testing.T) {
+		roundTrip := func(first string, rest []string) bool {
+			endpoints := append([]string{first}, rest...)
+			encoded, err := encodeServiceData(endpoints)
+			if err != nil {
+				return false
+			}
+			decoded, err := decodeServiceData(encoded)
+			return err == nil && assert.ObjectsAreEqual(endpoints, decoded)
+		}
+		require.NoError(t, quick.Check(roundTrip, nil))
+	})
+
+	t.Run("test services round trip through dns packets", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := DHT(doc.ID)
+
+		roundTrip := func(id, serviceType, endpoint, sig string) bool {
+			// ids are the fragment after the last '#'
+			if id == "" || strings.Contains(id, "#") || sig == "" {
+				return true
+			}
+			doc.Services = []did.Service{{
+				ID:              doc.ID + "#" + id,
+				Type:            serviceType,
+				ServiceEndpoint: []string{endpoint, "https://example.com/?a=1,2;b=3"},
+				Sig:             sig,
+			}}
+			decoded, err := packAndDecode(t, d, *doc)
+			return err == nil && assert.ObjectsAreEqual(doc.Services, decoded.Doc.Services)
+		}
+		require.NoError(t, quick.Check(roundTrip, nil))
+	})
+
+	t.Run("test structured endpoints", func(t *testing.T) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := DHT(doc.ID)
+
+		didComm := map[string]any{
+			"uri":         "https://example.com/didcomm;v=2",
+			"accept":      []any{"didcomm/v2", "didcomm/aip2;env=rfc587"},
+			"routingKeys": []any{"did:example:somemediator#somekey"},
+		}
+		doc.Services = []did.Service{
+			{ID: doc.ID + "#dcm", Type: "DIDCommMessaging", ServiceEndpoint: didComm},
+			{ID: doc.ID + "#dcms", Type: "DIDCommMessaging", ServiceEndpoint: []any{didComm, "https://example.com/fallback"}},
+			{ID: doc.ID + "#brace", Type: "TestService", ServiceEndpoint: []string{"{not json", "[also not json"}},
+			{ID: doc.ID + "#unicode", Type: "TestService", ServiceEndpoint: []string{`https://例え.jp/\path "quoted"`}},
+			{ID: doc.ID + "#sigs", Type: "TestService", ServiceEndpoint: []string{"https://example.com"}, Sig: []string{"1", "2"}, Enc: "3"},
+		}
+
+		packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		record := unchunkTextRecord(packet.Answer[1].(*dns.TXT).Txt)
+		assert.Equal(t, `id=dcm;t=DIDCommMessaging;se={"accept":["didcomm/v2"\,"didcomm/aip2\;env\=rfc587"]\,`+
+			`"routingKeys":["did:example:somemediator#somekey"]\,"uri":"https://example.com/didcomm\;v\=2"}`, record)
+
+		decoded, err := packAndDecode(t, d, *doc)
+		require.NoError(t, err)
+		assert.Equal(t, doc.Services, decoded.Doc.Services)
+
+		// records predating escaping, with an unescaped '=' in the endpoint, are still decoded
+		packet.Answer = append(packet.Answer[:1], &dns.TXT{
+			Hdr: dns.RR_Header{Name: "_s0._did.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 7200},
+			Txt: []string{"id=legacy;t=TestService;se=https://example.com/?a=1"},
+		})
+		legacy, err := d.FromDNSPacket(packet)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https://example.com/?a=1"}, legacy.Doc.Services[0].ServiceEndpoint)
+	})
+
+	t.Run("test long records", func(t *testing.T) {
+		record := ""
+		for len(record) < 600 {
+			record += `é\;`
+		}
+		chunks := chunkTextRecord(record)
+		require.Len(t, chunks, 3)
+		msg := &dns.Msg{Answer: []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: "_s0._did.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 7200},
+			Txt: chunks,
+		}}}
+		packed, err := msg.Pack()
+		require.NoError(t, err)
+		unpacked := new(dns.Msg)
+		require.NoError(t, unpacked.Unpack(packed))
+		assert.Equal(t, record, unchunkTextRecord(unpacked.Answer[0].(*dns.TXT).Txt))
+		assert.Equal(t, record, unchunkTextRecord(chunks))
+	})
+}
+
+// packAndDecode encodes a document as a DNS packet, packs and unpacks it, and decodes it again
+func packAndDecode(t *testing.T, d DHT, doc did.Document) (*DIDDHTDocument, error) {
+	packet, err := d.ToDNSPacket(doc, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := packet.Pack()
+	if err != nil {
+		return nil, err
+	}
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(packed))
+	return d.FromDNSPacket(msg)
+}
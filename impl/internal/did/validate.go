@@ -0,0 +1,192 @@
+package did
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/miekg/dns"
+)
+
+// rootRecordReferences are the properties of the root record that reference key records
+// https://did-dht.com/#root-record
+var rootRecordReferences = []string{"auth", "asm", "agm", "inv", "del"}
+
+// InvalidDocumentError is returned when a DNS packet does not encode a valid DID DHT Document, with each problem found
+type InvalidDocumentError struct {
+	Problems []string
+}
+
+func (e *InvalidDocumentError) Error() string {
+	return "invalid did document: " + strings.Join(e.Problems, "; ")
+}
+
+// ValidateDNSPacket decodes a DNS packet with FromDNSPacket, after checking that its root record is present and only
+// references records the packet holds, then checks the document with ValidateDocument. It returns an
+// *InvalidDocumentError listing every problem found.
+func (d DHT) ValidateDNSPacket(msg *dns.Msg) (*DIDDHTDocument, error) {
+	suffix, err := d.Suffix()
+	if err != nil {
+		return nil, &InvalidDocumentError{Problems: []string{err.Error()}}
+	}
+	rootName := fmt.Sprintf("_did.%s.", suffix)
+
+	var roots []string
+	records := make(map[string]bool)
+	for _, rr := range msg.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		if txt.Hdr.Name == rootName {
+			roots = append(roots, unchunkTextRecord(txt.Txt))
+			continue
+		}
+		records[strings.TrimSuffix(txt.Hdr.Name, "._did.")] = true
+	}
+	switch {
+	case len(roots) == 0:
+		return nil, &InvalidDocumentError{Problems: []string{"missing root record " + rootName}}
+	case len(roots) > 1:
+		return nil, &InvalidDocumentError{Problems: []string{"more than one root record " + rootName}}
+	}
+
+	var problems []string
+	if roots[0] != deactivatedRootRecord {
+		problems = validateRootRecord(roots[0], records)
+	}
+	if len(problems) > 0 {
+		return nil, &InvalidDocumentError{Problems: problems}
+	}
+
+	doc, err := d.FromDNSPacket(msg)
+	if err != nil {
+		return nil, &InvalidDocumentError{Problems: []string{err.Error()}}
+	}
+	if err = ValidateDocument(*doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// validateRootRecord checks the root record references only the key and service records the packet holds, in
+// its vm and svc properties, and only keys listed in its vm property in its verification relationships
+func validateRootRecord(rootRecord string, records map[string]bool) []string {
+	var problems []string
+	properties := parseTxtData(rootRecord)
+	if _, ok := properties["v"]; !ok {
+		problems = append(problems, "root record is missing its version")
+	}
+
+	var vms []string
+	if properties["vm"] != "" {
+		vms = strings.Split(properties["vm"], ",")
+	}
+	for _, vm := range vms {
+		if !strings.HasPrefix(vm, "k") || !records["_"+vm] {
+			problems = append(problems, fmt.Sprintf("root record vm references missing key record %s", vm))
+		}
+	}
+	for _, property := range rootRecordReferences {
+		if properties[property] == "" {
+			continue
+		}
+		for _, vm := range strings.Split(properties[property], ",") {
+			if !slices.Contains(vms, vm) {
+				problems = append(problems, fmt.Sprintf("root record %s references key %s, which is not in vm", property, vm))
+			}
+		}
+	}
+	for record := range records {
+		if strings.HasPrefix(record, "_k") && !slices.Contains(vms, strings.TrimPrefix(record, "_")) {
+			problems = append(problems, fmt.Sprintf("key record %s._did. is not in the root record's vm", record))
+		}
+	}
+	if properties["svc"] != "" {
+		for _, svc := range strings.Split(properties["svc"], ",") {
+			if !strings.HasPrefix(svc, "s") || !records["_"+svc] {
+				problems = append(problems, fmt.Sprintf("root record svc references missing service record %s", svc))
+			}
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
+
+// ValidateDocument checks a DID DHT Document is semantically valid: its identity key is present as its first
+// verification method, with the id #0, its verification method and service ids are unique, and its verification
+// relationships reference its verification methods. It returns an *InvalidDocumentError listing every problem found.
+func ValidateDocument(doc DIDDHTDocument) error {
+	if doc.Deactivated {
+		return nil
+	}
+	var problems []string
+
+	identityKey, err := DHT(doc.Doc.ID).IdentityKey()
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	identityKeyID := doc.Doc.ID + "#0"
+	vmIDs := make(map[string]bool)
+	for i, vm := range doc.Doc.VerificationMethod {
+		if vmIDs[vm.ID] {
+			problems = append(problems, fmt.Sprintf("verification method id %s is not unique", vm.ID))
+		}
+		vmIDs[vm.ID] = true
+
+		if vm.ID != identityKeyID {
+			continue
+		}
+		if i != 0 {
+			problems = append(problems, "identity key #0 is not the first verification method")
+		}
+		if vm.PublicKeyJWK == nil {
+			problems = append(problems, "identity key #0 has no public key")
+			continue
+		}
+		pubKey, err := vm.PublicKeyJWK.ToPublicKey()
+		if err != nil || identityKey == nil || !identityKey.Equal(pubKey) {
+			problems = append(problems, "verification method #0 is not the identity key")
+		}
+	}
+	if !vmIDs[identityKeyID] {
+		problems = append(problems, "missing identity key #0")
+	}
+
+	relationships := []struct {
+		name string
+		set  []did.VerificationMethodSet
+	}{
+		{"authentication", doc.Doc.Authentication},
+		{"assertionMethod", doc.Doc.AssertionMethod},
+		{"keyAgreement", doc.Doc.KeyAgreement},
+		{"capabilityInvocation", doc.Doc.CapabilityInvocation},
+		{"capabilityDelegation", doc.Doc.CapabilityDelegation},
+	}
+	for _, relationship := range relationships {
+		for _, vm := range relationship.set {
+			vmID, ok := vm.(string)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s holds an embedded verification method", relationship.name))
+				continue
+			}
+			if !vmIDs[vmID] {
+				problems = append(problems, fmt.Sprintf("%s references missing verification method %s", relationship.name, vmID))
+			}
+		}
+	}
+
+	serviceIDs := make(map[string]bool)
+	for _, service := range doc.Doc.Services {
+		if serviceIDs[service.ID] {
+			problems = append(problems, fmt.Sprintf("service id %s is not unique", service.ID))
+		}
+		serviceIDs[service.ID] = true
+	}
+
+	if len(problems) > 0 {
+		return &InvalidDocumentError{Problems: problems}
+	}
+	return nil
+}
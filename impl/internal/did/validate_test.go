@@ -0,0 +1,174 @@
+package did
+
+import (
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDNSPacket(t *testing.T) {
+	newPacket := func(t *testing.T) (DHT, *DIDDHTDocument, *dns.Msg) {
+		_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{
+			VerificationMethods: []VerificationMethod{{
+				VerificationMethod: did.VerificationMethod{
+					ID:           "key-1",
+					Type:         cryptosuite.JSONWebKeyType,
+					PublicKeyJWK: newTestJWK(t),
+				},
+				Purposes: []did.PublicKeyPurpose{did.AssertionMethod},
+			}},
+			Services: []did.Service{{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"https://example.com/vc/"}}},
+		})
+		require.NoError(t, err)
+		packet, err := DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		return DHT(doc.ID), &DIDDHTDocument{Doc: *doc}, packet
+	}
+	setRecord := func(packet *dns.Msg, name string, txt string) {
+		for _, rr := range packet.Answer {
+			if record, ok := rr.(*dns.TXT); ok && record.Hdr.Name == name {
+				record.Txt = []string{txt}
+			}
+		}
+	}
+	requireProblems := func(t *testing.T, err error) []string {
+		var invalidErr *InvalidDocumentError
+		require.True(t, errors.As(err, &invalidErr))
+		return invalidErr.Problems
+	}
+
+	t.Run("test valid packet", func(t *testing.T) {
+		d, doc, packet := newPacket(t)
+		decoded, err := d.ValidateDNSPacket(packet)
+		require.NoError(t, err)
+		assert.Equal(t, doc.Doc, decoded.Doc)
+	})
+
+	t.Run("test deactivated packet", func(t *testing.T) {
+		d, _, _ := newPacket(t)
+		packet, err := d.CreateDeactivatedPacket()
+		require.NoError(t, err)
+		decoded, err := d.ValidateDNSPacket(packet)
+		require.NoError(t, err)
+		assert.True(t, decoded.Deactivated)
+	})
+
+	t.Run("test missing root record", func(t *testing.T) {
+		d, _, packet := newPacket(t)
+		otherDID, _, _ := newPacket(t)
+		_, err := otherDID.ValidateDNSPacket(packet)
+		assert.Contains(t, requireProblems(t, err)[0], "missing root record")
+
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+		for _, rr := range packet.Answer {
+			if rr.Header().Name == "_did."+suffix+"." {
+				packet.Answer = append(packet.Answer, rr)
+				break
+			}
+		}
+		_, err = d.ValidateDNSPacket(packet)
+		assert.Equal(t, []string{"more than one root record _did." + suffix + "."}, requireProblems(t, err))
+	})
+
+	t.Run("test root record references", func(t *testing.T) {
+		d, _, packet := newPacket(t)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+		setRecord(packet, "_did."+suffix+".", "vm=k0,k2;auth=k0,k3;asm=k1;svc=s0,s1")
+
+		_, err = d.ValidateDNSPacket(packet)
+		assert.Equal(t, []string{
+			"key record _k1._did. is not in the root record's vm",
+			"root record asm references key k1, which is not in vm",
+			"root record auth references key k3, which is not in vm",
+			"root record is missing its version",
+			"root record svc references missing service record s1",
+			"root record vm references missing key record k2",
+		}, requireProblems(t, err))
+	})
+
+	t.Run("test undecodable packet", func(t *testing.T) {
+		d, _, packet := newPacket(t)
+		setRecord(packet, "_k1._did.", "id=key-1;t=9;k=abcd")
+
+		_, err := d.ValidateDNSPacket(packet)
+		require.Len(t, requireProblems(t, err), 1)
+	})
+
+	t.Run("test identity key is not #0", func(t *testing.T) {
+		d, doc, packet := newPacket(t)
+		setRecord(packet, "_k0._did.", "id=0;t=0;k="+keyRecordData(t, doc.Doc.VerificationMethod[1]))
+
+		_, err := d.ValidateDNSPacket(packet)
+		assert.Equal(t, []string{"verification method #0 is not the identity key"}, requireProblems(t, err))
+	})
+}
+
+func TestValidateDocument(t *testing.T) {
+	_, doc, err := GenerateDIDDHT(CreateDIDDHTOpts{
+		VerificationMethods: []VerificationMethod{{
+			VerificationMethod: did.VerificationMethod{
+				ID:           "key-1",
+				Type:         cryptosuite.JSONWebKeyType,
+				PublicKeyJWK: newTestJWK(t),
+			},
+			Purposes: []did.PublicKeyPurpose{did.AssertionMethod},
+		}},
+		Services: []did.Service{{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"https://example.com/vc/"}}},
+	})
+	require.NoError(t, err)
+	assert.NoError(t, ValidateDocument(DIDDHTDocument{Doc: *doc}))
+	assert.NoError(t, ValidateDocument(DIDDHTDocument{Doc: did.Document{ID: doc.ID}, Deactivated: true}))
+
+	t.Run("test duplicate ids", func(t *testing.T) {
+		invalid := *doc
+		invalid.VerificationMethod = append([]did.VerificationMethod{}, doc.VerificationMethod...)
+		invalid.VerificationMethod[1].ID = doc.ID + "#0"
+		invalid.Services = append(invalid.Services, doc.Services[0])
+
+		err := ValidateDocument(DIDDHTDocument{Doc: invalid})
+		var invalidErr *InvalidDocumentError
+		require.True(t, errors.As(err, &invalidErr))
+		assert.Contains(t, invalidErr.Problems, "verification method id "+doc.ID+"#0 is not unique")
+		assert.Contains(t, invalidErr.Problems, "verification method #0 is not the identity key")
+		assert.Contains(t, invalidErr.Problems, "assertionMethod references missing verification method "+doc.ID+"#key-1")
+		assert.Contains(t, invalidErr.Problems, "service id "+doc.ID+"#vcs is not unique")
+	})
+
+	t.Run("test missing identity key", func(t *testing.T) {
+		invalid := *doc
+		invalid.VerificationMethod = doc.VerificationMethod[1:]
+
+		err := ValidateDocument(DIDDHTDocument{Doc: invalid})
+		assert.ErrorContains(t, err, "missing identity key #0")
+		assert.ErrorContains(t, err, "authentication references missing verification method "+doc.ID+"#0")
+	})
+
+	t.Run("test embedded verification method", func(t *testing.T) {
+		invalid := *doc
+		invalid.KeyAgreement = []did.VerificationMethodSet{doc.VerificationMethod[1]}
+
+		err := ValidateDocument(DIDDHTDocument{Doc: invalid})
+		assert.EqualError(t, err, "invalid did document: keyAgreement holds an embedded verification method")
+	})
+}
+
+// keyRecordData returns the encoded public key of a verification method, as held in its key record
+func keyRecordData(t *testing.T, vm did.VerificationMethod) string {
+	id := GetDIDDHTIdentifier(make([]byte, 32))
+	packet, err := DHT(id).ToDNSPacket(did.Document{ID: id, VerificationMethod: []did.VerificationMethod{vm}}, nil, nil, nil)
+	require.NoError(t, err)
+	for _, rr := range packet.Answer {
+		if record, ok := rr.(*dns.TXT); ok && record.Hdr.Name == "_k0._did." {
+			return parseTxtData(unchunkTextRecord(record.Txt))["k"]
+		}
+	}
+	t.Fatal("no key record")
+	return ""
+}
@@ -19,7 +19,9 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
 
+	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/internal/util"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 	"github.com/TBD54566975/did-dht/pkg/telemetry"
 )
 
@@ -82,6 +84,17 @@ func NewTestDHT(t *testing.T, bootstrapPeers ...dht.Addr) *DHT {
 	return &DHT{Server: s}
 }
 
+// NewTestRecord returns a signed record for a newly generated DID
+func NewTestRecord(t *testing.T) BEP44Record {
+	sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+	require.NoError(t, err)
+	packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+	require.NoError(t, err)
+	putMsg, err := CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+	require.NoError(t, err)
+	return RecordFromBEP44(putMsg)
+}
+
 // Put puts the given BEP-44 value into the DHT and returns its z32-encoded key.
 func (d *DHT) Put(ctx context.Context, request bep44.Put) (string, error) {
 	ctx, span := telemetry.GetTracer().Start(ctx, "DHT.Put")
@@ -104,11 +117,17 @@ func (d *DHT) Put(ctx context.Context, request bep44.Put) (string, error) {
 	return util.Z32Encode(request.K[:]), nil
 }
 
+// Publish puts the given BEP-44 value into the DHT, without returning its key
+func (d *DHT) Publish(ctx context.Context, request bep44.Put) error {
+	_, err := d.Put(ctx, request)
+	return err
+}
+
 const successThreshold = 0.33
 
 func isPutSuccessful(key string, t *traversal.Stats, err error) error {
 	if err != nil {
-		return nil
+		return fmt.Errorf("failed to put key[%s] into dht: %w", key, err)
 	}
 	if t == nil {
 		return fmt.Errorf("failed to put key[%s] into dht: %v", key, err)
@@ -1,7 +1,6 @@
 package dht
 
 import (
-	"crypto/ed25519"
 	"time"
 
 	"github.com/TBD54566975/ssi-sdk/util"
@@ -9,9 +8,12 @@ import (
 	"github.com/anacrolix/dht/v2/exts/getput"
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/miekg/dns"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
-// CreateDNSPublishRequest creates a put request for the given records. Requires a public/private keypair and
+// CreateDNSPublishRequest creates a put request for the given records. Requires a signer for the identity key and
 // the records to put. The records are expected to be a DNS message packet, such as:
 //
 //	dns.Msg{
@@ -33,18 +35,18 @@ import (
 //				},
 //		    }
 //		}
-func CreateDNSPublishRequest(privateKey ed25519.PrivateKey, msg dns.Msg) (*bep44.Put, error) {
+func CreateDNSPublishRequest(s signer.Signer, msg dns.Msg) (*bep44.Put, error) {
 	packed, err := msg.Pack()
 	if err != nil {
 		return nil, util.LoggingErrorMsg(err, "failed to pack records")
 	}
-	publicKey := privateKey.Public().(ed25519.PublicKey)
 	put := &bep44.Put{
 		V:   packed,
-		K:   (*[32]byte)(publicKey),
 		Seq: time.Now().UnixMilli() / 1000,
 	}
-	put.Sign(privateKey)
+	if err = signer.SignPut(s, put); err != nil {
+		return nil, util.LoggingErrorMsg(err, "failed to sign put request")
+	}
 	return put, nil
 }
 
@@ -55,8 +57,8 @@ func ParseDNSGetResponse(response getput.GetResult) (*dns.Msg, error) {
 	if err := bencode.Unmarshal(response.V, &payload); err != nil {
 		return nil, util.LoggingErrorMsg(err, "failed to unmarshal payload value")
 	}
-	msg := new(dns.Msg)
-	if err := msg.Unpack([]byte(payload)); err != nil {
+	msg, err := did.UnpackDNSPacket([]byte(payload))
+	if err != nil {
 		return nil, util.LoggingErrorMsg(err, "failed to unpack records")
 	}
 	return msg, nil
@@ -8,12 +8,15 @@ import (
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	"github.com/TBD54566975/ssi-sdk/cryptosuite"
 	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/anacrolix/dht/v2/exts/getput"
+	"github.com/anacrolix/torrent/bencode"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/internal/util"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 func TestGetPutDNSDHT(t *testing.T) {
@@ -42,7 +45,7 @@ func TestGetPutDNSDHT(t *testing.T) {
 		},
 		Answer: []dns.RR{&txtRecord},
 	}
-	put, err := CreateDNSPublishRequest(privKey, msg)
+	put, err := CreateDNSPublishRequest(signer.NewInMemorySigner(privKey), msg)
 	require.NoError(t, err)
 
 	id, err := dht.Put(context.Background(), *put)
@@ -60,6 +63,26 @@ func TestGetPutDNSDHT(t *testing.T) {
 	assert.Equal(t, txtRecord.Txt, gotMsg.Answer[0].(*dns.TXT).Txt)
 }
 
+func TestParseDNSGetResponseLegacyGateway(t *testing.T) {
+	// gateways used to be published as TXT records with an NS header, which pack but do not unpack as NS records
+	msg := dns.Msg{
+		MsgHdr: dns.MsgHdr{Response: true, Authoritative: true},
+		Answer: []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: "_did.example.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 7200},
+			Txt: []string{"gateway1.example-did-dht-gateway.com"},
+		}},
+	}
+	packed, err := msg.Pack()
+	require.NoError(t, err)
+	v, err := bencode.Marshal(packed)
+	require.NoError(t, err)
+
+	gotMsg, err := ParseDNSGetResponse(getput.GetResult{V: v})
+	require.NoError(t, err)
+	require.Len(t, gotMsg.Answer, 1)
+	assert.Equal(t, "gateway1.example-did-dht-gateway.com.", gotMsg.Answer[0].(*dns.NS).Ns)
+}
+
 func TestGetPutDIDDHT(t *testing.T) {
 	dht := NewTestDHT(t)
 	defer dht.Close()
@@ -103,7 +126,7 @@ func TestGetPutDIDDHT(t *testing.T) {
 	didDocPacket, err := didID.ToDNSPacket(*doc, nil, nil, nil)
 	require.NoError(t, err)
 
-	putReq, err := CreateDNSPublishRequest(privKey, *didDocPacket)
+	putReq, err := CreateDNSPublishRequest(signer.NewInMemorySigner(privKey), *didDocPacket)
 	require.NoError(t, err)
 
 	gotID, err := dht.Put(context.Background(), *putReq)
@@ -123,3 +146,28 @@ func TestGetPutDIDDHT(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, gotDoc)
 }
+
+func TestPublishWithManager(t *testing.T) {
+	d := NewTestDHT(t)
+	defer d.Close()
+
+	_, privKey, err := util.GenerateKeypair()
+	require.NoError(t, err)
+	m, err := did.NewManager(signer.NewInMemorySigner(privKey), d)
+	require.NoError(t, err)
+
+	doc, err := m.Create(context.Background(), did.CreateDIDDHTOpts{}, nil, nil)
+	require.NoError(t, err)
+
+	suffix, err := did.DHT(doc.ID).Suffix()
+	require.NoError(t, err)
+	got, err := d.GetFull(context.Background(), suffix)
+	require.NoError(t, err)
+	assert.Equal(t, m.SequenceNumber(), got.Seq)
+
+	gotMsg, err := ParseDNSGetResponse(*got)
+	require.NoError(t, err)
+	gotDoc, err := did.DHT(doc.ID).FromDNSPacket(gotMsg)
+	require.NoError(t, err)
+	assert.EqualValues(t, *doc, gotDoc.Doc)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/TBD54566975/ssi-sdk/util"
 	"github.com/anacrolix/dht/v2/bep44"
@@ -31,12 +32,29 @@ type BEP44Record struct {
 	Key            [32]byte `json:"k" validate:"required"`
 	Signature      [64]byte `json:"sig" validate:"required"`
 	SequenceNumber int64    `json:"seq" validate:"required"`
+	// Updated is when the record was last accepted by storage, the zero time if it has not been stored
+	Updated time.Time `json:"-"`
 }
 
+var (
+	// ErrInvalidSignature is returned when a record's signature does not verify against its key
+	ErrInvalidSignature = errors.New("signature is invalid")
+	// ErrStaleSequenceNumber is returned when a record has a lower sequence number than the record already stored
+	ErrStaleSequenceNumber = errors.New("record has a lower sequence number than the stored record")
+	// ErrLowerPayload is returned when a record has the same sequence number as the record already stored, but a
+	// lexicographically lower payload
+	ErrLowerPayload = errors.New("record has the same sequence number as the stored record with a lower payload")
+	// ErrRecordBlocked is returned when writing a record the gateway has blocked
+	ErrRecordBlocked = errors.New("record is blocked by this gateway")
+)
+
 // FailedRecord represents a record that failed to be written to the DHT
 type FailedRecord struct {
-	ID    string `json:"id"`
-	Count int    `json:"count"`
+	ID string `json:"id"`
+	// Count is the number of times in a row the record has failed to be republished
+	Count int `json:"count"`
+	// Quarantined is set once the record has failed too many times in a row, and is no longer republished
+	Quarantined bool `json:"quarantined"`
 }
 
 // NewBEP44Record returns a new BEP44Record with the given key, value, signature, and sequence number
@@ -78,11 +96,35 @@ func (r BEP44Record) IsValid() error {
 	}
 
 	if !bep44.Verify(r.Key[:], nil, r.SequenceNumber, bv, r.Signature[:]) {
-		return errors.New("signature is invalid")
+		return ErrInvalidSignature
 	}
 	return nil
 }
 
+// ResolveConflict applies the conflict resolution rules https://did-dht.com/#conflict-resolution to decide whether
+// the record may replace the stored record. It returns ErrStaleSequenceNumber or ErrLowerPayload if the record must be
+// rejected, and reports whether the record is identical to the stored record, in which case only its timeout resets.
+func (r BEP44Record) ResolveConflict(stored *BEP44Record) (identical bool, err error) {
+	if stored == nil {
+		return false, nil
+	}
+	switch {
+	case r.SequenceNumber < stored.SequenceNumber:
+		return false, ErrStaleSequenceNumber
+	case r.SequenceNumber > stored.SequenceNumber:
+		return false, nil
+	}
+
+	switch bytes.Compare(r.Value, stored.Value) {
+	case 0:
+		return true, nil
+	case -1:
+		return false, ErrLowerPayload
+	default:
+		return false, nil
+	}
+}
+
 // Response returns the record as a BEP44Response
 func (r BEP44Record) Response() BEP44Response {
 	return BEP44Response{
@@ -9,6 +9,7 @@ import (
 
 	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 )
 
 func TestNewRecord(t *testing.T) {
@@ -26,7 +27,7 @@ func TestNewRecord(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, packet)
 
-	putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+	putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	require.NoError(t, err)
 	require.NotEmpty(t, putMsg)
 
@@ -66,3 +67,33 @@ func TestNewRecord(t *testing.T) {
 	assert.Equal(t, r.Signature, r2.Signature)
 	assert.Equal(t, r.SequenceNumber, r2.SequenceNumber)
 }
+
+func TestResolveConflict(t *testing.T) {
+	stored := dht.BEP44Record{Value: []byte("b"), SequenceNumber: 2}
+
+	tests := []struct {
+		name      string
+		record    dht.BEP44Record
+		identical bool
+		err       error
+	}{
+		{"higher seq", dht.BEP44Record{Value: []byte("a"), SequenceNumber: 3}, false, nil},
+		{"lower seq", dht.BEP44Record{Value: []byte("c"), SequenceNumber: 1}, false, dht.ErrStaleSequenceNumber},
+		{"equal seq identical payload", dht.BEP44Record{Value: []byte("b"), SequenceNumber: 2}, true, nil},
+		{"equal seq lower payload", dht.BEP44Record{Value: []byte("a"), SequenceNumber: 2}, false, dht.ErrLowerPayload},
+		{"equal seq higher payload", dht.BEP44Record{Value: []byte("c"), SequenceNumber: 2}, false, nil},
+		{"equal seq longer payload", dht.BEP44Record{Value: []byte("ba"), SequenceNumber: 2}, false, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identical, err := test.record.ResolveConflict(&stored)
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.identical, identical)
+		})
+	}
+
+	// nothing stored
+	identical, err := stored.ResolveConflict(nil)
+	assert.NoError(t, err)
+	assert.False(t, identical)
+}
@@ -0,0 +1,274 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+const (
+	// DIDJSONContentType is the media type of the DID Documents returned by the resolver
+	DIDJSONContentType = "application/did+json"
+
+	// sigSeqLength is the length of the signature and sequence number that prefix a gateway's sig:seq:v response
+	sigSeqLength = 72
+	// maxResponseLength is the length of the longest sig:seq:v response, holding the largest BEP44 value
+	maxResponseLength = sigSeqLength + did.MaxPacketSize
+)
+
+// ErrNotFound is returned when no record exists for the DID being resolved
+var ErrNotFound = errors.New("did not found")
+
+// DHTResolver resolves did:dht DIDs according to https://did-dht.com/#did-resolution, either directly from Mainline
+// or through one or more gateways. It implements ssi-sdk's resolution.Resolver so it can be used in a
+// resolution.MultiMethodResolver alongside other methods.
+type DHTResolver struct {
+	dht      *dht.DHT
+	gateways []string
+	client   *http.Client
+}
+
+var _ resolution.Resolver = (*DHTResolver)(nil)
+
+// NewDHTResolver returns a resolver that reads records straight from Mainline through the given DHT
+func NewDHTResolver(d *dht.DHT) (*DHTResolver, error) {
+	if d == nil {
+		return nil, errors.New("dht cannot be nil")
+	}
+	return &DHTResolver{dht: d}, nil
+}
+
+// NewGatewayResolver returns a resolver that reads records through the given gateways, trying each in order until
+// one returns a record
+func NewGatewayResolver(gatewayURLs ...string) (*DHTResolver, error) {
+	return NewGatewayResolverWithClient(&http.Client{Timeout: time.Second * 10}, gatewayURLs...)
+}
+
+// NewGatewayResolverWithClient returns a resolver that reads records through the given gateways using the given HTTP
+// client, trying each in order until one returns a record
+func NewGatewayResolverWithClient(client *http.Client, gatewayURLs ...string) (*DHTResolver, error) {
+	if client == nil {
+		return nil, errors.New("client cannot be nil")
+	}
+	if len(gatewayURLs) == 0 {
+		return nil, errors.New("at least one gateway is required")
+	}
+	gateways := make([]string, 0, len(gatewayURLs))
+	for _, gatewayURL := range gatewayURLs {
+		if _, err := url.ParseRequestURI(gatewayURL); err != nil {
+			return nil, errors.Wrapf(err, "invalid gateway url: %s", gatewayURL)
+		}
+		gateways = append(gateways, strings.TrimSuffix(gatewayURL, "/"))
+	}
+	return &DHTResolver{
+		gateways: gateways,
+		client:   client,
+	}, nil
+}
+
+// Methods returns the DID methods supported by the resolver
+func (*DHTResolver) Methods() []didsdk.Method {
+	return []didsdk.Method{did.DHTMethod}
+}
+
+// Resolve resolves a did:dht DID, verifying the signature of the record it is stored in before decoding the
+// DID Document from it
+func (r *DHTResolver) Resolve(ctx context.Context, id string, _ ...resolution.Option) (*resolution.Result, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTResolver.Resolve")
+	defer span.End()
+
+	record, err := r.GetRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := did.UnpackDNSPacket(record.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack records")
+	}
+	doc, err := did.DHT(id).FromDNSPacket(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create did document from dns packet")
+	}
+
+	result := did.NewResolutionResult(*doc, record.SequenceNumber, nil)
+	return &resolution.Result{
+		Metadata: resolution.Metadata{ContentType: DIDJSONContentType},
+		Document: result.Document,
+		DocumentMetadata: &resolution.DocumentMetadata{
+			Created:     result.DocumentMetadata.Created,
+			Updated:     result.DocumentMetadata.Updated,
+			Deactivated: result.DocumentMetadata.Deactivated,
+			VersionID:   result.DocumentMetadata.VersionID,
+		},
+	}, nil
+}
+
+// Lineage verifies the chain of DIDs the DID was rotated from https://did-dht.com/#rotation, resolving each of them
+// in turn, and returns it starting at the DID
+func (r *DHTResolver) Lineage(ctx context.Context, id string, opts did.LineageOpts) ([]did.LineageLink, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTResolver.Lineage")
+	defer span.End()
+
+	return did.VerifyLineage(ctx, did.DHT(id), r.getDocument, opts)
+}
+
+// getDocument resolves the DID DHT Document of a DID, returning nil if no record is found for it
+func (r *DHTResolver) getDocument(ctx context.Context, id did.DHT) (*did.DIDDHTDocument, error) {
+	record, err := r.GetRecord(ctx, id.String())
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	msg, err := did.UnpackDNSPacket(record.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack records")
+	}
+	return id.FromDNSPacket(msg)
+}
+
+// Record is a BEP44 record whose signature has been verified against the identity key of the DID it was resolved for
+type Record struct {
+	dht.BEP44Record
+	// Gateway is the URL of the gateway the record was resolved from, empty if it was resolved from Mainline
+	Gateway string
+}
+
+// GetRecord gets the BEP44 record the DID is stored in and verifies it was signed by the DID's identity key
+func (r *DHTResolver) GetRecord(ctx context.Context, id string) (*Record, error) {
+	d := did.DHT(id)
+	if !d.IsValid() {
+		return nil, fmt.Errorf("invalid did: %s", id)
+	}
+	suffix, err := d.Suffix()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get suffix")
+	}
+	key, err := d.IdentityKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get identity key")
+	}
+
+	if r.dht == nil {
+		return r.getFromGateways(ctx, key, suffix)
+	}
+	resp, err := r.getFromDHT(ctx, suffix)
+	if err != nil {
+		return nil, err
+	}
+	record, err := verifyRecord(key, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{BEP44Record: *record}, nil
+}
+
+// verifyRecord checks the response was signed by the given identity key, returning it as a record
+func verifyRecord(key []byte, resp *dht.BEP44Response) (*dht.BEP44Record, error) {
+	record, err := dht.NewBEP44Record(key, resp.V, resp.Sig[:], resp.Seq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify record")
+	}
+	return record, nil
+}
+
+// getFromDHT gets the record for the given z32 key from Mainline
+func (r *DHTResolver) getFromDHT(ctx context.Context, suffix string) (*dht.BEP44Response, error) {
+	got, err := r.dht.GetFull(ctx, suffix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get record from dht")
+	}
+	if got.V == nil {
+		return nil, ErrNotFound
+	}
+	bBytes, err := got.V.MarshalBencode()
+	if err != nil {
+		return nil, err
+	}
+	var payload string
+	if err = bencode.Unmarshal(bBytes, &payload); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal bencoded payload")
+	}
+	return &dht.BEP44Response{
+		V:   []byte(payload),
+		Seq: got.Seq,
+		Sig: got.Sig,
+	}, nil
+}
+
+// getFromGateways gets the record for the given z32 key from the first gateway that returns one signed by the given
+// identity key, along with the gateway that answered. A gateway returning a record that fails verification is skipped.
+func (r *DHTResolver) getFromGateways(ctx context.Context, key []byte, suffix string) (*Record, error) {
+	var errs []error
+	for _, gateway := range r.gateways {
+		resp, err := r.getFromGateway(ctx, gateway, suffix)
+		if err == nil {
+			var record *dht.BEP44Record
+			if record, err = verifyRecord(key, resp); err == nil {
+				return &Record{BEP44Record: *record, Gateway: gateway}, nil
+			}
+		}
+		errs = append(errs, errors.Wrapf(err, "gateway %s", gateway))
+	}
+
+	// only report the record as not found if no gateway failed for another reason
+	for _, err := range errs {
+		if !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to get record from gateways: %w", goerrors.Join(errs...))
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// getFromGateway gets the record for the given z32 key from a gateway, which returns it as sig:seq:v
+func (r *DHTResolver) getFromGateway(ctx context.Context, gateway, suffix string) (*dht.BEP44Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gateway+"/"+suffix, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not construct http get request")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get record")
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, errors.Errorf("failed to get record, status code: %d", resp.StatusCode)
+	}
+	// read one byte past the longest valid response, so a longer one is rejected without being read in full
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseLength+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	if len(body) > maxResponseLength {
+		return nil, errors.New("response is too long to contain a record")
+	}
+	if len(body) <= sigSeqLength {
+		return nil, errors.New("response is too short to contain a record")
+	}
+	return &dht.BEP44Response{
+		Sig: [64]byte(body[:64]),
+		Seq: int64(binary.BigEndian.Uint64(body[64:sigSeqLength])),
+		V:   body[sigSeqLength:],
+	}, nil
+}
@@ -0,0 +1,210 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	anacrolixdht "github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+func TestDHTResolver(t *testing.T) {
+	t.Run("test methods", func(t *testing.T) {
+		r, err := NewGatewayResolver("http://localhost:8305")
+		require.NoError(t, err)
+		assert.Equal(t, did.DHTMethod, r.Methods()[0])
+
+		multi, err := resolution.NewResolver(r)
+		require.NoError(t, err)
+		assert.Equal(t, did.DHTMethod, multi.Methods()[0])
+	})
+
+	t.Run("test bad constructors", func(t *testing.T) {
+		_, err := NewDHTResolver(nil)
+		assert.Error(t, err)
+
+		_, err = NewGatewayResolver()
+		assert.Error(t, err)
+
+		_, err = NewGatewayResolver("not a url")
+		assert.Error(t, err)
+
+		_, err = NewGatewayResolverWithClient(nil, "http://localhost:8305")
+		assert.Error(t, err)
+	})
+
+	t.Run("test resolve from dht", func(t *testing.T) {
+		id, put := newPut(t)
+
+		d1 := dht.NewTestDHT(t)
+		_, err := d1.Put(context.Background(), *put)
+		require.NoError(t, err)
+
+		d2 := dht.NewTestDHT(t, anacrolixdht.NewAddr(d1.Addr()))
+		t.Cleanup(func() {
+			d1.Close()
+			d2.Close()
+		})
+
+		r, err := NewDHTResolver(d2)
+		require.NoError(t, err)
+
+		result, err := r.Resolve(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, id, result.Document.ID)
+		assert.Equal(t, DIDJSONContentType, result.Metadata.ContentType)
+		require.NotNil(t, result.DocumentMetadata)
+		assert.NotEmpty(t, result.DocumentMetadata.VersionID)
+		assert.False(t, result.DocumentMetadata.Deactivated)
+	})
+
+	t.Run("test resolve from gateway", func(t *testing.T) {
+		id, put := newPut(t)
+		gateway := newTestGateway(t, id, put)
+
+		r, err := NewGatewayResolver(gateway.URL)
+		require.NoError(t, err)
+
+		result, err := r.Resolve(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, id, result.Document.ID)
+		require.NotNil(t, result.DocumentMetadata)
+		assert.Equal(t, result.DocumentMetadata.Created, result.DocumentMetadata.Updated)
+	})
+
+	t.Run("test resolve falls back to the next gateway", func(t *testing.T) {
+		id, put := newPut(t)
+		empty := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(empty.Close)
+		gateway := newTestGateway(t, id, put)
+
+		r, err := NewGatewayResolver(empty.URL, gateway.URL)
+		require.NoError(t, err)
+
+		result, err := r.Resolve(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, id, result.Document.ID)
+
+		record, err := r.GetRecord(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, gateway.URL, record.Gateway)
+		assert.Equal(t, put.Seq, record.SequenceNumber)
+	})
+
+	t.Run("test resolve skips a gateway serving a forged record", func(t *testing.T) {
+		id, put := newPut(t)
+		_, otherPut := newPut(t)
+		forged := newTestGateway(t, id, otherPut)
+		gateway := newTestGateway(t, id, put)
+
+		r, err := NewGatewayResolver(forged.URL, gateway.URL)
+		require.NoError(t, err)
+
+		record, err := r.GetRecord(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, gateway.URL, record.Gateway)
+		assert.Equal(t, put.Seq, record.SequenceNumber)
+	})
+
+	t.Run("test resolve rejects an oversized response", func(t *testing.T) {
+		id, _ := newPut(t)
+		oversized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(make([]byte, 1<<20))
+		}))
+		t.Cleanup(oversized.Close)
+
+		r, err := NewGatewayResolver(oversized.URL)
+		require.NoError(t, err)
+
+		_, err = r.GetRecord(context.Background(), id)
+		assert.ErrorContains(t, err, "response is too long to contain a record")
+	})
+
+	t.Run("test resolve not found", func(t *testing.T) {
+		id, _ := newPut(t)
+		empty := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(empty.Close)
+
+		r, err := NewGatewayResolver(empty.URL)
+		require.NoError(t, err)
+
+		_, err = r.Resolve(context.Background(), id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("test resolve bad signature", func(t *testing.T) {
+		id, put := newPut(t)
+		put.Sig[0] ^= 0xff
+		gateway := newTestGateway(t, id, put)
+
+		r, err := NewGatewayResolver(gateway.URL)
+		require.NoError(t, err)
+
+		_, err = r.Resolve(context.Background(), id)
+		assert.ErrorIs(t, err, dht.ErrInvalidSignature)
+	})
+
+	t.Run("test resolve record signed by another key", func(t *testing.T) {
+		id, _ := newPut(t)
+		_, otherPut := newPut(t)
+		gateway := newTestGateway(t, id, otherPut)
+
+		r, err := NewGatewayResolver(gateway.URL)
+		require.NoError(t, err)
+
+		_, err = r.Resolve(context.Background(), id)
+		assert.ErrorIs(t, err, dht.ErrInvalidSignature)
+	})
+
+	t.Run("test resolve invalid did", func(t *testing.T) {
+		r, err := NewGatewayResolver("http://localhost:8305")
+		require.NoError(t, err)
+
+		_, err = r.Resolve(context.Background(), "did:example:123")
+		assert.Error(t, err)
+	})
+}
+
+// newPut generates a DID and returns it with a signed put message for its DID Document
+func newPut(t *testing.T) (string, *bep44.Put) {
+	sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+	require.NoError(t, err)
+
+	packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+	require.NoError(t, err)
+
+	put, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+	require.NoError(t, err)
+	return doc.ID, put
+}
+
+// newTestGateway returns a server that serves the put message for the DID as sig:seq:v, as a gateway does
+func newTestGateway(t *testing.T, id string, put *bep44.Put) *httptest.Server {
+	suffix, err := did.DHT(id).Suffix()
+	require.NoError(t, err)
+
+	var seqBuf [8]byte
+	binary.BigEndian.PutUint64(seqBuf[:], uint64(put.Seq))
+	body := append(put.Sig[:], append(seqBuf[:], put.V.([]byte)...)...)
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/") != suffix {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
@@ -0,0 +1,531 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/did-dht/config"
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/service"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+// AdminRouter is the router for the admin API, used by operators to inspect and manage the gateway
+type AdminRouter struct {
+	service *service.DHTService
+}
+
+// NewAdminRouter returns a new instance of the admin router
+func NewAdminRouter(service *service.DHTService) (*AdminRouter, error) {
+	return &AdminRouter{service: service}, nil
+}
+
+// AdminAuth authenticates requests to the admin API with the configured bearer token, or with a client certificate
+// verified against the configured admin client certificate authorities
+func AdminAuth(cfg config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// the server only verifies client certificates against the admin client CAs
+		if cfg.AdminClientCAFile != "" && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			c.Next()
+			return
+		}
+		if cfg.AdminToken != "" {
+			token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+		LoggingRespondErrMsg(c, "admin authentication required", http.StatusUnauthorized)
+		c.Abort()
+	}
+}
+
+// RecordSummary identifies a stored record
+type RecordSummary struct {
+	// ID is the z-base-32 encoded ID of the record
+	ID string `json:"id"`
+	// Seq is the sequence number of the stored record
+	Seq int64 `json:"seq"`
+}
+
+// ListRecordsResponse is a page of the stored records
+type ListRecordsResponse struct {
+	Records []RecordSummary `json:"records"`
+	// NextPageToken is the token to request the next page with, empty on the last page
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// ListRecords godoc
+//
+//	@Summary		List stored records
+//	@Description	List the records stored by the gateway a page at a time
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			page_size	query		integer	false	"Number of records to return, at most 1000"
+//	@Param			page_token	query		string	false	"Token of the page to return, from the previous page"
+//	@Success		200			{object}	ListRecordsResponse
+//	@Failure		400			{string}	string	"Invalid request"
+//	@Failure		401			{string}	string	"Unauthorized"
+//	@Failure		500			{string}	string	"Internal server error"
+//	@Router			/admin/records [get]
+func (r *AdminRouter) ListRecords(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.ListRecords")
+	defer span.End()
+
+	pageSize := DefaultPageSize
+	if pageSizeParam := GetQueryValue(c, PageSizeParam); pageSizeParam != nil {
+		var err error
+		if pageSize, err = strconv.Atoi(*pageSizeParam); err != nil || pageSize <= 0 || pageSize > MaxPageSize {
+			LoggingRespondErrMsg(c, fmt.Sprintf("invalid page size, must be between 1 and %d: %s", MaxPageSize, *pageSizeParam), http.StatusBadRequest)
+			return
+		}
+	}
+	var pageToken []byte
+	if pageTokenParam := GetQueryValue(c, PageTokenParam); pageTokenParam != nil {
+		var err error
+		if pageToken, err = base64.RawURLEncoding.DecodeString(*pageTokenParam); err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid page token: %s", *pageTokenParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, nextPageToken, err := r.service.ListRecords(ctx, pageToken, pageSize)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, "failed to list records", http.StatusInternalServerError)
+		return
+	}
+	resp := ListRecordsResponse{Records: make([]RecordSummary, 0, len(records))}
+	for _, record := range records {
+		resp.Records = append(resp.Records, RecordSummary{ID: record.ID(), Seq: record.SequenceNumber})
+	}
+	if nextPageToken != nil {
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString(nextPageToken)
+	}
+	Respond(c, resp, http.StatusOK)
+}
+
+// GetRecordResponse is everything the gateway stores for a record
+type GetRecordResponse struct {
+	RecordSummary
+	// DHT is the unpadded base64URL encoding of the full BEP44 payload as 64 bytes sig, 8 bytes u64
+	// big-endian seq, and 0-1000 bytes of v concatenated
+	DHT string `json:"dht"`
+	// Document is the DID DHT Document the record decodes to
+	Document *did.DIDDHTDocument `json:"document,omitempty"`
+	// DecodeError is why the record does not decode to a DID DHT Document
+	DecodeError string `json:"decode_error,omitempty"`
+	// SequenceNumbers is the sorted list of sequence numbers of the stored versions of the record
+	SequenceNumbers []int64 `json:"sequence_numbers"`
+	// Expiry is the Unix Timestamp in seconds at which the record will be evicted from the Retained DID Set
+	Expiry int64 `json:"expiry,omitempty"`
+	// NextRepublish is the Unix Timestamp in seconds at which the record is next republished
+	NextRepublish int64 `json:"next_republish,omitempty"`
+	// Failure is set if the record is failing to be republished
+	Failure *dht.FailedRecord `json:"failure,omitempty"`
+}
+
+// GetRecord godoc
+//
+//	@Summary		Get a stored record
+//	@Description	Get a stored record with its decoded DID Document, stored history, and republish state
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path		string	true	"ID of the record, or the DID it is for"
+//	@Success		200	{object}	GetRecordResponse
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		404	{string}	string	"Record not found"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/records/{id} [get]
+func (r *AdminRouter) GetRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.GetRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	info, err := r.service.GetRecordInfo(ctx, id)
+	if err != nil {
+		if errors.Is(err, service.ErrRecordNotFound) {
+			LoggingRespondErrMsg(c, fmt.Sprintf("record not found: %s", id), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to get record: %s", id), http.StatusInternalServerError)
+		return
+	}
+
+	resp := GetRecordResponse{
+		RecordSummary:   RecordSummary{ID: id, Seq: info.Record.SequenceNumber},
+		DHT:             base64.RawURLEncoding.EncodeToString(encodeBEP44Payload(info.Record.Response())),
+		Document:        info.Document,
+		SequenceNumbers: info.SequenceNumbers,
+		Failure:         info.Failure,
+	}
+	if info.DecodeErr != nil {
+		resp.DecodeError = info.DecodeErr.Error()
+	}
+	if !info.Expiry.IsZero() {
+		resp.Expiry = info.Expiry.Unix()
+	}
+	if !info.NextRepublish.IsZero() {
+		resp.NextRepublish = info.NextRepublish.Unix()
+	}
+	Respond(c, resp, http.StatusOK)
+}
+
+// DeleteRecord godoc
+//
+//	@Summary		Delete a stored record
+//	@Description	Delete a stored record and its history, so it is no longer served or republished by the gateway
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path		string	true	"ID of the record, or the DID it is for"
+//	@Success		204
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		404	{string}	string	"Record not found"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/records/{id} [delete]
+func (r *AdminRouter) DeleteRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.DeleteRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := r.service.DeleteRecord(ctx, id); err != nil {
+		if errors.Is(err, service.ErrRecordNotFound) {
+			LoggingRespondErrMsg(c, fmt.Sprintf("record not found: %s", id), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to delete record: %s", id), http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusNoContent)
+}
+
+// RepublishRecord godoc
+//
+//	@Summary		Republish a stored record
+//	@Description	Put a stored record to the DHT at once, rescheduling it as if it had come due
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path	string	true	"ID of the record, or the DID it is for"
+//	@Success		200
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		404	{string}	string	"Record not found"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/records/{id}/republish [post]
+func (r *AdminRouter) RepublishRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.RepublishRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := r.service.RepublishRecord(ctx, id); err != nil {
+		if errors.Is(err, service.ErrRecordNotFound) {
+			LoggingRespondErrMsg(c, fmt.Sprintf("record not found: %s", id), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to republish record: %s", id), http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusOK)
+}
+
+// RepublishAll godoc
+//
+//	@Summary		Republish all stored records
+//	@Description	Schedule every stored record that is not quarantined to be republished at once. Records are
+//	@Description	rescheduled in the background, and republished by the republish workers.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Success		202
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		409	{string}	string	"A republish of all records is already in progress"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/republish [post]
+func (r *AdminRouter) RepublishAll(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.RepublishAll")
+	defer span.End()
+
+	if err := r.service.RepublishAll(ctx); err != nil {
+		if errors.Is(err, service.ErrRepublishInProgress) {
+			LoggingRespondErrWithMsg(c, err, "failed to republish all records", http.StatusConflict)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, "failed to republish all records", http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusAccepted)
+}
+
+// ListBlockedRecordsResponse is the list of records blocked by the gateway
+type ListBlockedRecordsResponse struct {
+	// IDs are the z-base-32 encoded IDs of the blocked records
+	IDs []string `json:"ids"`
+}
+
+// ListBlockedRecords godoc
+//
+//	@Summary		List blocked records
+//	@Description	List the records the gateway refuses to store or serve
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Success		200	{object}	ListBlockedRecordsResponse
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/blocked [get]
+func (r *AdminRouter) ListBlockedRecords(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.ListBlockedRecords")
+	defer span.End()
+
+	ids, err := r.service.ListBlockedRecords(ctx)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, "failed to list blocked records", http.StatusInternalServerError)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	Respond(c, ListBlockedRecordsResponse{IDs: ids}, http.StatusOK)
+}
+
+// BlockRecord godoc
+//
+//	@Summary		Block a record
+//	@Description	Delete any stored record with the ID and block it, so the gateway no longer accepts, serves or
+//	@Description	republishes it
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path	string	true	"ID of the record, or the DID it is for"
+//	@Success		204
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/blocked/{id} [put]
+func (r *AdminRouter) BlockRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.BlockRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := r.service.BlockRecord(ctx, id); err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to block record: %s", id), http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusNoContent)
+}
+
+// UnblockRecord godoc
+//
+//	@Summary		Unblock a record
+//	@Description	Remove the block on a record, so it may be published to the gateway again
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path	string	true	"ID of the record, or the DID it is for"
+//	@Success		204
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/blocked/{id} [delete]
+func (r *AdminRouter) UnblockRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.UnblockRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := r.service.UnblockRecord(ctx, id); err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to unblock record: %s", id), http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusNoContent)
+}
+
+// ListFailedRecordsResponse is the list of records failing to be republished
+type ListFailedRecordsResponse struct {
+	Records []dht.FailedRecord `json:"records"`
+}
+
+// ListFailedRecords godoc
+//
+//	@Summary		List failed records
+//	@Description	List the records failing to be republished, with the number of times in a row each has failed and
+//	@Description	whether it has been quarantined
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Success		200	{object}	ListFailedRecordsResponse
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/failed [get]
+func (r *AdminRouter) ListFailedRecords(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.ListFailedRecords")
+	defer span.End()
+
+	records, err := r.service.ListFailedRecords(ctx)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, "failed to list failed records", http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []dht.FailedRecord{}
+	}
+	Respond(c, ListFailedRecordsResponse{Records: records}, http.StatusOK)
+}
+
+// RetryFailedRecord godoc
+//
+//	@Summary		Retry a quarantined record
+//	@Description	Clear the failures of a quarantined record and schedule it to be republished at once
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path	string	true	"ID of the record, or the DID it is for"
+//	@Success		204
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		404	{string}	string	"Record not quarantined"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/failed/{id}/retry [post]
+func (r *AdminRouter) RetryFailedRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.RetryFailedRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := r.service.RetryQuarantinedRecord(ctx, id); err != nil {
+		if errors.Is(err, service.ErrRecordNotQuarantined) {
+			LoggingRespondErrMsg(c, fmt.Sprintf("record not quarantined: %s", id), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to retry record: %s", id), http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusNoContent)
+}
+
+// PurgeFailedRecord godoc
+//
+//	@Summary		Purge a quarantined record
+//	@Description	Delete a quarantined record, so it is no longer served or republished by the gateway
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Param			id	path	string	true	"ID of the record, or the DID it is for"
+//	@Success		204
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Failure		404	{string}	string	"Record not quarantined"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/admin/failed/{id} [delete]
+func (r *AdminRouter) PurgeFailedRecord(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "AdminHTTP.PurgeFailedRecord")
+	defer span.End()
+
+	id, ok := recordIDFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := r.service.PurgeQuarantinedRecord(ctx, id); err != nil {
+		if errors.Is(err, service.ErrRecordNotQuarantined) {
+			LoggingRespondErrMsg(c, fmt.Sprintf("record not quarantined: %s", id), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to purge record: %s", id), http.StatusInternalServerError)
+		return
+	}
+	ResponseStatus(c, http.StatusNoContent)
+}
+
+// GetCacheStatsResponse is the statistics of the gateway's caches
+type GetCacheStatsResponse struct {
+	// Records is the cache of resolved records
+	Records service.CacheStats `json:"records"`
+	// NotFound is the cache of records recently not found, which are not looked up again until they expire
+	NotFound service.CacheStats `json:"not_found"`
+	// Forwarded is the cache of reads forwarded to the authoritative gateways of DIDs, including those that failed
+	Forwarded service.CacheStats `json:"forwarded"`
+}
+
+// GetCacheStats godoc
+//
+//	@Summary		Get cache statistics
+//	@Description	Get the hit, miss and size statistics of the gateway's caches
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		AdminToken
+//	@Success		200	{object}	GetCacheStatsResponse
+//	@Failure		401	{string}	string	"Unauthorized"
+//	@Router			/admin/cache [get]
+func (r *AdminRouter) GetCacheStats(c *gin.Context) {
+	_, span := telemetry.GetTracer().Start(c, "AdminHTTP.GetCacheStats")
+	defer span.End()
+
+	records, notFound, forwarded := r.service.GetCacheStats()
+	Respond(c, GetCacheStatsResponse{Records: records, NotFound: notFound, Forwarded: forwarded}, http.StatusOK)
+}
+
+// recordIDFromParam returns the record ID from the id path parameter, which may also be the DID the record is for,
+// responding with an error if it is missing or invalid
+func recordIDFromParam(c *gin.Context) (string, bool) {
+	id := GetParam(c, IDParam)
+	if id == nil || *id == "" {
+		LoggingRespondErrMsg(c, "missing id param", http.StatusBadRequest)
+		return "", false
+	}
+	suffix, err := didSuffixFromParam(*id)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid record id: %s", *id), http.StatusBadRequest)
+		return "", false
+	}
+	return suffix, true
+}
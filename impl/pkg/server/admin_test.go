@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/config"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/service"
+)
+
+const testAdminToken = "test-admin-token"
+
+func TestAdminRouter(t *testing.T) {
+	svc := testDHTService(t)
+	cfg := config.ServerConfig{AdminToken: testAdminToken}
+	handler := gin.New()
+	require.NoError(t, AdminAPI(&handler.RouterGroup, &svc, cfg))
+
+	defer svc.Close()
+
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, testServerURL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		record := dht.NewTestRecord(t)
+		require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+		ids = append(ids, record.ID())
+	}
+
+	t.Run("test authentication", func(t *testing.T) {
+		for _, authorization := range []string{"", "Bearer wrong-token", testAdminToken} {
+			req := httptest.NewRequest(http.MethodGet, testServerURL+"/admin/cache", nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+		}
+		assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/admin/cache").Code)
+
+		// client certificates authenticate only when admin client CAs are configured
+		mtlsHandler := gin.New()
+		require.NoError(t, AdminAPI(&mtlsHandler.RouterGroup, &svc, config.ServerConfig{AdminClientCAFile: "ca.pem"}))
+		for _, chains := range [][][]*x509.Certificate{nil, {{&x509.Certificate{}}}} {
+			req := httptest.NewRequest(http.MethodGet, testServerURL+"/admin/cache", nil)
+			req.TLS = &tls.ConnectionState{VerifiedChains: chains}
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			w := httptest.NewRecorder()
+			mtlsHandler.ServeHTTP(w, req)
+			if chains == nil {
+				assert.Equal(t, http.StatusUnauthorized, w.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+		}
+
+		// without admin authentication configured there is no admin API
+		unconfigured := gin.New()
+		require.NoError(t, AdminAPI(&unconfigured.RouterGroup, &svc, config.ServerConfig{}))
+		w := httptest.NewRecorder()
+		unconfigured.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testServerURL+"/admin/cache", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("test list records", func(t *testing.T) {
+		seen := make(map[string]bool)
+		path := "/admin/records?page_size=1"
+		for i := 0; ; i++ {
+			require.Less(t, i, 1000, "too many pages")
+			w := admin(http.MethodGet, path)
+			require.Equal(t, http.StatusOK, w.Code)
+			var resp ListRecordsResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.LessOrEqual(t, len(resp.Records), 1)
+			for _, record := range resp.Records {
+				seen[record.ID] = true
+			}
+			if resp.NextPageToken == "" {
+				break
+			}
+			path = "/admin/records?page_size=1&page_token=" + resp.NextPageToken
+		}
+		for _, id := range ids {
+			assert.True(t, seen[id], "record %s not listed", id)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, admin(http.MethodGet, "/admin/records?page_size=1001").Code)
+		assert.Equal(t, http.StatusBadRequest, admin(http.MethodGet, "/admin/records?page_token=!").Code)
+	})
+
+	t.Run("test get record", func(t *testing.T) {
+		w := admin(http.MethodGet, "/admin/records/"+ids[0])
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp GetRecordResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, ids[0], resp.ID)
+		require.NotNil(t, resp.Document)
+		assert.Equal(t, "did:dht:"+ids[0], resp.Document.Doc.ID)
+		assert.Equal(t, []int64{resp.Seq}, resp.SequenceNumbers)
+		assert.NotZero(t, resp.NextRepublish)
+		assert.Empty(t, resp.DecodeError)
+
+		// records are found by their did too
+		assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/admin/records/did:dht:"+ids[0]).Code)
+		assert.Equal(t, http.StatusBadRequest, admin(http.MethodGet, "/admin/records/bad").Code)
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodGet, "/admin/records/"+dht.NewTestRecord(t).ID()).Code)
+	})
+
+	t.Run("test republish", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, admin(http.MethodPost, "/admin/records/"+ids[0]+"/republish").Code)
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/admin/records/"+dht.NewTestRecord(t).ID()+"/republish").Code)
+		assert.Equal(t, http.StatusAccepted, admin(http.MethodPost, "/admin/republish").Code)
+	})
+
+	t.Run("test failed records", func(t *testing.T) {
+		w := admin(http.MethodGet, "/admin/failed")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp ListFailedRecordsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.NotNil(t, resp.Records)
+
+		// only quarantined records are retried or purged
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/admin/failed/"+ids[0]+"/retry").Code)
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "/admin/failed/"+ids[0]).Code)
+	})
+
+	t.Run("test cache stats", func(t *testing.T) {
+		_, err := svc.GetDHT(context.Background(), ids[0])
+		require.NoError(t, err)
+
+		w := admin(http.MethodGet, "/admin/cache")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp GetCacheStatsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Positive(t, resp.Records.Entries)
+		assert.Positive(t, resp.Records.Hits)
+		assert.Positive(t, resp.Records.CapacityBytes)
+		assert.Positive(t, resp.NotFound.CapacityBytes)
+		assert.Positive(t, resp.Forwarded.CapacityBytes)
+	})
+
+	t.Run("test block and delete records", func(t *testing.T) {
+		blocked := dht.NewTestRecord(t)
+		require.NoError(t, svc.PublishDHT(context.Background(), blocked.ID(), blocked))
+
+		assert.Equal(t, http.StatusNoContent, admin(http.MethodPut, "/admin/blocked/"+blocked.ID()).Code)
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodGet, "/admin/records/"+blocked.ID()).Code)
+		assert.ErrorIs(t, svc.PublishDHT(context.Background(), blocked.ID(), blocked), service.ErrRecordBlocked)
+		got, err := svc.GetDHT(context.Background(), blocked.ID())
+		require.NoError(t, err)
+		assert.Nil(t, got)
+
+		w := admin(http.MethodGet, "/admin/blocked")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp ListBlockedRecordsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Contains(t, resp.IDs, blocked.ID())
+
+		// an unblocked record may be published again
+		assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/admin/blocked/"+blocked.ID()).Code)
+		require.NoError(t, svc.PublishDHT(context.Background(), blocked.ID(), blocked))
+
+		assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/admin/records/"+blocked.ID()).Code)
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodGet, "/admin/records/"+blocked.ID()).Code)
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "/admin/records/"+blocked.ID()).Code)
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tlsConfig, err := newTLSConfig(config.ServerConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = newTLSConfig(config.ServerConfig{AdminClientCAFile: "ca.pem"})
+	assert.ErrorContains(t, err, "requires a tls cert and key")
+
+	_, err = newTLSConfig(config.ServerConfig{TLSCertFile: "missing.pem", TLSKeyFile: "missing.key"})
+	assert.ErrorContains(t, err, "failed to load tls cert and key")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 
+	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/internal/util"
 	"github.com/TBD54566975/did-dht/pkg/dht"
 	"github.com/TBD54566975/did-dht/pkg/service"
@@ -75,12 +76,16 @@ func (r *DHTRouter) GetRecord(c *gin.Context) {
 		return
 	}
 
+	RespondBytes(c, encodeBEP44Payload(*resp), http.StatusOK)
+}
+
+// encodeBEP44Payload encodes a BEP44 response as sig:seq:v
+func encodeBEP44Payload(resp dht.BEP44Response) []byte {
 	// Convert int64 to uint64 since binary.PutUint64 expects a uint64 value
 	var seqBuf [8]byte
 	binary.BigEndian.PutUint64(seqBuf[:], uint64(resp.Seq))
 	// sig:seq:v
-	res := append(resp.Sig[:], append(seqBuf[:], resp.V[:]...)...)
-	RespondBytes(c, res, http.StatusOK)
+	return append(resp.Sig[:], append(seqBuf[:], resp.V[:]...)...)
 }
 
 // PutRecord godoc
@@ -92,7 +97,9 @@ func (r *DHTRouter) GetRecord(c *gin.Context) {
 //	@Param			id		path	string	true	"ID of the record to put"
 //	@Param			request	body	[]byte	true	"64 bytes sig, 8 bytes u64 big-endian seq, 0-1000 bytes of v."
 //	@Success		200
-//	@Failure		400	{string}	string	"Bad request"
+//	@Failure		400	{string}	string	"Bad request, including a record that is not a valid DID document in strict validation mode"
+//	@Failure		403	{string}	string	"Record is blocked by the gateway"
+//	@Failure		409	{string}	string	"Record conflicts with a stored record"
 //	@Failure		500	{string}	string	"Internal server error"
 //	@Router			/{id} [put]
 func (r *DHTRouter) PutRecord(c *gin.Context) {
@@ -138,6 +145,19 @@ func (r *DHTRouter) PutRecord(c *gin.Context) {
 	}
 
 	if err = r.service.PublishDHT(ctx, *id, *request); err != nil {
+		if errors.Is(err, service.ErrRecordBlocked) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("dht record %s is blocked", *id), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, dht.ErrStaleSequenceNumber) || errors.Is(err, dht.ErrLowerPayload) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("dht record %s conflicts with a stored record", *id), http.StatusConflict)
+			return
+		}
+		var invalidErr *did.InvalidDocumentError
+		if errors.As(err, &invalidErr) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("dht record %s is not a valid did document", *id), http.StatusBadRequest)
+			return
+		}
 		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to publish dht record: %s", *id), http.StatusInternalServerError)
 		return
 	}
@@ -2,20 +2,25 @@ package server
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/TBD54566975/did-dht/config"
 	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/internal/util"
 	"github.com/TBD54566975/did-dht/pkg/dht"
 	"github.com/TBD54566975/did-dht/pkg/service"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 	"github.com/TBD54566975/did-dht/pkg/storage"
 )
 
@@ -163,6 +168,54 @@ func TestDHTRouter(t *testing.T) {
 	})
 }
 
+func TestDHTRouterStrictValidation(t *testing.T) {
+	strictConfig := config.GetDefaultConfig()
+	strictConfig.ServerConfig.StorageURI = "bolt://strict-validation.db"
+	strictConfig.DHTConfig.StrictValidation = true
+	t.Cleanup(func() { os.Remove("strict-validation.db") })
+
+	db, err := storage.NewStorage(strictConfig.ServerConfig.StorageURI)
+	require.NoError(t, err)
+	dhtSvc, err := service.NewDHTService(&strictConfig, db, dht.NewTestDHT(t))
+	require.NoError(t, err)
+	dhtRouter, err := NewDHTRouter(dhtSvc)
+	require.NoError(t, err)
+
+	defer dhtSvc.Close()
+
+	t.Run("test put valid document", func(t *testing.T) {
+		didID, reqData := generateDIDPutRequest(t)
+
+		w := httptest.NewRecorder()
+		suffix, err := did.DHT(didID).Suffix()
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", testServerURL, suffix), bytes.NewReader(reqData))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: suffix})
+
+		dhtRouter.PutRecord(c)
+		assert.True(t, is2xxResponse(w.Code), "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put invalid document", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		doc.AssertionMethod = append(doc.AssertionMethod, doc.ID+"#missing")
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		suffix, reqData := putRequestFromPacket(t, sk, packet)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", testServerURL, suffix), bytes.NewReader(reqData))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: suffix})
+
+		dhtRouter.PutRecord(c)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		body, err := io.ReadAll(w.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "is not a valid did document")
+	})
+}
+
 func testDHTService(t *testing.T) service.DHTService {
 	defaultConfig := config.GetDefaultConfig()
 
@@ -188,12 +241,18 @@ func generateDIDPutRequest(t *testing.T) (string, []byte) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, packet)
 
-	bep44Put, err := dht.CreateDNSPublishRequest(sk, *packet)
+	_, reqData := putRequestFromPacket(t, sk, packet)
+	return doc.ID, reqData
+}
+
+// putRequestFromPacket signs the given packet and returns the record's suffix along with the request as sig:seq:v
+func putRequestFromPacket(t *testing.T, sk ed25519.PrivateKey, packet *dns.Msg) (string, []byte) {
+	bep44Put, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, bep44Put)
 
 	// prepare request as sig:seq:v
 	var seqBuf [8]byte
 	binary.BigEndian.PutUint64(seqBuf[:], uint64(bep44Put.Seq))
-	return doc.ID, append(bep44Put.Sig[:], append(seqBuf[:], bep44Put.V.([]byte)...)...)
+	return util.Z32Encode(bep44Put.K[:]), append(bep44Put.Sig[:], append(seqBuf[:], bep44Put.V.([]byte)...)...)
 }
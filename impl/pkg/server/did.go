@@ -0,0 +1,521 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	ssiutil "github.com/TBD54566975/ssi-sdk/util"
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/internal/util"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/service"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+// DIDRouter is the router for the DID API
+type DIDRouter struct {
+	service   *service.DHTService
+	retention *service.RetentionService
+}
+
+// NewDIDRouter returns a new instance of the DID router
+func NewDIDRouter(service *service.DHTService, retention *service.RetentionService) (*DIDRouter, error) {
+	return &DIDRouter{service: service, retention: retention}, nil
+}
+
+// GetDIDResponse is the response to a DID resolution request https://did-dht.com/#resolving-a-did
+type GetDIDResponse struct {
+	// DID is the resolved DID Document
+	DID didsdk.Document `json:"did"`
+	// DHT is the unpadded base64URL encoding of the full BEP44 payload as 64 bytes sig, 8 bytes u64
+	// big-endian seq, and 0-1000 bytes of v concatenated, enabling independent verification
+	DHT string `json:"dht"`
+	// Types is the list of type integers the DID has indexed itself as
+	Types []did.TypeIndex `json:"types,omitempty"`
+	// SequenceNumbers is the sorted list of sequence numbers seen for the DID
+	SequenceNumbers []int64 `json:"sequence_numbers,omitempty"`
+	// Expiry is the Unix Timestamp in seconds at which the DID will be evicted from the Retained DID Set
+	Expiry int64 `json:"expiry,omitempty"`
+	// DocumentMetadata is the DID Document metadata https://did-dht.com/#did-document-metadata
+	DocumentMetadata did.DocumentMetadata `json:"didDocumentMetadata"`
+	// ResolutionMetadata is the DID Resolution metadata https://did-dht.com/#did-resolution-metadata
+	ResolutionMetadata did.ResolutionMetadata `json:"didResolutionMetadata"`
+}
+
+// GetDID godoc
+//
+//	@Summary		Resolve a DID
+//	@Description	Resolve a DID from the DHT, returning its DID Document along with the BEP44 payload it was decoded from
+//	@Description	Historical versions of the DID can be resolved by their sequence number
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		string	true	"ID of the DID to resolve"
+//	@Param			seq	query		integer	false	"Sequence number of the DID to resolve"
+//	@Success		200	{object}	GetDIDResponse
+//	@Failure		400	{string}	string	"Invalid request"
+//	@Failure		404	{string}	string	"DID not found"
+//	@Failure		429	{string}	string	"Too many requests"
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Router			/did/{id} [get]
+func (r *DIDRouter) GetDID(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "DIDHTTP.GetDID")
+	defer span.End()
+
+	id := GetParam(c, IDParam)
+	if id == nil || *id == "" {
+		LoggingRespondErrMsg(c, "missing id param", http.StatusBadRequest)
+		return
+	}
+
+	suffix, err := didSuffixFromParam(*id)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid did: %s", *id), http.StatusBadRequest)
+		return
+	}
+
+	var seq *int64
+	if seqParam := GetQueryValue(c, SeqParam); seqParam != nil {
+		parsed, err := strconv.ParseInt(*seqParam, 10, 64)
+		if err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid seq: %s", *seqParam), http.StatusBadRequest)
+			return
+		}
+		seq = &parsed
+	}
+
+	resolved, err := r.service.ResolveDID(ctx, suffix, seq)
+	if err != nil {
+		if errors.Is(err, service.SpamError) {
+			LoggingRespondErrMsg(c, fmt.Sprintf("too many requests for bad key %s", suffix), http.StatusTooManyRequests)
+			return
+		}
+
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to resolve did: %s", *id), http.StatusInternalServerError)
+		return
+	}
+	if resolved == nil {
+		if seq != nil {
+			LoggingRespondErrMsg(c, fmt.Sprintf("did not found for seq %d: %s", *seq, *id), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrMsg(c, fmt.Sprintf("did not found: %s", *id), http.StatusNotFound)
+		return
+	}
+
+	Respond(c, GetDIDResponse{
+		DID:                resolved.Document,
+		DHT:                base64.RawURLEncoding.EncodeToString(encodeBEP44Payload(resolved.Payload)),
+		Types:              resolved.DocumentMetadata.Types,
+		SequenceNumbers:    resolved.SequenceNumbers,
+		Expiry:             resolved.DocumentMetadata.Expiry,
+		DocumentMetadata:   resolved.DocumentMetadata,
+		ResolutionMetadata: resolved.ResolutionMetadata,
+	}, http.StatusOK)
+}
+
+// GetDIDLineageResponse is the response to a request for the lineage of a DID https://did-dht.com/#rotation
+type GetDIDLineageResponse struct {
+	// Lineage is the verified chain of DIDs the DID was rotated from, starting at the DID
+	Lineage []did.LineageLink `json:"lineage"`
+}
+
+// GetDIDLineage godoc
+//
+//	@Summary		Verify the lineage of a DID
+//	@Description	Follow the previous DID records of a DID back through the DIDs it was rotated from, verifying the
+//	@Description	signature of each, and return the chain of DIDs starting at the DID
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		string	true	"ID of the DID whose lineage to verify"
+//	@Param			controller	query		boolean	false	"Require each previous DID to name its successor as a controller"
+//	@Success		200			{object}	GetDIDLineageResponse
+//	@Failure		400			{string}	string	"Invalid request"
+//	@Failure		404			{string}	string	"DID not found"
+//	@Failure		422			{string}	string	"Lineage cannot be verified"
+//	@Failure		500			{string}	string	"Internal server error"
+//	@Router			/did/{id}/lineage [get]
+func (r *DIDRouter) GetDIDLineage(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "DIDHTTP.GetDIDLineage")
+	defer span.End()
+
+	id := GetParam(c, IDParam)
+	if id == nil || *id == "" {
+		LoggingRespondErrMsg(c, "missing id param", http.StatusBadRequest)
+		return
+	}
+	suffix, err := didSuffixFromParam(*id)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid did: %s", *id), http.StatusBadRequest)
+		return
+	}
+
+	var opts did.LineageOpts
+	if controllerParam := GetQueryValue(c, ControllerParam); controllerParam != nil {
+		if opts.RequireController, err = strconv.ParseBool(*controllerParam); err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid controller: %s", *controllerParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	lineage, err := r.service.ResolveLineage(ctx, suffix, opts)
+	if err != nil {
+		var lineageErr *did.LineageError
+		switch {
+		case errors.Is(err, did.ErrDIDNotFound):
+			LoggingRespondErrMsg(c, fmt.Sprintf("did not found: %s", *id), http.StatusNotFound)
+		case errors.As(err, &lineageErr):
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("lineage of did %s cannot be verified", *id), http.StatusUnprocessableEntity)
+		default:
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to resolve lineage of did: %s", *id), http.StatusInternalServerError)
+		}
+		return
+	}
+	Respond(c, GetDIDLineageResponse{Lineage: lineage}, http.StatusOK)
+}
+
+// PublishDIDRequest is the request to register or update a DID https://did-dht.com/#register-or-update-a-did
+type PublishDIDRequest struct {
+	// DID is the DID to register or update
+	DID string `json:"did" validate:"required"`
+	// Sig is the unpadded base64URL-encoded signature of the BEP44 payload
+	Sig string `json:"sig" validate:"required"`
+	// Seq is the sequence number for the request, a Unix Timestamp in seconds
+	Seq int64 `json:"seq" validate:"required"`
+	// V is the unpadded base64URL-encoded bencoded compressed DNS packet containing the DID Document
+	V string `json:"v" validate:"required"`
+	// RetentionSolution is an optional retention solution https://did-dht.com/#generating-a-retention-solution
+	RetentionSolution *string `json:"retention_solution,omitempty"`
+}
+
+// PublishDIDResponse is the response to a request to register or update a DID
+type PublishDIDResponse struct {
+	// Expiry is the Unix Timestamp in seconds at which the DID will be evicted from the Retained DID Set
+	Expiry int64 `json:"expiry"`
+}
+
+// PutDID godoc
+//
+//	@Summary		Register or update a DID
+//	@Description	Register or update a DID by publishing its signed BEP44 payload to the DHT
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"ID of the DID to publish"
+//	@Param			request	body		PublishDIDRequest	true	"Publish DID Request"
+//	@Success		202		{object}	PublishDIDResponse
+//	@Failure		400		{string}	string	"Invalid request, including an invalid retention solution, or a DID document that is not valid in strict validation mode"
+//	@Failure		401		{string}	string	"Invalid signature"
+//	@Failure		403		{string}	string	"DID is blocked by the gateway"
+//	@Failure		409		{string}	string	"DID already exists with a higher sequence number"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Failure		503		{string}	string	"Retention sets have been temporarily disabled"
+//	@Router			/did/{id} [put]
+func (r *DIDRouter) PutDID(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "DIDHTTP.PutDID")
+	defer span.End()
+
+	id := GetParam(c, IDParam)
+	if id == nil || *id == "" {
+		LoggingRespondErrMsg(c, "missing id param", http.StatusBadRequest)
+		return
+	}
+	suffix, err := didSuffixFromParam(*id)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid did: %s", *id), http.StatusBadRequest)
+		return
+	}
+
+	var request PublishDIDRequest
+	if err = json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		LoggingRespondErrWithMsg(c, err, "invalid publish did request", http.StatusBadRequest)
+		return
+	}
+	if err = ssiutil.IsValidStruct(request); err != nil {
+		LoggingRespondErrWithMsg(c, err, "invalid publish did request", http.StatusBadRequest)
+		return
+	}
+	requestSuffix, err := didSuffixFromParam(request.DID)
+	if err != nil || requestSuffix != suffix {
+		LoggingRespondErrMsg(c, fmt.Sprintf("request did %s does not match did: %s", request.DID, *id), http.StatusBadRequest)
+		return
+	}
+
+	if request.RetentionSolution != nil {
+		if err = r.retention.ValidateSolution(ctx, did.Prefix+":"+suffix, *request.RetentionSolution); err != nil {
+			if errors.Is(err, service.ErrRetentionDisabled) {
+				LoggingRespondErrWithMsg(c, err, "retention sets have been temporarily disabled", http.StatusServiceUnavailable)
+				return
+			}
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid retention solution for did: %s", request.DID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// transform the request into a service request by decoding the fields
+	sig, err := base64.RawURLEncoding.DecodeString(request.Sig)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, "invalid sig", http.StatusBadRequest)
+		return
+	}
+	v, err := base64.RawURLEncoding.DecodeString(request.V)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, "invalid v", http.StatusBadRequest)
+		return
+	}
+	key, err := util.Z32Decode(suffix)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid did: %s", *id), http.StatusBadRequest)
+		return
+	}
+	record, err := dht.NewBEP44Record(key, v, sig, request.Seq)
+	if err != nil {
+		if errors.Is(err, dht.ErrInvalidSignature) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid signature for did: %s", request.DID), http.StatusUnauthorized)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, "error parsing request", http.StatusBadRequest)
+		return
+	}
+
+	if err = r.service.PublishDHT(ctx, suffix, *record); err != nil {
+		if errors.Is(err, service.ErrRecordBlocked) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("did %s is blocked", request.DID), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, dht.ErrStaleSequenceNumber) || errors.Is(err, dht.ErrLowerPayload) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("did %s conflicts with a stored record", request.DID), http.StatusConflict)
+			return
+		}
+		var invalidErr *did.InvalidDocumentError
+		if errors.As(err, &invalidErr) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("did %s is not a valid did document", request.DID), http.StatusBadRequest)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to publish did: %s", request.DID), http.StatusInternalServerError)
+		return
+	}
+
+	if request.RetentionSolution != nil {
+		if _, err = r.service.RetainDHT(ctx, suffix, r.retention.RetentionExpiry(time.Now())); err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to retain did: %s", request.DID), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	expiry, err := r.service.GetDHTExpiry(ctx, suffix)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to get expiry of did: %s", request.DID), http.StatusInternalServerError)
+		return
+	}
+	Respond(c, PublishDIDResponse{Expiry: expiry.Unix()}, http.StatusAccepted)
+}
+
+// LintDIDRequest is the request to lint a DID before it is published, holding either its DID DHT Document or its
+// DNS packet
+type LintDIDRequest struct {
+	// Document is the DID DHT Document to lint, along with its types, gateways and previous DID
+	Document *did.DIDDHTDocument `json:"document,omitempty"`
+	// DID is the DID whose DNS packet is given in V
+	DID string `json:"did,omitempty"`
+	// V is the unpadded base64URL-encoded DNS packet to lint
+	V string `json:"v,omitempty"`
+}
+
+// LintDIDResponse is the response to a request to lint a DID
+type LintDIDResponse struct {
+	// Findings are the advisory findings for the DID, with their severities
+	Findings []did.LintFinding `json:"findings"`
+}
+
+// LintDID godoc
+//
+//	@Summary		Lint a DID
+//	@Description	Lint a DID DHT Document, or the DNS packet of a DID, returning advisory findings with their severities
+//	@Description	Documents that are not valid are reported with findings of the error severity
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		LintDIDRequest	true	"Lint DID Request"
+//	@Success		200		{object}	LintDIDResponse
+//	@Failure		400		{string}	string	"Invalid request"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/did/lint [post]
+func (r *DIDRouter) LintDID(c *gin.Context) {
+	_, span := telemetry.GetTracer().Start(c, "DIDHTTP.LintDID")
+	defer span.End()
+
+	var request LintDIDRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		LoggingRespondErrWithMsg(c, err, "invalid lint did request", http.StatusBadRequest)
+		return
+	}
+
+	var findings []did.LintFinding
+	switch {
+	case request.Document != nil && request.V == "":
+		if _, err := didSuffixFromParam(request.Document.Doc.ID); err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid did: %s", request.Document.Doc.ID), http.StatusBadRequest)
+			return
+		}
+		lint, err := did.LintDocument(*request.Document)
+		if err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to lint did: %s", request.Document.Doc.ID), http.StatusBadRequest)
+			return
+		}
+		findings = lint
+	case request.Document == nil && request.V != "":
+		suffix, err := didSuffixFromParam(request.DID)
+		if err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid did: %s", request.DID), http.StatusBadRequest)
+			return
+		}
+		v, err := base64.RawURLEncoding.DecodeString(request.V)
+		if err != nil {
+			LoggingRespondErrWithMsg(c, err, "invalid v", http.StatusBadRequest)
+			return
+		}
+		msg, err := did.UnpackDNSPacket(v)
+		if err != nil {
+			LoggingRespondErrWithMsg(c, err, "invalid dns packet", http.StatusBadRequest)
+			return
+		}
+		lint, err := did.DHT(did.Prefix + ":" + suffix).LintDNSPacket(msg)
+		if err != nil {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to lint did: %s", request.DID), http.StatusInternalServerError)
+			return
+		}
+		findings = lint
+	default:
+		LoggingRespondErrMsg(c, "lint did request must hold either a document or a did and v", http.StatusBadRequest)
+		return
+	}
+
+	if findings == nil {
+		findings = []did.LintFinding{}
+	}
+	Respond(c, LintDIDResponse{Findings: findings}, http.StatusOK)
+}
+
+// TypeResponse describes a type in the Indexed Types registry
+type TypeResponse struct {
+	// Type is the integer representing the type
+	Type did.TypeIndex `json:"type"`
+	// Description is the description of the type
+	Description string `json:"description"`
+}
+
+// GetTypes godoc
+//
+//	@Summary		List the indexed types
+//	@Description	List the types from the Indexed Types registry the gateway indexes DIDs by
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	TypeResponse
+//	@Router			/did/types [get]
+func (r *DIDRouter) GetTypes(c *gin.Context) {
+	_, span := telemetry.GetTracer().Start(c, "DIDHTTP.GetTypes")
+	defer span.End()
+
+	types := did.RegisteredTypes()
+	response := make([]TypeResponse, 0, len(types))
+	for _, t := range types {
+		description, _ := t.Description()
+		response = append(response, TypeResponse{Type: t, Description: description})
+	}
+	Respond(c, response, http.StatusOK)
+}
+
+// GetDIDsForType godoc
+//
+//	@Summary		List the DIDs of a type
+//	@Description	List the identifiers of DIDs indexed under the given type
+//	@Tags			DID
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		integer	true	"Type to query from the index"
+//	@Param			offset	query		integer	false	"Starting position of the DIDs to retrieve (default 0)"
+//	@Param			limit	query		integer	false	"Maximum number of DIDs to retrieve (default 100)"
+//	@Success		200		{array}		string
+//	@Failure		400		{string}	string	"Invalid request"
+//	@Failure		404		{string}	string	"Type not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/did/types/{id} [get]
+func (r *DIDRouter) GetDIDsForType(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "DIDHTTP.GetDIDsForType")
+	defer span.End()
+
+	id := GetParam(c, IDParam)
+	if id == nil || *id == "" {
+		LoggingRespondErrMsg(c, "missing id param", http.StatusBadRequest)
+		return
+	}
+	typ, err := strconv.Atoi(*id)
+	if err != nil {
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("invalid type: %s", *id), http.StatusBadRequest)
+		return
+	}
+	offset, err := intQueryValue(c, OffsetParam, 0)
+	if err != nil || offset < 0 {
+		LoggingRespondErrMsg(c, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryValue(c, LimitParam, DefaultTypeLimit)
+	if err != nil || limit < 1 || limit > MaxTypeLimit {
+		LoggingRespondErrMsg(c, fmt.Sprintf("invalid limit, must be between 1 and %d", MaxTypeLimit), http.StatusBadRequest)
+		return
+	}
+
+	dids, err := r.service.ListDIDsForType(ctx, did.TypeIndex(typ), offset, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrTypeNotFound) {
+			LoggingRespondErrWithMsg(c, err, fmt.Sprintf("type not found: %d", typ), http.StatusNotFound)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, fmt.Sprintf("failed to list dids for type: %d", typ), http.StatusInternalServerError)
+		return
+	}
+	Respond(c, dids, http.StatusOK)
+}
+
+// intQueryValue returns the integer value of the given query parameter, or the default if it is not set
+func intQueryValue(c *gin.Context, param string, defaultValue int) (int, error) {
+	value := GetQueryValue(c, param)
+	if value == nil {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(*value)
+}
+
+// didSuffixFromParam accepts either a full did:dht identifier or its z-base-32 suffix and returns the suffix,
+// making sure it represents a valid ed25519 public key
+func didSuffixFromParam(id string) (string, error) {
+	suffix := id
+	if strings.HasPrefix(id, did.Prefix+":") {
+		s, err := did.DHT(id).Suffix()
+		if err != nil {
+			return "", err
+		}
+		suffix = s
+	}
+	key, err := util.Z32Decode(suffix)
+	if err != nil {
+		return "", err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("invalid z32 encoded ed25519 public key: %s", suffix)
+	}
+	return suffix, nil
+}
@@ -0,0 +1,603 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+func TestDIDRouter(t *testing.T) {
+	dhtSvc := testDHTService(t)
+	dhtRouter, err := NewDHTRouter(&dhtSvc)
+	require.NoError(t, err)
+	require.NotEmpty(t, dhtRouter)
+	retentionSvc := testRetentionService(t)
+	didRouter, err := NewDIDRouter(&dhtSvc, retentionSvc)
+	require.NoError(t, err)
+	require.NotEmpty(t, didRouter)
+
+	defer dhtSvc.Close()
+	defer retentionSvc.Close()
+
+	t.Run("test get did", func(t *testing.T) {
+		didID, reqData := generateDIDPutRequest(t)
+
+		w := httptest.NewRecorder()
+		suffix, err := did.DHT(didID).Suffix()
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", testServerURL, suffix), bytes.NewReader(reqData))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: suffix})
+
+		dhtRouter.PutRecord(c)
+		require.True(t, is2xxResponse(w.Code), "unexpected %s", w.Result().Status)
+
+		// resolve by both the full identifier and the suffix
+		for _, id := range []string{didID, suffix} {
+			w = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/%s", testServerURL, id), nil)
+			c = newRequestContextWithParams(w, req, map[string]string{IDParam: id})
+
+			didRouter.GetDID(c)
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+			var resp GetDIDResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, didID, resp.DID.ID)
+			assert.Len(t, resp.SequenceNumbers, 1)
+
+			dhtBytes, err := base64.RawURLEncoding.DecodeString(resp.DHT)
+			require.NoError(t, err)
+			assert.Equal(t, reqData, dhtBytes)
+		}
+	})
+
+	t.Run("test get did with types", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		types := []did.TypeIndex{did.Organization, did.FinancialInstitution}
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, types, nil, nil)
+		require.NoError(t, err)
+		suffix, reqData := putRequestFromPacket(t, sk, packet)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", testServerURL, suffix), bytes.NewReader(reqData))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: suffix})
+		dhtRouter.PutRecord(c)
+		require.True(t, is2xxResponse(w.Code), "unexpected %s", w.Result().Status)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/%s", testServerURL, doc.ID), nil)
+		c = newRequestContextWithParams(w, req, map[string]string{IDParam: doc.ID})
+		didRouter.GetDID(c)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var resp GetDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, types, resp.Types)
+		assert.Equal(t, types, resp.DocumentMetadata.Types)
+		assert.False(t, resp.DocumentMetadata.Deactivated)
+	})
+
+	t.Run("test get deactivated did", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		packet, err := did.DHT(doc.ID).CreateDeactivatedPacket()
+		require.NoError(t, err)
+		suffix, reqData := putRequestFromPacket(t, sk, packet)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", testServerURL, suffix), bytes.NewReader(reqData))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: suffix})
+		dhtRouter.PutRecord(c)
+		require.True(t, is2xxResponse(w.Code), "unexpected %s", w.Result().Status)
+
+		w = getDID(t, didRouter, doc.ID, "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var resp GetDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.True(t, resp.DocumentMetadata.Deactivated)
+		assert.Equal(t, doc.ID, resp.DID.ID)
+		assert.Empty(t, resp.DID.VerificationMethod)
+	})
+
+	t.Run("test get did not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		id := "did:dht:uqaj3fcr9db6jg6o9pjs53iuftyj45r46aubogfaceqjbo6pp9sy"
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/%s", testServerURL, id), nil)
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: id})
+		didRouter.GetDID(c)
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test get malformed did", func(t *testing.T) {
+		for _, id := range []string{"did:dht:----", "did:example:1234", "aaaa", "did:dht:"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/%s", testServerURL, id), nil)
+			c := newRequestContextWithParams(w, req, map[string]string{IDParam: id})
+			didRouter.GetDID(c)
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s for %s", w.Result().Status, id)
+		}
+	})
+
+	t.Run("test put did", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		request := generatePublishDIDRequest(t, sk, *doc, 100)
+		w := putDID(t, didRouter, doc.ID, request)
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var resp PublishDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Greater(t, resp.Expiry, time.Now().Unix())
+
+		// resolve it back
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/%s", testServerURL, doc.ID), nil)
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: doc.ID})
+		didRouter.GetDID(c)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var getResp GetDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&getResp))
+		assert.Equal(t, doc.ID, getResp.DID.ID)
+		assert.Equal(t, []int64{100}, getResp.SequenceNumbers)
+		assert.Equal(t, resp.Expiry, getResp.Expiry)
+	})
+
+	t.Run("test get did history", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		first := generatePublishDIDRequest(t, sk, *doc, 100)
+		w := putDID(t, didRouter, doc.ID, first)
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		w = putDID(t, didRouter, doc.ID, generatePublishDIDRequest(t, sk, *doc, 200))
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		w = getDID(t, didRouter, doc.ID, "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		var resp GetDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, []int64{100, 200}, resp.SequenceNumbers)
+		assert.Equal(t, "200", resp.DocumentMetadata.VersionID)
+		assert.Equal(t, "1970-01-01T00:01:40Z", resp.DocumentMetadata.Created)
+		assert.Equal(t, "1970-01-01T00:03:20Z", resp.DocumentMetadata.Updated)
+		assert.NotEmpty(t, resp.ResolutionMetadata.Gateway)
+
+		// resolve the first version
+		w = getDID(t, didRouter, doc.ID, "100")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		resp = GetDIDResponse{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, doc.ID, resp.DID.ID)
+		dhtBytes, err := base64.RawURLEncoding.DecodeString(resp.DHT)
+		require.NoError(t, err)
+		sig, err := base64.RawURLEncoding.DecodeString(first.Sig)
+		require.NoError(t, err)
+		assert.Equal(t, sig, dhtBytes[:64])
+		assert.Equal(t, "100", resp.DocumentMetadata.VersionID)
+		assert.Equal(t, "1970-01-01T00:03:20Z", resp.DocumentMetadata.Updated)
+
+		// unknown and malformed sequence numbers
+		w = getDID(t, didRouter, doc.ID, "150")
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		w = getDID(t, didRouter, doc.ID, "latest")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put did stale sequence number", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		w := putDID(t, didRouter, doc.ID, generatePublishDIDRequest(t, sk, *doc, 200))
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		w = putDID(t, didRouter, doc.ID, generatePublishDIDRequest(t, sk, *doc, 199))
+		assert.Equal(t, http.StatusConflict, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put did conflicting payload", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		// two different documents published with the same sequence number
+		first := generatePublishDIDRequest(t, sk, *doc, 300)
+		doc.AlsoKnownAs = []string{"https://example.com"}
+		second := generatePublishDIDRequest(t, sk, *doc, 300)
+
+		higher, lower := first, second
+		if first.V < second.V {
+			higher, lower = second, first
+		}
+		w := putDID(t, didRouter, doc.ID, higher)
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		w = putDID(t, didRouter, doc.ID, lower)
+		assert.Equal(t, http.StatusConflict, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		// resubmitting the accepted record is fine
+		w = putDID(t, didRouter, doc.ID, higher)
+		assert.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put did invalid signature", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		request := generatePublishDIDRequest(t, sk, *doc, 100)
+		request.Seq = 101
+		w := putDID(t, didRouter, doc.ID, request)
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put did bad requests", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		// did does not match the path
+		_, otherDoc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		w := putDID(t, didRouter, otherDoc.ID, generatePublishDIDRequest(t, sk, *doc, 100))
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		// missing fields
+		request := generatePublishDIDRequest(t, sk, *doc, 100)
+		request.V = ""
+		w = putDID(t, didRouter, doc.ID, request)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		// undecodable sig
+		request = generatePublishDIDRequest(t, sk, *doc, 100)
+		request.Sig = "not base64!"
+		w = putDID(t, didRouter, doc.ID, request)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		// malformed body
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/did/%s", testServerURL, doc.ID), bytes.NewReader([]byte("{")))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: doc.ID})
+		didRouter.PutDID(c)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put did with retention solution", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		challenge, err := retentionSvc.GetChallenge(context.Background())
+		require.NoError(t, err)
+		solution, err := did.FindRetentionSolution(doc.ID, challenge.Hash, challenge.Difficulty)
+		require.NoError(t, err)
+
+		request := generatePublishDIDRequest(t, sk, *doc, 100)
+		request.RetentionSolution = &solution
+		w := putDID(t, didRouter, doc.ID, request)
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var resp PublishDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.GreaterOrEqual(t, resp.Expiry, challenge.Expiry)
+
+		// the expiry is returned on resolution
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/%s", testServerURL, doc.ID), nil)
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: doc.ID})
+		didRouter.GetDID(c)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var getResp GetDIDResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&getResp))
+		assert.Equal(t, resp.Expiry, getResp.Expiry)
+	})
+
+	t.Run("test put did with invalid retention solution", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		request := generatePublishDIDRequest(t, sk, *doc, 100)
+		solution := "000000270b7c547aff552f302aad08200b3db815b69bc11ec3f263b7ef755a52:1"
+		request.RetentionSolution = &solution
+		w := putDID(t, didRouter, doc.ID, request)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test put did with retention disabled", func(t *testing.T) {
+		disabledRouter, err := NewDIDRouter(&dhtSvc, nil)
+		require.NoError(t, err)
+
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		request := generatePublishDIDRequest(t, sk, *doc, 100)
+		solution := "000000270b7c547aff552f302aad08200b3db815b69bc11ec3f263b7ef755a52:1"
+		request.RetentionSolution = &solution
+		w := putDID(t, disabledRouter, doc.ID, request)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test get types", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/did/types", testServerURL), nil)
+		c := newRequestContext(w, req)
+		didRouter.GetTypes(c)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var resp []TypeResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Len(t, resp, len(did.RegisteredTypes()))
+		assert.Contains(t, resp, TypeResponse{Type: did.FinancialInstitution, Description: "Financial Institution"})
+	})
+
+	t.Run("test get dids for type", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, []did.TypeIndex{did.FinancialInstitution}, nil, nil)
+		require.NoError(t, err)
+		suffix, reqData := putRequestFromPacket(t, sk, packet)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", testServerURL, suffix), bytes.NewReader(reqData))
+		c := newRequestContextWithParams(w, req, map[string]string{IDParam: suffix})
+		dhtRouter.PutRecord(c)
+		require.True(t, is2xxResponse(w.Code), "unexpected %s", w.Result().Status)
+
+		w = getDIDsForType(t, didRouter, "7", "")
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		var dids []string
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&dids))
+		assert.Contains(t, dids, doc.ID)
+
+		// no dids of a type is an empty array
+		w = getDIDsForType(t, didRouter, "7", "offset=1000")
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		assert.JSONEq(t, "[]", w.Body.String())
+
+		w = getDIDsForType(t, didRouter, "100", "")
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		for _, query := range []string{"offset=-1", "offset=bad", "limit=0", "limit=100000"} {
+			w = getDIDsForType(t, didRouter, "7", query)
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s for %s", w.Result().Status, query)
+		}
+		w = getDIDsForType(t, didRouter, "bad", "")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test lint did", func(t *testing.T) {
+		_, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{
+			Services: []didsdk.Service{{ID: "vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"http://example.com/vc/"}}},
+		})
+		require.NoError(t, err)
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+
+		for _, request := range []LintDIDRequest{
+			{Document: &did.DIDDHTDocument{Doc: *doc}},
+			{DID: doc.ID, V: base64.RawURLEncoding.EncodeToString(packed)},
+		} {
+			w := lintDID(t, didRouter, request)
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+			var resp LintDIDResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, []did.LintFinding{
+				{Rule: did.KeyAgreementRule, Severity: did.SeverityWarning, Message: "no keyAgreement key, so the DID cannot receive encrypted messages"},
+				{Rule: did.HTTPSEndpointRule, Severity: did.SeverityWarning, Message: "service " + doc.ID + "#vcs has an endpoint that is not an https url: http://example.com/vc/"},
+			}, resp.Findings)
+		}
+
+		// gateways used to be published as TXT records with an NS header, which the gateway still resolves
+		suffix, err := did.DHT(doc.ID).Suffix()
+		require.NoError(t, err)
+		packet.Answer = append(packet.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: "_did." + suffix + ".", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 7200},
+			Txt: []string{"gateway1.example-did-dht-gateway.com"},
+		})
+		legacy, err := packet.Pack()
+		require.NoError(t, err)
+		w := lintDID(t, didRouter, LintDIDRequest{DID: doc.ID, V: base64.RawURLEncoding.EncodeToString(legacy)})
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		for _, request := range []LintDIDRequest{
+			{},
+			{Document: &did.DIDDHTDocument{Doc: *doc}, DID: doc.ID, V: base64.RawURLEncoding.EncodeToString(packed)},
+			{Document: &did.DIDDHTDocument{Doc: didsdk.Document{ID: "did:example:abcd"}}},
+			{DID: doc.ID, V: "not a dns packet"},
+		} {
+			w := lintDID(t, didRouter, request)
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		}
+	})
+
+	t.Run("test get did lineage", func(t *testing.T) {
+		previousSK, previousDoc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		previousDID, err := did.CreatePreviousDIDRecord(signer.NewInMemorySigner(previousSK), did.DHT(previousDoc.ID), did.DHT(doc.ID))
+		require.NoError(t, err)
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, previousDID)
+		require.NoError(t, err)
+
+		w := putDID(t, didRouter, doc.ID, publishDIDRequestFromPacket(t, sk, doc.ID, packet, 100))
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		// the previous DID has not been published, so it is not resolved
+		w = getDIDLineage(t, didRouter, doc.ID, "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		var resp GetDIDLineageResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, []did.LineageLink{{DID: did.DHT(doc.ID), Resolved: true}, {DID: did.DHT(previousDoc.ID)}}, resp.Lineage)
+
+		// once published without naming its successor as a controller, the controller check fails
+		w = putDID(t, didRouter, previousDoc.ID, generatePublishDIDRequest(t, previousSK, *previousDoc, 100))
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		w = getDIDLineage(t, didRouter, doc.ID, "true")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		previousDoc.Controller = doc.ID
+		w = putDID(t, didRouter, previousDoc.ID, generatePublishDIDRequest(t, previousSK, *previousDoc, 200))
+		require.Equal(t, http.StatusAccepted, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		w = getDIDLineage(t, didRouter, doc.ID, "true")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		resp = GetDIDLineageResponse{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, []did.LineageLink{{DID: did.DHT(doc.ID), Resolved: true}, {DID: did.DHT(previousDoc.ID), Resolved: true, ControllerConfirmed: true}}, resp.Lineage)
+
+		// unknown DIDs and malformed options
+		_, unknown, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		w = getDIDLineage(t, didRouter, unknown.ID, "")
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+		w = getDIDLineage(t, didRouter, doc.ID, "maybe")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+
+	t.Run("test did routes do not conflict with dht routes", func(t *testing.T) {
+		handler := gin.New()
+		require.NoError(t, DHTAPI(&handler.RouterGroup, &dhtSvc))
+		require.NoError(t, DIDAPI(&handler.RouterGroup, &dhtSvc, retentionSvc))
+		require.NoError(t, RetentionAPI(&handler.RouterGroup, retentionSvc))
+
+		didID, reqData := generateDIDPutRequest(t)
+		suffix, err := did.DHT(didID).Suffix()
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/%s", suffix), bytes.NewReader(reqData))
+		handler.ServeHTTP(w, req)
+		require.True(t, is2xxResponse(w.Code), "unexpected %s", w.Result().Status)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/did/%s", didID), nil)
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/challenge", nil)
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		for _, path := range []string{"/did/types", "/did/types/7"} {
+			w = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, path, nil)
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s for %s", w.Result().Status, path)
+		}
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, "/did/lint", bytes.NewReader([]byte(`{"did":"`+didID+`","v":"`+base64.RawURLEncoding.EncodeToString(reqData[72:])+`"}`)))
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+}
+
+// lintDID sends the given request to lint a DID
+func lintDID(t *testing.T, didRouter *DIDRouter, request LintDIDRequest) *httptest.ResponseRecorder {
+	body, err := json.Marshal(request)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("%s/did/lint", testServerURL), bytes.NewReader(body))
+	c := newRequestContext(w, req)
+	didRouter.LintDID(c)
+	return w
+}
+
+// generatePublishDIDRequest builds a signed publish request for the given document with the given sequence number
+func generatePublishDIDRequest(t *testing.T, sk ed25519.PrivateKey, doc didsdk.Document, seq int64) PublishDIDRequest {
+	packet, err := did.DHT(doc.ID).ToDNSPacket(doc, nil, nil, nil)
+	require.NoError(t, err)
+	return publishDIDRequestFromPacket(t, sk, doc.ID, packet, seq)
+}
+
+// publishDIDRequestFromPacket builds a signed publish request for the given DNS packet with the given sequence number
+func publishDIDRequestFromPacket(t *testing.T, sk ed25519.PrivateKey, id string, packet *dns.Msg, seq int64) PublishDIDRequest {
+	packed, err := packet.Pack()
+	require.NoError(t, err)
+
+	put := bep44.Put{
+		V:   packed,
+		K:   (*[32]byte)(sk.Public().(ed25519.PublicKey)),
+		Seq: seq,
+	}
+	put.Sign(sk)
+
+	return PublishDIDRequest{
+		DID: id,
+		Sig: base64.RawURLEncoding.EncodeToString(put.Sig[:]),
+		Seq: seq,
+		V:   base64.RawURLEncoding.EncodeToString(packed),
+	}
+}
+
+func putDID(t *testing.T, didRouter *DIDRouter, id string, request PublishDIDRequest) *httptest.ResponseRecorder {
+	requestBytes, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/did/%s", testServerURL, id), bytes.NewReader(requestBytes))
+	c := newRequestContextWithParams(w, req, map[string]string{IDParam: id})
+	didRouter.PutDID(c)
+	return w
+}
+
+func getDID(t *testing.T, didRouter *DIDRouter, id, seq string) *httptest.ResponseRecorder {
+	target := fmt.Sprintf("%s/did/%s", testServerURL, id)
+	if seq != "" {
+		target += "?" + SeqParam + "=" + seq
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	c := newRequestContextWithParams(w, req, map[string]string{IDParam: id})
+	didRouter.GetDID(c)
+	return w
+}
+
+func getDIDLineage(t *testing.T, didRouter *DIDRouter, id, controller string) *httptest.ResponseRecorder {
+	target := fmt.Sprintf("%s/did/%s/lineage", testServerURL, id)
+	if controller != "" {
+		target += "?" + ControllerParam + "=" + controller
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	c := newRequestContextWithParams(w, req, map[string]string{IDParam: id})
+	didRouter.GetDIDLineage(c)
+	return w
+}
+
+func getDIDsForType(t *testing.T, didRouter *DIDRouter, typ, query string) *httptest.ResponseRecorder {
+	target := fmt.Sprintf("%s/did/types/%s", testServerURL, typ)
+	if query != "" {
+		target += "?" + query
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	c := newRequestContextWithParams(w, req, map[string]string{IDParam: typ})
+	didRouter.GetDIDsForType(c)
+	return w
+}
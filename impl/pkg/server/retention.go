@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/TBD54566975/did-dht/pkg/service"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+// RetentionRouter is the router for the retention challenge API
+type RetentionRouter struct {
+	service *service.RetentionService
+}
+
+// NewRetentionRouter returns a new instance of the retention router
+func NewRetentionRouter(service *service.RetentionService) (*RetentionRouter, error) {
+	return &RetentionRouter{service: service}, nil
+}
+
+// GetChallengeResponse is the response to a request for the current retention challenge
+type GetChallengeResponse struct {
+	// Hash is the current hash which is to be used as input for computing a retention solution
+	Hash string `json:"hash"`
+	// HashSource is the source of the hash as defined by the Hash Source Registry
+	HashSource string `json:"hash_source"`
+	// Difficulty is the number of bits of leading zeros the resulting hash must contain
+	Difficulty int `json:"difficulty"`
+	// Expiry is the approximate Unix Timestamp in seconds at which a DID retained against this challenge will be evicted
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// GetChallenge godoc
+//
+//	@Summary		Get the current retention challenge
+//	@Description	Get the current retention challenge, used to compute a retention solution when registering a DID
+//	@Tags			Retention
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	GetChallengeResponse
+//	@Failure		500	{string}	string	"Internal server error"
+//	@Failure		503	{string}	string	"Retention sets have been temporarily disabled"
+//	@Router			/challenge [get]
+func (r *RetentionRouter) GetChallenge(c *gin.Context) {
+	ctx, span := telemetry.GetTracer().Start(c, "RetentionHTTP.GetChallenge")
+	defer span.End()
+
+	challenge, err := r.service.GetChallenge(ctx)
+	if err != nil {
+		if errors.Is(err, service.ErrRetentionDisabled) {
+			LoggingRespondErrWithMsg(c, err, "retention sets have been temporarily disabled", http.StatusServiceUnavailable)
+			return
+		}
+		LoggingRespondErrWithMsg(c, err, "failed to get challenge", http.StatusInternalServerError)
+		return
+	}
+
+	Respond(c, GetChallengeResponse{
+		Hash:       challenge.Hash,
+		HashSource: challenge.HashSource,
+		Difficulty: challenge.Difficulty,
+		Expiry:     challenge.Expiry,
+	}, http.StatusOK)
+}
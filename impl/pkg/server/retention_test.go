@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/config"
+	"github.com/TBD54566975/did-dht/pkg/service"
+)
+
+func TestRetentionRouter(t *testing.T) {
+	t.Run("test get challenge", func(t *testing.T) {
+		retentionSvc := testRetentionService(t)
+		defer retentionSvc.Close()
+		retentionRouter, err := NewRetentionRouter(retentionSvc)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/challenge", testServerURL), nil)
+		retentionRouter.GetChallenge(newRequestContext(w, req))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+
+		var resp GetChallengeResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Len(t, resp.Hash, 64)
+		assert.Equal(t, service.LocalHashSourceName, resp.HashSource)
+		assert.Equal(t, 8, resp.Difficulty)
+		assert.NotEmpty(t, resp.Expiry)
+	})
+
+	t.Run("test get challenge disabled", func(t *testing.T) {
+		cfg := config.GetDefaultConfig()
+		cfg.RetentionConfig.Enabled = false
+		retentionSvc, err := service.NewRetentionService(&cfg, nil)
+		require.NoError(t, err)
+		retentionRouter, err := NewRetentionRouter(retentionSvc)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/challenge", testServerURL), nil)
+		retentionRouter.GetChallenge(newRequestContext(w, req))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode, "unexpected %s", w.Result().Status)
+	})
+}
+
+// testRetentionService returns a retention service with a low difficulty so solutions can be found quickly
+func testRetentionService(t *testing.T) *service.RetentionService {
+	cfg := config.GetDefaultConfig()
+	cfg.RetentionConfig.Difficulty = 8
+	retentionSvc, err := service.NewRetentionService(&cfg, service.NewLocalHashSource(t.Name()))
+	require.NoError(t, err)
+	require.NotEmpty(t, retentionSvc)
+	return retentionSvc
+}
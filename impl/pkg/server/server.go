@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
@@ -21,7 +23,22 @@ import (
 )
 
 const (
-	IDParam string = "id"
+	IDParam         string = "id"
+	SeqParam        string = "seq"
+	OffsetParam     string = "offset"
+	LimitParam      string = "limit"
+	ControllerParam string = "controller"
+	PageSizeParam   string = "page_size"
+	PageTokenParam  string = "page_token"
+
+	// DefaultTypeLimit is the number of DIDs returned from the type index when no limit is given
+	DefaultTypeLimit = 100
+	// MaxTypeLimit is the largest number of DIDs that may be requested from the type index at once
+	MaxTypeLimit = 1000
+	// DefaultPageSize is the number of records listed by the admin API when no page size is given
+	DefaultPageSize = 100
+	// MaxPageSize is the largest number of records that may be listed by the admin API at once
+	MaxPageSize = 1000
 )
 
 type Server struct {
@@ -30,8 +47,9 @@ type Server struct {
 
 	shutdown chan os.Signal
 
-	cfg *config.Config
-	svc *service.DHTService
+	cfg       *config.Config
+	svc       *service.DHTService
+	retention *service.RetentionService
 }
 
 // NewServer returns a new instance of Server with the given db and host.
@@ -56,6 +74,16 @@ func NewServer(cfg *config.Config, shutdown chan os.Signal, d *dht.DHT) (*Server
 		return nil, util.LoggingErrorMsg(err, "could not instantiate the dht service")
 	}
 
+	tlsConfig, err := newTLSConfig(cfg.ServerConfig)
+	if err != nil {
+		return nil, util.LoggingErrorMsg(err, "could not configure tls")
+	}
+
+	retentionService, err := newRetentionService(cfg)
+	if err != nil {
+		return nil, util.LoggingErrorMsg(err, "could not instantiate the retention service")
+	}
+
 	handler.GET("/health", Health)
 
 	// set up swagger
@@ -66,6 +94,21 @@ func NewServer(cfg *config.Config, shutdown chan os.Signal, d *dht.DHT) (*Server
 	if err = DHTAPI(&handler.RouterGroup, dhtService); err != nil {
 		return nil, util.LoggingErrorMsg(err, "could not setup the dht API")
 	}
+
+	// did API
+	if err = DIDAPI(&handler.RouterGroup, dhtService, retentionService); err != nil {
+		return nil, util.LoggingErrorMsg(err, "could not setup the did API")
+	}
+
+	// retention challenge API
+	if err = RetentionAPI(&handler.RouterGroup, retentionService); err != nil {
+		return nil, util.LoggingErrorMsg(err, "could not setup the retention API")
+	}
+
+	// admin API
+	if err = AdminAPI(&handler.RouterGroup, dhtService, cfg.ServerConfig); err != nil {
+		return nil, util.LoggingErrorMsg(err, "could not setup the admin API")
+	}
 	return &Server{
 		Server: &http.Server{
 			Addr:              fmt.Sprintf("%s:%d", cfg.ServerConfig.APIHost, cfg.ServerConfig.APIPort),
@@ -74,14 +117,68 @@ func NewServer(cfg *config.Config, shutdown chan os.Signal, d *dht.DHT) (*Server
 			ReadHeaderTimeout: time.Second * 10,
 			WriteTimeout:      time.Second * 10,
 			MaxHeaderBytes:    1 << 20,
+			TLSConfig:         tlsConfig,
 		},
-		cfg:      cfg,
-		svc:      dhtService,
-		handler:  handler,
-		shutdown: shutdown,
+		cfg:       cfg,
+		svc:       dhtService,
+		retention: retentionService,
+		handler:   handler,
+		shutdown:  shutdown,
 	}, nil
 }
 
+// Shutdown gracefully shuts down the http server, then stops the retention service's challenge rotation
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+	s.retention.Close()
+	return err
+}
+
+// newRetentionService instantiates the retention service with the hash source named in the config
+func newRetentionService(cfg *config.Config) (*service.RetentionService, error) {
+	if !cfg.RetentionConfig.Enabled {
+		return service.NewRetentionService(cfg, nil)
+	}
+	source, err := service.NewHashSource(cfg.RetentionConfig)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewRetentionService(cfg, source)
+}
+
+// newTLSConfig returns the TLS config to serve with, or nil if the server is not configured to serve TLS. Client
+// certificates are requested, but only required of requests to the admin API when admin client CAs are configured.
+func newTLSConfig(cfg config.ServerConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		if cfg.AdminClientCAFile != "" {
+			return nil, fmt.Errorf("admin client CA file %s requires a tls cert and key to be configured", cfg.AdminClientCAFile)
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls cert and key: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.AdminClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.AdminClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin client CA file: %w", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in admin client CA file %s", cfg.AdminClientCAFile)
+	}
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
 func setupHandler(env config.Environment) *gin.Engine {
 	gin.ForceConsoleColor()
 	middlewares := gin.HandlersChain{
@@ -116,3 +213,59 @@ func DHTAPI(rg *gin.RouterGroup, service *service.DHTService) error {
 	rg.GET("/:id", dhtRouter.GetRecord)
 	return nil
 }
+
+// DIDAPI sets up the DID API routes according to the spec https://did-dht.com/#gateway-api
+func DIDAPI(rg *gin.RouterGroup, service *service.DHTService, retention *service.RetentionService) error {
+	didRouter, err := NewDIDRouter(service, retention)
+	if err != nil {
+		return util.LoggingErrorMsg(err, "could not instantiate did router")
+	}
+
+	didAPI := rg.Group("/did")
+	didAPI.GET("/types", didRouter.GetTypes)
+	didAPI.GET("/types/:id", didRouter.GetDIDsForType)
+	didAPI.POST("/lint", didRouter.LintDID)
+	didAPI.PUT("/:id", didRouter.PutDID)
+	didAPI.GET("/:id", didRouter.GetDID)
+	didAPI.GET("/:id/lineage", didRouter.GetDIDLineage)
+	return nil
+}
+
+// RetentionAPI sets up the retention challenge routes according to the spec https://did-dht.com/#get-the-current-challenge
+func RetentionAPI(rg *gin.RouterGroup, service *service.RetentionService) error {
+	retentionRouter, err := NewRetentionRouter(service)
+	if err != nil {
+		return util.LoggingErrorMsg(err, "could not instantiate retention router")
+	}
+
+	rg.GET("/challenge", retentionRouter.GetChallenge)
+	return nil
+}
+
+// AdminAPI sets up the admin API routes for gateway operators, which are only served when admin authentication is
+// configured
+func AdminAPI(rg *gin.RouterGroup, service *service.DHTService, cfg config.ServerConfig) error {
+	if cfg.AdminToken == "" && cfg.AdminClientCAFile == "" {
+		logrus.Info("no admin token or client CA configured, not serving the admin API")
+		return nil
+	}
+	adminRouter, err := NewAdminRouter(service)
+	if err != nil {
+		return util.LoggingErrorMsg(err, "could not instantiate admin router")
+	}
+
+	adminAPI := rg.Group("/admin", AdminAuth(cfg))
+	adminAPI.GET("/records", adminRouter.ListRecords)
+	adminAPI.GET("/records/:id", adminRouter.GetRecord)
+	adminAPI.DELETE("/records/:id", adminRouter.DeleteRecord)
+	adminAPI.POST("/records/:id/republish", adminRouter.RepublishRecord)
+	adminAPI.POST("/republish", adminRouter.RepublishAll)
+	adminAPI.GET("/blocked", adminRouter.ListBlockedRecords)
+	adminAPI.PUT("/blocked/:id", adminRouter.BlockRecord)
+	adminAPI.DELETE("/blocked/:id", adminRouter.UnblockRecord)
+	adminAPI.GET("/failed", adminRouter.ListFailedRecords)
+	adminAPI.POST("/failed/:id/retry", adminRouter.RetryFailedRecord)
+	adminAPI.DELETE("/failed/:id", adminRouter.PurgeFailedRecord)
+	adminAPI.GET("/cache", adminRouter.GetCacheStats)
+	return nil
+}
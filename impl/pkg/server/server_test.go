@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -45,6 +46,7 @@ func TestHealthCheckAPI(t *testing.T) {
 	assert.Equal(t, HealthOK, resp.Status)
 
 	shutdown <- os.Interrupt
+	assert.NoError(t, server.Shutdown(context.Background()))
 }
 
 // Is2xxResponse returns true if the given status code is a 2xx response
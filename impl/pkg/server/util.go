@@ -73,6 +73,15 @@ func GetParam(c *gin.Context, param string) *string {
 	return &got
 }
 
+// GetQueryValue is a utility to get a parameter value from the query string, nil if not found
+func GetQueryValue(c *gin.Context, param string) *string {
+	got, ok := c.GetQuery(param)
+	if !ok || got == "" {
+		return nil
+	}
+	return &got
+}
+
 func CORS() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowOrigins: []string{"*"},
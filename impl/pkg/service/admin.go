@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/internal/util"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+var (
+	// ErrRecordNotFound is returned when a record the gateway is asked to manage is not stored
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrRecordBlocked is returned when publishing a record the gateway has blocked
+	ErrRecordBlocked = dht.ErrRecordBlocked
+	// ErrRepublishInProgress is returned when all records are already being scheduled to be republished
+	ErrRepublishInProgress = errors.New("a republish of all records is already in progress")
+)
+
+// ListRecords returns a page of the stored records, along with the token of the next page, nil on the last page
+func (s *DHTService) ListRecords(ctx context.Context, pageToken []byte, pageSize int) ([]dht.BEP44Record, []byte, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ListRecords")
+	defer span.End()
+
+	return s.db.ListRecords(ctx, pageToken, pageSize)
+}
+
+// RecordInfo is everything the gateway stores for a record
+type RecordInfo struct {
+	Record dht.BEP44Record
+	// Document is the DID DHT Document the record decodes to, nil if it does not decode to one
+	Document *did.DIDDHTDocument
+	// DecodeErr is why the record does not decode to a DID DHT Document
+	DecodeErr error
+	// SequenceNumbers is the sorted list of sequence numbers of the stored versions of the record
+	SequenceNumbers []int64
+	// Expiry is when the record is evicted from the Retained DID Set, zero if it is not retained
+	Expiry time.Time
+	// NextRepublish is when the record is next republished, zero if it is not scheduled
+	NextRepublish time.Time
+	// Failure is set if the record is failing to be republished
+	Failure *dht.FailedRecord
+}
+
+// GetRecordInfo returns everything stored for the record with the given z-base-32 encoded ID, or ErrRecordNotFound
+func (s *DHTService) GetRecordInfo(ctx context.Context, id string) (*RecordInfo, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.GetRecordInfo")
+	defer span.End()
+
+	if _, err := util.Z32Decode(id); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode z-base-32 encoded ID: %s", id)
+	}
+	record, err := s.db.ReadRecord(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read record")
+	}
+	if record == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	info := RecordInfo{Record: *record}
+	info.Document, info.DecodeErr = decodeDocument(id, record.Value)
+	if info.SequenceNumbers, err = s.db.ListSequenceNumbers(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to get sequence numbers")
+	}
+	if info.Expiry, err = s.db.ReadRecordExpiry(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to get record expiry")
+	}
+	if info.NextRepublish, err = s.db.ReadNextRepublish(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to get next republish time")
+	}
+	if info.Failure, err = s.db.ReadFailedRecord(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to get record failures")
+	}
+	return &info, nil
+}
+
+// DeleteRecord deletes the stored record with the given z-base-32 encoded ID along with its history, so it is no
+// longer served or republished by the gateway, returning ErrRecordNotFound if it is not stored
+func (s *DHTService) DeleteRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.DeleteRecord")
+	defer span.End()
+
+	if _, err := util.Z32Decode(id); err != nil {
+		return errors.Wrapf(err, "failed to decode z-base-32 encoded ID: %s", id)
+	}
+	record, err := s.db.ReadRecord(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to read record")
+	}
+	if record == nil {
+		return ErrRecordNotFound
+	}
+	return s.deleteRecord(ctx, id)
+}
+
+// deleteRecord deletes the record with the given id from storage and the cache
+func (s *DHTService) deleteRecord(ctx context.Context, id string) error {
+	if err := s.db.DeleteRecord(ctx, id); err != nil {
+		return errors.Wrapf(err, "failed to delete record %s", id)
+	}
+	if err := s.cache.Delete(id); err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to remove deleted record from cache")
+	}
+	logrus.WithContext(ctx).WithField("record_id", id).Info("deleted record")
+	return nil
+}
+
+// BlockRecord deletes any stored record with the given z-base-32 encoded ID and blocks it, so the gateway no longer
+// accepts, serves or republishes it
+func (s *DHTService) BlockRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.BlockRecord")
+	defer span.End()
+
+	if _, err := util.Z32Decode(id); err != nil {
+		return errors.Wrapf(err, "failed to decode z-base-32 encoded ID: %s", id)
+	}
+	// blocked first, so the record cannot be published again between being deleted and blocked
+	if err := s.db.BlockRecord(ctx, id); err != nil {
+		return errors.Wrapf(err, "failed to block record %s", id)
+	}
+	return s.deleteRecord(ctx, id)
+}
+
+// UnblockRecord removes the block on the record with the given z-base-32 encoded ID, so it may be published again
+func (s *DHTService) UnblockRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.UnblockRecord")
+	defer span.End()
+
+	if _, err := util.Z32Decode(id); err != nil {
+		return errors.Wrapf(err, "failed to decode z-base-32 encoded ID: %s", id)
+	}
+	return s.db.UnblockRecord(ctx, id)
+}
+
+// ListBlockedRecords returns the z-base-32 encoded IDs of the records blocked by the gateway
+func (s *DHTService) ListBlockedRecords(ctx context.Context) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ListBlockedRecords")
+	defer span.End()
+
+	return s.db.ListBlockedRecords(ctx)
+}
+
+// ListFailedRecords returns the records failing to be republished, including those quarantined
+func (s *DHTService) ListFailedRecords(ctx context.Context) ([]dht.FailedRecord, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ListFailedRecords")
+	defer span.End()
+
+	return s.db.ListFailedRecords(ctx)
+}
+
+// RepublishRecord republishes the stored record with the given z-base-32 encoded ID at once, returning
+// ErrRecordNotFound if it is not stored. The record is rescheduled as if it had come due.
+func (s *DHTService) RepublishRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.RepublishRecord")
+	defer span.End()
+
+	if _, err := util.Z32Decode(id); err != nil {
+		return errors.Wrapf(err, "failed to decode z-base-32 encoded ID: %s", id)
+	}
+	result := s.republisher.republishRecord(ctx, id)
+	if result.record == nil && result.err == nil {
+		return ErrRecordNotFound
+	}
+	return result.err
+}
+
+// RepublishAll schedules every stored record that is not quarantined to be republished at once. Records are
+// rescheduled in the background, and republished by the workers from the next time the schedule is checked.
+func (s *DHTService) RepublishAll(ctx context.Context) error {
+	_, span := telemetry.GetTracer().Start(ctx, "DHTService.RepublishAll")
+	defer span.End()
+
+	if !s.republisher.rescheduling.CompareAndSwap(false, true) {
+		return ErrRepublishInProgress
+	}
+	go func() {
+		defer s.republisher.rescheduling.Store(false)
+		if err := s.republisher.scheduleAllRecords(s.republisher.ctx, time.Now()); err != nil {
+			logrus.WithError(err).Error("failed to schedule all records for republishing")
+		}
+	}()
+	return nil
+}
+
+// CacheStats are the statistics of a cache
+type CacheStats struct {
+	bigcache.Stats
+	// Entries is the number of entries in the cache
+	Entries int `json:"entries"`
+	// CapacityBytes is the number of bytes the cache has allocated
+	CapacityBytes int `json:"capacity_bytes"`
+}
+
+// GetCacheStats returns the statistics of the record cache, of the cache of records not found and of the cache of
+// reads forwarded to authoritative gateways
+func (s *DHTService) GetCacheStats() (records CacheStats, notFound CacheStats, forwarded CacheStats) {
+	return cacheStats(s.cache), cacheStats(s.badGetCache), cacheStats(s.forwardCache)
+}
+
+func cacheStats(cache *bigcache.BigCache) CacheStats {
+	return CacheStats{Stats: cache.Stats(), Entries: cache.Len(), CapacityBytes: cache.Capacity()}
+}
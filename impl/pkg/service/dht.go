@@ -2,7 +2,8 @@ package service
 
 import (
 	"context"
-	"sync"
+	"net/http"
+	"slices"
 	"time"
 
 	ssiutil "github.com/TBD54566975/ssi-sdk/util"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/TBD54566975/did-dht/config"
 	dhtint "github.com/TBD54566975/did-dht/internal/dht"
+	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/pkg/dht"
 	"github.com/TBD54566975/did-dht/pkg/storage"
 	"github.com/TBD54566975/did-dht/pkg/telemetry"
@@ -30,7 +32,11 @@ type DHTService struct {
 	dht         *dht.DHT
 	cache       *bigcache.BigCache
 	badGetCache *bigcache.BigCache
-	scheduler   *dhtint.Scheduler
+	// forwardCache holds the results of forwarding reads to authoritative gateways
+	forwardCache  *bigcache.BigCache
+	forwardClient *http.Client
+	scheduler     *dhtint.Scheduler
+	republisher   *republisher
 }
 
 // NewDHTService returns a new instance of the DHT service
@@ -50,6 +56,12 @@ func NewDHTService(cfg *config.Config, db storage.Storage, d *dht.DHT) (*DHTServ
 		return nil, ssiutil.LoggingErrorMsg(err, "failed to instantiate cache")
 	}
 
+	// create a cache for reads forwarded to authoritative gateways, so that they are not repeated on every read
+	forwardCache, err := bigcache.New(context.Background(), cacheConfig)
+	if err != nil {
+		return nil, ssiutil.LoggingErrorMsg(err, "failed to instantiate forwardCache")
+	}
+
 	// create a new cache for bad gets to prevent spamming the DHT
 	cacheConfig.LifeWindow = 60 * time.Second
 	cacheConfig.CleanWindow = 30 * time.Second
@@ -61,14 +73,22 @@ func NewDHTService(cfg *config.Config, db storage.Storage, d *dht.DHT) (*DHTServ
 	// start scheduler for republishing
 	scheduler := dhtint.NewScheduler()
 	svc := DHTService{
-		cfg:         cfg,
-		db:          db,
-		dht:         d,
-		cache:       cache,
-		badGetCache: badGetCache,
-		scheduler:   &scheduler,
-	}
-	if err = scheduler.Schedule(cfg.DHTConfig.RepublishCRON, svc.republish); err != nil {
+		cfg:           cfg,
+		db:            db,
+		dht:           d,
+		cache:         cache,
+		badGetCache:   badGetCache,
+		forwardCache:  forwardCache,
+		forwardClient: newForwardClient(),
+		scheduler:     &scheduler,
+	}
+	if svc.republisher, err = newRepublisher(&svc, cfg.DHTConfig); err != nil {
+		return nil, ssiutil.LoggingErrorMsg(err, "failed to start republisher")
+	}
+	if cfg.RetentionConfig.DefaultRetentionSeconds <= 0 {
+		return nil, ssiutil.LoggingNewErrorf("default retention of %ds must be positive", cfg.RetentionConfig.DefaultRetentionSeconds)
+	}
+	if err = scheduler.ScheduleEvery(republishPollInterval, svc.republisher.run); err != nil {
 		return nil, ssiutil.LoggingErrorMsg(err, "failed to start republisher")
 	}
 	return &svc, nil
@@ -88,27 +108,92 @@ func (s *DHTService) PublishDHT(ctx context.Context, id string, record dht.BEP44
 		return err
 	}
 
-	// check if the message is already in the cache
-	if got, err := s.cache.Get(id); err == nil {
-		var resp dht.BEP44Response
-		if err = json.Unmarshal(got, &resp); err == nil && record.Response().Equals(resp) {
-			logrus.WithContext(ctx).WithField("record_id", id).Debug("resolved dht record from cache with matching response")
-			return nil
+	// in strict mode only valid DID DHT Documents are stored and republished
+	if s.cfg.DHTConfig.StrictValidation {
+		if err := validateDocument(id, record.Value); err != nil {
+			return err
 		}
 	}
 
-	// write to db and cache
+	// write to db, which applies conflict resolution against the stored record and refuses blocked records
 	if err := s.db.WriteRecord(ctx, record); err != nil {
+		if errors.Is(err, dht.ErrStaleSequenceNumber) || errors.Is(err, dht.ErrLowerPayload) {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Debug("rejecting record in conflict with stored record")
+		}
 		return err
 	}
-	recordBytes, err := json.Marshal(record.Response())
+
+	doc, err := decodeDocument(id, record.Value)
 	if err != nil {
-		return err
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to decode record, not indexing its types")
 	}
-	if err = s.cache.Set(id, recordBytes); err != nil {
-		return err
+
+	// the record is put to the DHT now, so it is next due an interval from now, with any failures of the record it
+	// replaces forgotten. Deactivated DIDs are put once, and left to expire from the DHT.
+	if doc != nil && doc.Deactivated {
+		logrus.WithContext(ctx).WithField("record_id", id).Info("did deactivated, record will no longer be republished")
+		if err = s.db.DeleteNextRepublish(ctx, id); err != nil {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to unschedule deactivated record")
+		}
+	} else if err = s.republisher.schedule(ctx, id); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to schedule record for republishing")
+	}
+	if err := s.db.DeleteFailedRecord(ctx, id); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to clear record failures")
+	}
+
+	// every published record is retained for the default period, which a retention solution extends
+	if _, err := s.RetainDHT(ctx, id, s.defaultExpiry(time.Now())); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to retain record")
+	}
+
+	// keep the type index in line with the types the record now declares
+	if doc != nil {
+		if err = s.indexTypes(ctx, id, *doc); err != nil {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to index record types")
+		}
+	}
+
+	// an identical record already in the cache has already been put to the DHT
+	var alreadyPut bool
+	if got, err := s.cache.Get(id); err == nil {
+		var resp dht.BEP44Response
+		alreadyPut = json.Unmarshal(got, &resp) == nil && record.Response().Equals(resp)
+	}
+	if alreadyPut {
+		logrus.WithContext(ctx).WithField("record_id", id).Debug("resolved dht record from cache with matching response")
+	} else {
+		// write to cache
+		recordBytes, err := json.Marshal(record.Response())
+		if err != nil {
+			return err
+		}
+		if err = s.cache.Set(id, recordBytes); err != nil {
+			return err
+		}
+		logrus.WithContext(ctx).WithField("record_id", id).Debug("added dht record to cache and db")
+
+		// a record that was previously not found can now be resolved
+		if err = s.badGetCache.Delete(id); err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to remove key from bad get cache")
+		}
+	}
+
+	// a block made after the record was written may have deleted it before it was scheduled, retained and cached
+	// above, so those are deleted again; a block made after this check deletes them itself
+	blocked, err := s.db.IsRecordBlocked(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to check block list")
+	}
+	if blocked {
+		if err = s.deleteRecord(ctx, id); err != nil {
+			return err
+		}
+		return ErrRecordBlocked
+	}
+	if alreadyPut {
+		return nil
 	}
-	logrus.WithContext(ctx).WithField("record_id", id).Debug("added dht record to cache and db")
 
 	// return here and put it in the DHT asynchronously
 	go func() {
@@ -126,6 +211,253 @@ func (s *DHTService) PublishDHT(ctx context.Context, id string, record dht.BEP44
 	return nil
 }
 
+// decodeDocument decodes the DID document held in the BEP44 payload value of the DID with the given z-base-32 encoded ID
+func decodeDocument(id string, v []byte) (*did.DIDDHTDocument, error) {
+	msg, err := did.UnpackDNSPacket(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack dns packet")
+	}
+	doc, err := did.DHT(did.Prefix + ":" + id).FromDNSPacket(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode did document")
+	}
+	return doc, nil
+}
+
+// validateDocument checks the value of a record with the given z-base-32 encoded ID is a DNS packet encoding a valid
+// DID DHT Document, returning a *did.InvalidDocumentError if it is not
+func validateDocument(id string, v []byte) error {
+	msg, err := did.UnpackDNSPacket(v)
+	if err != nil {
+		return &did.InvalidDocumentError{Problems: []string{"invalid dns packet: " + err.Error()}}
+	}
+	_, err = did.DHT(did.Prefix + ":" + id).ValidateDNSPacket(msg)
+	return err
+}
+
+// indexTypes indexes the record with the given z-base-32 encoded ID under each of its document's types, removing any
+// types the document no longer declares. A deactivated DID is removed from the index entirely.
+func (s *DHTService) indexTypes(ctx context.Context, id string, doc did.DIDDHTDocument) error {
+	var types []int
+	if !doc.Deactivated {
+		for _, t := range doc.Types {
+			types = append(types, int(t))
+		}
+	}
+	return s.db.WriteRecordTypes(ctx, id, types)
+}
+
+// ErrTypeNotFound is returned when a type is not in the Indexed Types registry
+var ErrTypeNotFound = errors.New("type not found")
+
+// ListDIDsForType returns the identifiers of up to limit DIDs indexed under the given type, skipping the first offset
+func (s *DHTService) ListDIDsForType(ctx context.Context, typ did.TypeIndex, offset, limit int) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ListDIDsForType")
+	defer span.End()
+
+	if _, ok := typ.Description(); !ok {
+		return nil, ErrTypeNotFound
+	}
+
+	ids, err := s.db.ListRecordsForType(ctx, int(typ), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	dids := make([]string, 0, len(ids))
+	for _, id := range ids {
+		dids = append(dids, did.Prefix+":"+id)
+	}
+	return dids, nil
+}
+
+// RetainDHT adds the record with the given z-base-32 encoded ID to the Retained DID Set until the given expiry,
+// returning the resulting expiry. An existing later expiry is never shortened.
+func (s *DHTService) RetainDHT(ctx context.Context, id string, expiry time.Time) (time.Time, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.RetainDHT")
+	defer span.End()
+
+	existing, err := s.db.ReadRecordExpiry(ctx, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if existing.After(expiry) {
+		return existing, nil
+	}
+
+	if err = s.db.WriteRecordExpiry(ctx, id, expiry); err != nil {
+		return time.Time{}, err
+	}
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"record_id": id,
+		"expiry":    expiry.Unix(),
+	}).Debug("retained dht record")
+	return expiry, nil
+}
+
+// defaultExpiry returns when a record published at the given time without a retention solution is evicted
+func (s *DHTService) defaultExpiry(now time.Time) time.Time {
+	return now.Add(time.Duration(s.cfg.RetentionConfig.DefaultRetentionSeconds) * time.Second)
+}
+
+// GetDHTExpiry returns the time at which the record with the given z-base-32 encoded ID will be evicted from the
+// Retained DID Set, or the zero time if it is not retained
+func (s *DHTService) GetDHTExpiry(ctx context.Context, id string) (time.Time, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.GetDHTExpiry")
+	defer span.End()
+
+	return s.db.ReadRecordExpiry(ctx, id)
+}
+
+// GetDHTAtSeq returns the stored version of the record with the given z-base-32 encoded ID and sequence number,
+// or nil if there is no such version
+func (s *DHTService) GetDHTAtSeq(ctx context.Context, id string, seq int64) (*dht.BEP44Response, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.GetDHTAtSeq")
+	defer span.End()
+
+	// make sure the key is valid
+	if _, err := util.Z32Decode(id); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode z-base-32 encoded ID: %s", id)
+	}
+
+	record, err := s.db.ReadRecordAtSeq(ctx, id, seq)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	resp := record.Response()
+	return &resp, nil
+}
+
+// ResolvedDID is a DID resolved by the gateway along with the BEP44 payload it was decoded from
+type ResolvedDID struct {
+	did.ResolutionResult
+	// Payload is the BEP44 payload the DID was decoded from
+	Payload dht.BEP44Response
+	// SequenceNumbers is the sorted list of sequence numbers seen for the DID
+	SequenceNumbers []int64
+}
+
+// ResolveDID resolves the DID with the given z-base-32 encoded ID, filling in its metadata from the stored history of
+// the DID. The version with the given sequence number is resolved if one is given, otherwise the latest version.
+// Returns nil if the DID, or the requested version of it, is not found.
+func (s *DHTService) ResolveDID(ctx context.Context, id string, seq *int64) (*ResolvedDID, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ResolveDID")
+	defer span.End()
+
+	var resp *dht.BEP44Response
+	var err error
+	gateway := s.cfg.ServerConfig.BaseURL
+	if seq != nil {
+		resp, err = s.GetDHTAtSeq(ctx, id, *seq)
+	} else {
+		resp, gateway, err = s.getLatest(ctx, id)
+	}
+	if err != nil || resp == nil {
+		return nil, err
+	}
+
+	doc, err := decodeDocument(id, resp.V)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs, err := s.db.ListSequenceNumbers(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sequence numbers")
+	}
+	// the resolved record may have come from the DHT without being stored by this gateway
+	if !slices.Contains(seqs, resp.Seq) {
+		seqs = append(seqs, resp.Seq)
+		slices.Sort(seqs)
+	}
+
+	expiry, err := s.db.ReadRecordExpiry(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get expiry")
+	}
+
+	result := did.NewResolutionResult(*doc, resp.Seq, seqs)
+	if !expiry.IsZero() {
+		result.DocumentMetadata.Expiry = expiry.Unix()
+	}
+	result.ResolutionMetadata.Gateway = gateway
+	return &ResolvedDID{
+		ResolutionResult: result,
+		Payload:          *resp,
+		SequenceNumbers:  seqs,
+	}, nil
+}
+
+// ResolveLineage verifies the chain of DIDs the DID with the given z-base-32 encoded ID was rotated from
+// https://did-dht.com/#rotation, resolving the latest version of each of them from storage or the DHT. The chain is
+// returned starting at the DID, or did.ErrDIDNotFound if the DID is not found.
+func (s *DHTService) ResolveLineage(ctx context.Context, id string, opts did.LineageOpts) ([]did.LineageLink, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ResolveLineage")
+	defer span.End()
+
+	return did.VerifyLineage(ctx, did.DHT(did.Prefix+":"+id), s.getLatestDocument, opts)
+}
+
+// getLatestDocument returns the document of the latest record for the given DID, or nil if it is not found. A DID
+// rate limited after an earlier failed lookup is taken as not found, as the first DID of a chain often has no record.
+func (s *DHTService) getLatestDocument(ctx context.Context, id did.DHT) (*did.DIDDHTDocument, error) {
+	suffix, err := id.Suffix()
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := s.getLatest(ctx, suffix)
+	if errors.Is(err, SpamError) {
+		return nil, nil
+	}
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return decodeDocument(suffix, resp.V)
+}
+
+// getLatest returns the latest record for the given z-base-32 encoded ID along with the URL of the gateway that answered,
+// following https://did-dht.com/#designating-authoritative-gateways: records the gateway is authoritative for are served
+// from storage, and reads of records with other authoritative gateways, whether stored or resolved from Mainline, are
+// forwarded to them. Stored records the gateway is not authoritative for are otherwise resolved from Mainline.
+func (s *DHTService) getLatest(ctx context.Context, id string) (*dht.BEP44Response, string, error) {
+	self := s.cfg.ServerConfig.BaseURL
+	stored, err := s.db.ReadRecord(ctx, id)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).WithField("record_id", id).Warn("failed to read record from storage")
+	}
+
+	var latest *dht.BEP44Response
+	if stored != nil {
+		resp := stored.Response()
+		latest = &resp
+	} else if latest, err = s.GetDHT(ctx, id); err != nil || latest == nil {
+		return latest, self, err
+	}
+
+	if doc, err := decodeDocument(id, latest.V); err == nil && len(doc.Gateways) > 0 {
+		if s.isAuthoritative(doc.Gateways) {
+			if stored != nil {
+				logrus.WithContext(ctx).WithField("record_id", id).Debug("authoritative for record, resolving from storage")
+				return latest, self, nil
+			}
+		} else if forwarded, gateway := s.getForwarded(ctx, id, doc.Gateways, latest.Seq); forwarded != nil {
+			return forwarded, gateway, nil
+		}
+	}
+
+	if stored == nil {
+		return latest, self, nil
+	}
+	resp, err := s.GetDHT(ctx, id)
+	return resp, self, err
+}
+
+// isAuthoritative returns true if the gateway is one of the given authoritative gateways
+func (s *DHTService) isAuthoritative(gateways []did.AuthoritativeGateway) bool {
+	return slices.ContainsFunc(gateways, func(g did.AuthoritativeGateway) bool {
+		return g.IsGateway(s.cfg.ServerConfig.FQDN)
+	})
+}
+
 var SpamError = errors.New("rate limited to prevent spam")
 
 // GetDHT returns the full DNS record (including sig data) for the given z-base-32 encoded ID
@@ -155,6 +487,16 @@ func (s *DHTService) GetDHT(ctx context.Context, id string) (*dht.BEP44Response,
 		logrus.WithContext(ctx).WithError(err).WithField("record_id", id).Warn("failed to get record from cache, falling back to dht")
 	}
 
+	// blocked records are removed from the cache, and are not served from the dht either
+	blocked, err := s.db.IsRecordBlocked(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check block list")
+	}
+	if blocked {
+		logrus.WithContext(ctx).WithField("record_id", id).Debug("not resolving blocked record")
+		return nil, nil
+	}
+
 	// next do a dht lookup with a timeout of 10 seconds
 	getCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
@@ -225,169 +567,14 @@ func (s *DHTService) addRecordToCache(id string, resp dht.BEP44Response) error {
 	return nil
 }
 
-// failedRecord is a struct to keep track of records that failed to be republished
-type failedRecord struct {
-	record     dht.BEP44Record
-	failureCnt int
-}
-
-// TODO(gabe) make this more efficient. create a publish schedule based on each individual record, not all records
-// republish republishes all records in the db
-func (s *DHTService) republish() {
-	ctx, span := telemetry.GetTracer().Start(context.Background(), "DHTService.republish")
-	defer span.End()
-
-	recordCnt, err := s.db.RecordCount(ctx)
-	if err != nil {
-		logrus.WithContext(ctx).WithError(err).Error("failed to get record count before republishing")
-		return
-	}
-	logrus.WithContext(ctx).WithField("record_count", recordCnt).Info("republishing records")
-
-	// republish all records in the db and handle failed records up to 3 times
-	failedRecords := s.republishRecords(ctx)
-
-	// handle failed records
-	logrus.WithContext(ctx).WithField("failed_record_count", len(failedRecords)).Info("handling failed records")
-	s.handleFailedRecords(ctx, failedRecords)
-}
-
-// republishRecords republishes all records in the db and returns a list of failed records to be retried
-func (s *DHTService) republishRecords(ctx context.Context) []failedRecord {
-	var nextPageToken []byte
-	var seenRecords, batchCnt int32
-	var failedRecords []failedRecord
-	var recordsBatch []dht.BEP44Record
-	var err error
-
-	var wg sync.WaitGroup
-
-	republishStart := time.Now()
-
-	for {
-		recordsBatch, nextPageToken, err = s.db.ListRecords(ctx, nextPageToken, 1000)
-		if err != nil {
-			logrus.WithContext(ctx).WithError(err).Error("failed to list record(s) for republishing")
-			continue
-		}
-
-		batchSize := len(recordsBatch)
-		seenRecords += int32(batchSize)
-		if batchSize == 0 {
-			logrus.WithContext(ctx).Info("no records to republish")
-			break
-		}
-
-		logrus.WithContext(ctx).WithFields(logrus.Fields{
-			"record_count": batchSize,
-			"batch_number": batchCnt,
-			"total_seen":   seenRecords,
-		}).Debugf("republishing batch [%d] of [%d] records", batchCnt, batchSize)
-		batchCnt++
-
-		batchFailedRecords := s.republishBatch(ctx, &wg, recordsBatch)
-		failedRecords = append(failedRecords, batchFailedRecords...)
-
-		if nextPageToken == nil {
-			break
-		}
-	}
-
-	wg.Wait()
-
-	republishEnd := time.Since(republishStart)
-	hours := int(republishEnd.Hours())
-	minutes := int(republishEnd.Minutes()) % 60
-	seconds := int(republishEnd.Seconds()) % 60
-	logrus.WithContext(ctx).Infof("Republishing completed in: %d hours, %d minutes, %d seconds", hours, minutes, seconds)
-
-	successRate := float64(seenRecords-int32(len(failedRecords))) / float64(seenRecords) * 100
-	logrus.WithContext(ctx).WithFields(logrus.Fields{
-		"success": seenRecords - int32(len(failedRecords)),
-		"errors":  len(failedRecords),
-		"total":   seenRecords,
-	}).Infof("republishing complete with [%d] batches of [%d] total records with a [%.2f] percent success rate", batchCnt, seenRecords, successRate)
-
-	return failedRecords
-}
-
-// republishBatch republishes a batch of records and returns a list of failed records to be retried
-func (s *DHTService) republishBatch(ctx context.Context, wg *sync.WaitGroup, recordsBatch []dht.BEP44Record) []failedRecord {
-	failedRecordsChan := make(chan failedRecord, len(recordsBatch))
-	var failedRecords []failedRecord
-
-	for _, record := range recordsBatch {
-		wg.Add(1)
-		go func(record dht.BEP44Record) {
-			defer wg.Done()
-
-			id := record.ID()
-			putCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			defer cancel()
-
-			if _, putErr := s.dht.Put(putCtx, record.Put()); putErr != nil {
-				if errors.Is(putErr, context.DeadlineExceeded) {
-					logrus.WithContext(putCtx).WithField("record_id", id).Debug("republish timeout exceeded")
-				} else {
-					logrus.WithContext(putCtx).WithField("record_id", id).WithError(putErr).Debug("failed to republish record")
-				}
-				failedRecordsChan <- failedRecord{
-					record:     record,
-					failureCnt: 1,
-				}
-			}
-		}(record)
-	}
-
-	wg.Wait()
-	close(failedRecordsChan)
-
-	for fr := range failedRecordsChan {
-		failedRecords = append(failedRecords, fr)
-	}
-	return failedRecords
-}
-
-// handleFailedRecords attempts to republish failed records up to 3 times
-func (s *DHTService) handleFailedRecords(ctx context.Context, failedRecords []failedRecord) {
-	for _, fr := range failedRecords {
-		retryCount := 0
-		for retryCount < 3 {
-			id := fr.record.ID()
-			putCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			defer cancel()
-
-			if _, putErr := s.dht.Put(putCtx, fr.record.Put()); putErr != nil {
-				logrus.WithContext(putCtx).WithField("record_id", id).WithError(putErr).Debugf("failed to re-republish [%s], attempt: %d", id, retryCount+1)
-				retryCount++
-			} else {
-				break
-			}
-		}
-
-		if retryCount == 3 {
-			id := fr.record.ID()
-			logrus.WithContext(ctx).WithField("record_id", id).Error("record failed to republish after 3 attempts")
-			if err := s.db.WriteFailedRecord(ctx, id); err != nil {
-				logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to write failed record to db")
-			}
-		}
-	}
-
-	failedRecordCnt, err := s.db.FailedRecordCount(ctx)
-	if err != nil {
-		logrus.WithContext(ctx).WithError(err).Error("failed to get failed record count")
-		return
-	}
-
-	logrus.WithContext(ctx).WithField("failed_record_count", failedRecordCnt).Warn("total count of record that failed to republish")
-}
-
 // Close closes the Mainline service gracefully
 func (s *DHTService) Close() {
 	if s == nil {
 		return
 	}
+	if s.republisher != nil {
+		s.republisher.stop()
+	}
 	if s.scheduler != nil {
 		s.scheduler.Stop()
 	}
@@ -401,6 +588,11 @@ func (s *DHTService) Close() {
 			logrus.WithError(err).Error("failed to close bad get cache")
 		}
 	}
+	if s.forwardCache != nil {
+		if err := s.forwardCache.Close(); err != nil {
+			logrus.WithError(err).Error("failed to close forward cache")
+		}
+	}
 	if err := s.db.Close(); err != nil {
 		logrus.WithError(err).Error("failed to close db")
 	}
@@ -2,17 +2,32 @@ package service
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/binary"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"os"
 	"testing"
+	"time"
 
+	didsdk "github.com/TBD54566975/ssi-sdk/did"
+	"github.com/allegro/bigcache/v3"
 	anacrolixdht "github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/TBD54566975/did-dht/config"
 	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/resolver"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 	"github.com/TBD54566975/did-dht/pkg/storage"
 )
 
@@ -31,6 +46,495 @@ func TestDHTService(t *testing.T) {
 		assert.Nil(t, got)
 	})
 
+	t.Run("test publish record with stale sequence number", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+
+		d := did.DHT(doc.ID)
+		packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		newer := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 2}
+		newer.Sign(sk)
+		err = svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&newer))
+		require.NoError(t, err)
+
+		older := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1}
+		older.Sign(sk)
+		err = svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&older))
+		assert.ErrorIs(t, err, dht.ErrStaleSequenceNumber)
+
+		got, err := svc.GetDHT(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), got.Seq)
+	})
+
+	t.Run("test publish invalid document in strict validation mode", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		// the service ids are not unique
+		service := didsdk.Service{ID: doc.ID + "#vcs", Type: "VerifiableCredentialService", ServiceEndpoint: []string{"https://example.com/vc/"}}
+		doc.Services = []didsdk.Service{service, service}
+		packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		put := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1}
+		put.Sign(sk)
+
+		svc.cfg.DHTConfig.StrictValidation = true
+		t.Cleanup(func() { svc.cfg.DHTConfig.StrictValidation = false })
+		err = svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&put))
+		var invalidErr *did.InvalidDocumentError
+		require.True(t, errors.As(err, &invalidErr))
+		assert.Equal(t, []string{"service id " + doc.ID + "#vcs is not unique"}, invalidErr.Problems)
+
+		// a valid document is accepted
+		doc.Services = doc.Services[:1]
+		packet, err = d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		packed, err = packet.Pack()
+		require.NoError(t, err)
+		put = bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 2}
+		put.Sign(sk)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&put)))
+
+		// records that are not dns packets are rejected too
+		put = bep44.Put{V: []byte("not a dns packet"), K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 3}
+		put.Sign(sk)
+		err = svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&put))
+		require.True(t, errors.As(err, &invalidErr))
+		assert.Contains(t, invalidErr.Problems[0], "invalid dns packet")
+	})
+
+	t.Run("test index record types", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		publish := func(seq int64, types []did.TypeIndex) {
+			packet, err := d.ToDNSPacket(*doc, types, nil, nil)
+			require.NoError(t, err)
+			packed, err := packet.Pack()
+			require.NoError(t, err)
+			put := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: seq}
+			put.Sign(sk)
+			require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&put)))
+		}
+
+		publish(1, []did.TypeIndex{did.Organization, did.FinancialInstitution})
+		dids, err := svc.ListDIDsForType(context.Background(), did.FinancialInstitution, 0, 100)
+		require.NoError(t, err)
+		assert.Contains(t, dids, doc.ID)
+
+		// types the DID no longer declares are removed from the index
+		publish(2, []did.TypeIndex{did.Organization})
+		dids, err = svc.ListDIDsForType(context.Background(), did.FinancialInstitution, 0, 100)
+		require.NoError(t, err)
+		assert.NotContains(t, dids, doc.ID)
+		dids, err = svc.ListDIDsForType(context.Background(), did.Organization, 0, 100)
+		require.NoError(t, err)
+		assert.Contains(t, dids, doc.ID)
+
+		publish(3, nil)
+		dids, err = svc.ListDIDsForType(context.Background(), did.Organization, 0, 100)
+		require.NoError(t, err)
+		assert.NotContains(t, dids, doc.ID)
+
+		_, err = svc.ListDIDsForType(context.Background(), did.TypeIndex(100), 0, 100)
+		assert.ErrorIs(t, err, ErrTypeNotFound)
+	})
+
+	t.Run("test deactivate record", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		packet, err := d.ToDNSPacket(*doc, []did.TypeIndex{did.FinancialInstitution}, nil, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		put := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1}
+		put.Sign(sk)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&put)))
+
+		packet, err = d.CreateDeactivatedPacket()
+		require.NoError(t, err)
+		packed, err = packet.Pack()
+		require.NoError(t, err)
+		put = bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 2}
+		put.Sign(sk)
+		record := dht.RecordFromBEP44(&put)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, record))
+
+		// the deactivated DID is no longer republished
+		next, err := svc.db.ReadNextRepublish(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.True(t, next.IsZero())
+
+		// the deactivated DID is dropped from the type index
+		dids, err := svc.ListDIDsForType(context.Background(), did.FinancialInstitution, 0, 100)
+		require.NoError(t, err)
+		assert.NotContains(t, dids, doc.ID)
+
+		decoded, err := decodeDocument(suffix, record.Value)
+		require.NoError(t, err)
+		assert.True(t, decoded.Deactivated)
+	})
+
+	t.Run("test resolve did", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		packet, err := d.ToDNSPacket(*doc, []did.TypeIndex{did.Organization}, nil, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+		for _, seq := range []int64{1700000000, 1700000100} {
+			put := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: seq}
+			put.Sign(sk)
+			require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&put)))
+		}
+		_, err = svc.RetainDHT(context.Background(), suffix, time.Unix(1900000000, 0))
+		require.NoError(t, err)
+
+		resolved, err := svc.ResolveDID(context.Background(), suffix, nil)
+		require.NoError(t, err)
+		require.NotNil(t, resolved)
+		assert.Equal(t, doc.ID, resolved.Document.ID)
+		assert.Equal(t, []int64{1700000000, 1700000100}, resolved.SequenceNumbers)
+		assert.Equal(t, did.DocumentMetadata{
+			VersionID: "1700000100",
+			Created:   "2023-11-14T22:13:20Z",
+			Updated:   "2023-11-14T22:15:00Z",
+			Types:     []did.TypeIndex{did.Organization},
+			Expiry:    1900000000,
+		}, resolved.DocumentMetadata)
+		assert.Equal(t, svc.cfg.ServerConfig.BaseURL, resolved.ResolutionMetadata.Gateway)
+
+		// resolving an earlier version keeps the creation and update times of the DID
+		seq := int64(1700000000)
+		resolved, err = svc.ResolveDID(context.Background(), suffix, &seq)
+		require.NoError(t, err)
+		require.NotNil(t, resolved)
+		assert.Equal(t, "1700000000", resolved.DocumentMetadata.VersionID)
+		assert.Equal(t, "2023-11-14T22:15:00Z", resolved.DocumentMetadata.Updated)
+
+		seq = 1
+		resolved, err = svc.ResolveDID(context.Background(), suffix, &seq)
+		require.NoError(t, err)
+		assert.Nil(t, resolved)
+	})
+
+	t.Run("test resolve did as authoritative gateway", func(t *testing.T) {
+		svc.cfg.ServerConfig.FQDN = "gateway1.example-did-dht-gateway.com."
+		t.Cleanup(func() { svc.cfg.ServerConfig.FQDN = "" })
+
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		gateways := []did.AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}
+		packet, err := d.ToDNSPacket(*doc, nil, gateways, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+
+		resolved, err := svc.ResolveDID(context.Background(), suffix, nil)
+		require.NoError(t, err)
+		require.NotNil(t, resolved)
+		assert.Equal(t, doc.ID, resolved.Document.ID)
+		assert.Equal(t, putMsg.Seq, resolved.Payload.Seq)
+		assert.Equal(t, svc.cfg.ServerConfig.BaseURL, resolved.ResolutionMetadata.Gateway)
+	})
+
+	t.Run("test resolve did with legacy gateway records", func(t *testing.T) {
+		svc.cfg.ServerConfig.FQDN = "gateway1.example-did-dht-gateway.com"
+		t.Cleanup(func() { svc.cfg.ServerConfig.FQDN = "" })
+
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		// gateways used to be published as TXT records with an NS header
+		packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		packet.Answer = append(packet.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: fmt.Sprintf("_did.%s.", suffix), Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 7200},
+			Txt: []string{"gateway1.example-did-dht-gateway.com"},
+		})
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+
+		resolved, err := svc.ResolveDID(context.Background(), suffix, nil)
+		require.NoError(t, err)
+		require.NotNil(t, resolved)
+		assert.Equal(t, doc.ID, resolved.Document.ID)
+		decoded, err := decodeDocument(suffix, resolved.Payload.V)
+		require.NoError(t, err)
+		assert.Equal(t, []did.AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}, decoded.Gateways)
+		assert.Equal(t, svc.cfg.ServerConfig.BaseURL, resolved.ResolutionMetadata.Gateway)
+	})
+
+	t.Run("test resolve did from authoritative gateway", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+
+		gateways := []did.AuthoritativeGateway{"gateway1.example-did-dht-gateway.com."}
+		packet, err := d.ToDNSPacket(*doc, nil, gateways, nil)
+		require.NoError(t, err)
+		packed, err := packet.Pack()
+		require.NoError(t, err)
+
+		// the authoritative gateway has a newer version of the DID than this gateway
+		latestPut := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1700000100}
+		latestPut.Sign(sk)
+		latest := gatewayResponse(&latestPut)
+		var requests int
+		client := newTestGateways(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Host != "gateway1.example-did-dht-gateway.com" || r.URL.Path != "/"+suffix {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(latest)
+		}))
+		forwardClient := svc.forwardClient
+		svc.forwardClient = client
+		t.Cleanup(func() { svc.forwardClient = forwardClient })
+
+		stalePut := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1700000000}
+		stalePut.Sign(sk)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&stalePut)))
+
+		resolved, err := svc.ResolveDID(context.Background(), suffix, nil)
+		require.NoError(t, err)
+		require.NotNil(t, resolved)
+		assert.Equal(t, int64(1700000100), resolved.Payload.Seq)
+		assert.Equal(t, "1700000100", resolved.DocumentMetadata.VersionID)
+		assert.Equal(t, "https://gateway1.example-did-dht-gateway.com", resolved.ResolutionMetadata.Gateway)
+		assert.Equal(t, 1, requests)
+
+		// the forwarded record is cached, so reading it again makes no request to the gateway
+		resolved, err = svc.ResolveDID(context.Background(), suffix, nil)
+		require.NoError(t, err)
+		require.NotNil(t, resolved)
+		assert.Equal(t, int64(1700000100), resolved.Payload.Seq)
+		assert.Equal(t, 1, requests)
+
+		// an authoritative gateway serving a forged record is ignored, and the failure is cached as well
+		sk, doc, err = did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d = did.DHT(doc.ID)
+		suffix, err = d.Suffix()
+		require.NoError(t, err)
+		packet, err = d.ToDNSPacket(*doc, nil, gateways, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		latest = gatewayResponse(putMsg)
+		latest[0] ^= 0xff
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+
+		for range 2 {
+			resolved, err = svc.ResolveDID(context.Background(), suffix, nil)
+			require.NoError(t, err)
+			require.NotNil(t, resolved)
+			assert.Equal(t, svc.cfg.ServerConfig.BaseURL, resolved.ResolutionMetadata.Gateway)
+		}
+		assert.Equal(t, 2, requests)
+	})
+
+	t.Run("test is authoritative", func(t *testing.T) {
+		gateways := []did.AuthoritativeGateway{"gateway1.example-did-dht-gateway.com.", "gateway2.example-did-dht-gateway.com."}
+		assert.False(t, svc.isAuthoritative(gateways))
+
+		svc.cfg.ServerConfig.FQDN = "gateway2.example-did-dht-gateway.com"
+		t.Cleanup(func() { svc.cfg.ServerConfig.FQDN = "" })
+		assert.True(t, svc.isAuthoritative(gateways))
+		assert.False(t, svc.isAuthoritative(nil))
+	})
+
+	t.Run("test forward resolution", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		suffix, err := d.Suffix()
+		require.NoError(t, err)
+		packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+
+		body := gatewayResponse(putMsg)
+		client := newTestGateways(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host != "gateway.example.com" || r.URL.Path != "/"+suffix {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(body)
+		}))
+
+		gateways := []did.AuthoritativeGateway{"empty.example.com", "gateway.example.com"}
+		record, err := forwardResolution(context.Background(), client, suffix, gateways)
+		require.NoError(t, err)
+		assert.Equal(t, putMsg.Seq, record.SequenceNumber)
+		assert.Equal(t, "https://gateway.example.com", record.Gateway)
+
+		// gateways not named by a domain name are skipped
+		gateways = []did.AuthoritativeGateway{"http://gateway.example.com", "127.0.0.1", "gateway.example.com:443", "gateway.example.com"}
+		record, err = forwardResolution(context.Background(), client, suffix, gateways)
+		require.NoError(t, err)
+		assert.Equal(t, "https://gateway.example.com", record.Gateway)
+
+		_, err = forwardResolution(context.Background(), client, suffix, []did.AuthoritativeGateway{"http://gateway.example.com"})
+		assert.EqualError(t, err, "no valid authoritative gateways")
+
+		// no more than maxForwardedGateways gateways are tried
+		gateways = []did.AuthoritativeGateway{"empty1.example.com", "empty2.example.com", "empty3.example.com", "gateway.example.com"}
+		_, err = forwardResolution(context.Background(), client, suffix, gateways)
+		assert.ErrorIs(t, err, resolver.ErrNotFound)
+
+		// a gateway serving a forged record is not trusted
+		body[0] ^= 0xff
+		_, err = forwardResolution(context.Background(), client, suffix, []did.AuthoritativeGateway{"gateway.example.com"})
+		assert.ErrorIs(t, err, dht.ErrInvalidSignature)
+	})
+
+	t.Run("test forward client refuses non-public addresses", func(t *testing.T) {
+		gateway := httptest.NewTLSServer(http.NotFoundHandler())
+		t.Cleanup(gateway.Close)
+
+		_, err := newForwardClient().Get(gateway.URL)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "refusing to connect to non-public address 127.0.0.1")
+	})
+
+	t.Run("test publish record blocked while publishing", func(t *testing.T) {
+		db := svc.db
+		svc.db = blockingStorage{Storage: db}
+		t.Cleanup(func() { svc.db = db })
+
+		record := dht.NewTestRecord(t)
+		id := record.ID()
+
+		// nothing the publish writes after the record is outlives the block
+		assert.ErrorIs(t, svc.PublishDHT(context.Background(), id, record), ErrRecordBlocked)
+		stored, err := db.ReadRecord(context.Background(), id)
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+		next, err := db.ReadNextRepublish(context.Background(), id)
+		require.NoError(t, err)
+		assert.True(t, next.IsZero())
+		expiry, err := db.ReadRecordExpiry(context.Background(), id)
+		require.NoError(t, err)
+		assert.True(t, expiry.IsZero())
+		_, err = svc.cache.Get(id)
+		assert.ErrorIs(t, err, bigcache.ErrEntryNotFound)
+	})
+
+	t.Run("test retain record", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		suffix, err := did.DHT(doc.ID).Suffix()
+		require.NoError(t, err)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+
+		// published records are retained for the default period
+		expiry, err := svc.GetDHTExpiry(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.WithinDuration(t, svc.defaultExpiry(time.Now()), expiry, time.Minute)
+
+		later := svc.defaultExpiry(time.Now()).Add(2 * time.Hour).Truncate(time.Second)
+		expiry, err = svc.RetainDHT(context.Background(), suffix, later)
+		require.NoError(t, err)
+		assert.Equal(t, later.Unix(), expiry.Unix())
+
+		// an earlier expiry does not shorten retention
+		expiry, err = svc.RetainDHT(context.Background(), suffix, later.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, later.Unix(), expiry.Unix())
+
+		expiry, err = svc.GetDHTExpiry(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.Equal(t, later.Unix(), expiry.Unix())
+
+		// publishing an update without a solution does not shorten retention
+		putMsg, err = dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		putMsg.Seq++
+		require.NoError(t, signer.SignPut(signer.NewInMemorySigner(sk), putMsg))
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+		expiry, err = svc.GetDHTExpiry(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.Equal(t, later.Unix(), expiry.Unix())
+	})
+
+	t.Run("test evict expired records", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		suffix, err := did.DHT(doc.ID).Suffix()
+		require.NoError(t, err)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+
+		require.NoError(t, svc.db.WriteRecordExpiry(context.Background(), suffix, time.Now().Add(-time.Minute)))
+
+		// an evicted record is no longer republished, but is still stored and served
+		svc.evictExpiredRecords(context.Background())
+		next, err := svc.db.ReadNextRepublish(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.True(t, next.IsZero())
+		record, err := svc.db.ReadRecord(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.NotNil(t, record)
+		got, err := svc.GetDHT(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.NotNil(t, got)
+
+		// publishing it again retains and schedules it again
+		putMsg.Seq++
+		require.NoError(t, signer.SignPut(signer.NewInMemorySigner(sk), putMsg))
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+		next, err = svc.db.ReadNextRepublish(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.False(t, next.IsZero())
+		expiry, err := svc.GetDHTExpiry(context.Background(), suffix)
+		require.NoError(t, err)
+		assert.True(t, expiry.After(time.Now()))
+	})
+
 	t.Run("test get record with invalid ID", func(t *testing.T) {
 		got, err := svc.GetDHT(context.Background(), "---")
 		assert.ErrorContains(t, err, "illegal z-base-32 data at input byte 0")
@@ -48,7 +552,7 @@ func TestDHTService(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, packet)
 
-		putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 		require.NoError(t, err)
 		require.NotEmpty(t, putMsg)
 
@@ -75,7 +579,7 @@ func TestDHTService(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, packet)
 
-		putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 		require.NoError(t, err)
 		require.NotEmpty(t, putMsg)
 
@@ -103,7 +607,7 @@ func TestDHTService(t *testing.T) {
 		require.NoError(t, err)
 		require.NotEmpty(t, packet)
 
-		putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 		require.NoError(t, err)
 		require.NotEmpty(t, putMsg)
 
@@ -135,6 +639,31 @@ func TestDHTService(t *testing.T) {
 		assert.Empty(t, got)
 	})
 
+	t.Run("test publish record previously not found", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		suffix, err := did.DHT(doc.ID).Suffix()
+		require.NoError(t, err)
+
+		got, err := svc.GetDHT(context.Background(), suffix)
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+		_, err = svc.GetDHT(context.Background(), suffix)
+		assert.ErrorContains(t, err, "rate limited to prevent spam")
+
+		// once published the record resolves rather than being rate limited
+		packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		require.NoError(t, svc.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(putMsg)))
+
+		got, err = svc.GetDHT(context.Background(), suffix)
+		assert.NoError(t, err)
+		require.NotEmpty(t, got)
+		assert.Equal(t, putMsg.Seq, got.Seq)
+	})
+
 	t.Cleanup(func() { svc.Close() })
 }
 
@@ -149,7 +678,7 @@ func TestDHT(t *testing.T) {
 	packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
 	require.NoError(t, err)
 	require.NotEmpty(t, packet)
-	putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+	putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	require.NoError(t, err)
 	require.NotEmpty(t, putMsg)
 	suffix, err := d.Suffix()
@@ -197,15 +726,131 @@ func TestNoConfig(t *testing.T) {
 
 	svc, err = NewDHTService(&config.Config{
 		DHTConfig: config.DHTServiceConfig{
-			RepublishCRON: "not a real cron expression",
+			RepublishIntervalSeconds: 7200,
+			RepublishConcurrency:     100,
 		},
 	}, nil, nil)
-	assert.EqualError(t, err, "failed to start republisher: gocron: cron expression failed to be parsed: failed to parse int from not: strconv.Atoi: parsing \"not\": invalid syntax")
+	assert.EqualError(t, err, "failed to start republisher: republish interval of 7200s must be positive and under the 2h0m0s lifetime of a record")
+	assert.Nil(t, svc)
+
+	noRetention := config.GetDefaultConfig()
+	noRetention.RetentionConfig.DefaultRetentionSeconds = 0
+	svc, err = NewDHTService(&noRetention, nil, nil)
+	assert.EqualError(t, err, "default retention of 0s must be positive")
 	assert.Nil(t, svc)
 
 	t.Cleanup(func() { svc.Close() })
 }
 
+func TestForwardResolutionFromDHT(t *testing.T) {
+	svc1 := newDHTService(t, "d")
+	t.Cleanup(func() { svc1.Close() })
+
+	sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+	require.NoError(t, err)
+	d := did.DHT(doc.ID)
+	suffix, err := d.Suffix()
+	require.NoError(t, err)
+	packet, err := d.ToDNSPacket(*doc, nil, []did.AuthoritativeGateway{"gateway.example.com"}, nil)
+	require.NoError(t, err)
+	packed, err := packet.Pack()
+	require.NoError(t, err)
+
+	// service2 only finds the DID on Mainline, where it has an older version than its authoritative gateway
+	stalePut := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1700000000}
+	stalePut.Sign(sk)
+	require.NoError(t, svc1.PublishDHT(context.Background(), suffix, dht.RecordFromBEP44(&stalePut)))
+	svc2 := newDHTService(t, "e", anacrolixdht.NewAddr(svc1.dht.Addr()))
+	t.Cleanup(func() { svc2.Close() })
+
+	latestPut := bep44.Put{V: packed, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 1700000100}
+	latestPut.Sign(sk)
+	latest := gatewayResponse(&latestPut)
+	svc2.forwardClient = newTestGateways(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(latest)
+	}))
+
+	resolved, err := svc2.ResolveDID(context.Background(), suffix, nil)
+	require.NoError(t, err)
+	require.NotNil(t, resolved)
+	assert.Equal(t, int64(1700000100), resolved.Payload.Seq)
+	assert.Equal(t, "https://gateway.example.com", resolved.ResolutionMetadata.Gateway)
+}
+
+// blockingStorage blocks and deletes each record right after it is written, as a block made while the record is being
+// published would
+type blockingStorage struct {
+	storage.Storage
+}
+
+func (b blockingStorage) WriteRecord(ctx context.Context, record dht.BEP44Record) error {
+	if err := b.Storage.WriteRecord(ctx, record); err != nil {
+		return err
+	}
+	if err := b.Storage.BlockRecord(ctx, record.ID()); err != nil {
+		return err
+	}
+	return b.Storage.DeleteRecord(ctx, record.ID())
+}
+
+func TestLegacyConfig(t *testing.T) {
+	// a config written before the republish schedule properties were added still starts the service
+	cfg, err := config.LoadConfig("../../config/testdata/legacy-config.toml")
+	require.NoError(t, err)
+	db, err := storage.NewStorage("bolt://diddht-test-legacy.db")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove("diddht-test-legacy.db") })
+
+	svc, err := NewDHTService(cfg, db, dht.NewTestDHT(t))
+	require.NoError(t, err)
+	svc.Close()
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.215.14":         true,
+		"2606:2800:21f:cb07::1": true,
+		"127.0.0.1":             false,
+		"::1":                   false,
+		"10.1.2.3":              false,
+		"172.16.0.1":            false,
+		"192.168.1.1":           false,
+		"169.254.169.254":       false,
+		"fe80::1":               false,
+		"fc00::1":               false,
+		"100.64.0.1":            false,
+		"0.0.0.0":               false,
+		"::":                    false,
+		"224.0.0.1":             false,
+		"255.255.255.255":       false,
+		"::ffff:127.0.0.1":      false,
+		"64:ff9b::a00:1":        false,
+	} {
+		assert.Equal(t, public, isPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+// gatewayResponse returns the put as a gateway serves it, as sig:seq:v
+func gatewayResponse(put *bep44.Put) []byte {
+	var seqBuf [8]byte
+	binary.BigEndian.PutUint64(seqBuf[:], uint64(put.Seq))
+	return append(put.Sig[:], append(seqBuf[:], put.V.([]byte)...)...)
+}
+
+// newTestGateways starts a TLS server standing in for authoritative gateways, which the handler tells apart by the
+// requested host, and returns a client that reaches it for any domain name
+func newTestGateways(t *testing.T, handler http.Handler) *http.Client {
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	addr := server.Listener.Addr().String()
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+}
+
 func newDHTService(t *testing.T, id string, bootstrapPeers ...anacrolixdht.Addr) DHTService {
 	defaultConfig := config.GetDefaultConfig()
 
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/resolver"
+)
+
+const (
+	// maxForwardedGateways is the most authoritative gateways of a DID a read is forwarded to
+	maxForwardedGateways = 3
+	// forwardTimeout bounds the time spent forwarding a read to a DID's authoritative gateways
+	forwardTimeout = 3 * time.Second
+)
+
+// nonPublicPrefixes are the address ranges, beyond those netip reports as private, loopback, link-local or
+// multicast, that authoritative gateways may not resolve to
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// forwardedRecord is the result of forwarding a read to a DID's authoritative gateways as it is cached, with a nil
+// record if none of the gateways returned one
+type forwardedRecord struct {
+	Record  *dht.BEP44Response `json:"record,omitempty"`
+	Gateway string             `json:"gateway,omitempty"`
+}
+
+// newForwardClient returns the HTTP client reads are forwarded with. As publishers choose their authoritative gateways
+// without any authentication, it only connects to publicly routable addresses, checked after the gateway's domain name
+// is resolved, and does not use a proxy or follow redirects.
+func newForwardClient() *http.Client {
+	dialer := &net.Dialer{Timeout: forwardTimeout, Control: dialPublicOnly}
+	return &http.Client{
+		Timeout: forwardTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: forwardTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialPublicOnly refuses connections to addresses that are not publicly routable
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addr) {
+		return fmt.Errorf("refusing to connect to non-public address %s", addr)
+	}
+	return nil
+}
+
+// isPublicAddr returns true if the address is a publicly routable unicast address
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// getForwarded returns the record for the given z-base-32 encoded ID from its authoritative gateways along with the URL
+// of the gateway that answered, or nil if none of them returned a record at or above the given sequence number. The
+// result, including a failure, is cached so that reads of the DID do not each make requests to its gateways.
+func (s *DHTService) getForwarded(ctx context.Context, id string, gateways []did.AuthoritativeGateway, seq int64) (*dht.BEP44Response, string) {
+	var forwarded forwardedRecord
+	got, err := s.forwardCache.Get(id)
+	if err == nil {
+		err = json.Unmarshal(got, &forwarded)
+	}
+	if err != nil {
+		if !errors.Is(err, bigcache.ErrEntryNotFound) {
+			logrus.WithContext(ctx).WithError(err).WithField("record_id", id).Warn("failed to get forwarded record from cache")
+		}
+		forwarded = forwardedRecord{}
+		if record, err := forwardResolution(ctx, s.forwardClient, id, gateways); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("record_id", id).Warn("failed to resolve record from authoritative gateways")
+		} else {
+			resp := record.Response()
+			forwarded = forwardedRecord{Record: &resp, Gateway: record.Gateway}
+		}
+		if got, err = json.Marshal(forwarded); err == nil {
+			err = s.forwardCache.Set(id, got)
+		}
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("record_id", id).Error("failed to set forwarded record in cache")
+		}
+	}
+
+	if forwarded.Record == nil {
+		return nil, ""
+	}
+	if forwarded.Record.Seq < seq {
+		logrus.WithContext(ctx).WithField("record_id", id).WithField("gateway", forwarded.Gateway).Warn("authoritative gateway returned a stale record")
+		return nil, ""
+	}
+	return forwarded.Record, forwarded.Gateway
+}
+
+// forwardResolution resolves the record for the given z-base-32 encoded ID from up to maxForwardedGateways of its
+// authoritative gateways, verifying the signature of the record returned. Gateways not named by a domain name are
+// skipped.
+func forwardResolution(ctx context.Context, client *http.Client, id string, gateways []did.AuthoritativeGateway) (*resolver.Record, error) {
+	urls := make([]string, 0, maxForwardedGateways)
+	for _, g := range gateways {
+		if len(urls) == maxForwardedGateways {
+			break
+		}
+		u, err := g.URL()
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("record_id", id).Debug("skipping authoritative gateway")
+			continue
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("no valid authoritative gateways")
+	}
+	r, err := resolver.NewGatewayResolverWithClient(client, urls...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, forwardTimeout)
+	defer cancel()
+	return r.GetRecord(ctx, did.Prefix+":"+id)
+}
@@ -0,0 +1,539 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ssiutil "github.com/TBD54566975/ssi-sdk/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/TBD54566975/did-dht/config"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+const (
+	// maxRepublishInterval is the lifetime of a record on Mainline, which records must be republished within
+	maxRepublishInterval = 2 * time.Hour
+	// republishPollInterval is how often the schedule is checked for records due to be republished
+	republishPollInterval = time.Minute
+	// republishBackoff is how long after its first failure a record is retried, doubling with each failure after
+	republishBackoff = 5 * time.Minute
+)
+
+// republisher republishes each record in storage on its own schedule https://did-dht.com/#republishing-data. Every
+// record keeps its next republish time in storage, so records are republished spread across the republish interval,
+// and a restarted gateway carries on from its schedule rather than republishing every record at once. Records due
+// are queued in batches for a fixed number of workers, so only as many puts as there are workers wait on the DHT.
+// Records that fail are retried with exponential backoff, and quarantined once they fail too many times in a row.
+type republisher struct {
+	svc         *DHTService
+	interval    time.Duration
+	concurrency int
+	timeout     time.Duration
+	batchSize   int
+	maxFailures int
+	metrics     *republishMetrics
+
+	// ctx is cancelled when the republisher is stopped, ending any run in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// scheduled is set once records without a schedule, such as those stored by an earlier version, have been scheduled
+	scheduled bool
+	// lastEviction is when records whose retention has expired were last evicted
+	lastEviction time.Time
+	// rescheduling is set while every record is being scheduled to be republished at once
+	rescheduling atomic.Bool
+}
+
+// newRepublisher returns a republisher for the records of the given service, as configured
+func newRepublisher(svc *DHTService, cfg config.DHTServiceConfig) (*republisher, error) {
+	interval := time.Duration(cfg.RepublishIntervalSeconds) * time.Second
+	if interval <= 0 || interval >= maxRepublishInterval {
+		return nil, ssiutil.LoggingNewErrorf("republish interval of %ds must be positive and under the %s lifetime of a record", cfg.RepublishIntervalSeconds, maxRepublishInterval)
+	}
+	if cfg.RepublishConcurrency <= 0 {
+		return nil, ssiutil.LoggingNewErrorf("republish concurrency of %d must be positive", cfg.RepublishConcurrency)
+	}
+	if cfg.RepublishTimeoutSeconds <= 0 {
+		return nil, ssiutil.LoggingNewErrorf("republish timeout of %ds must be positive", cfg.RepublishTimeoutSeconds)
+	}
+	if cfg.RepublishBatchSize <= 0 {
+		return nil, ssiutil.LoggingNewErrorf("republish batch size of %d must be positive", cfg.RepublishBatchSize)
+	}
+	if cfg.RepublishMaxFailures <= 0 {
+		return nil, ssiutil.LoggingNewErrorf("republish max failures of %d must be positive", cfg.RepublishMaxFailures)
+	}
+	metrics, err := newRepublishMetrics(telemetry.GetMeter())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create republish metrics")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &republisher{
+		svc:         svc,
+		interval:    interval,
+		concurrency: cfg.RepublishConcurrency,
+		timeout:     time.Duration(cfg.RepublishTimeoutSeconds) * time.Second,
+		batchSize:   cfg.RepublishBatchSize,
+		maxFailures: cfg.RepublishMaxFailures,
+		metrics:     metrics,
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+// stop ends any run in progress, leaving the records it had not republished due
+func (r *republisher) stop() {
+	r.cancel()
+}
+
+// nextRepublish returns when a record republished at the given time is next due, up to a tenth of the interval early
+// so that records published together drift apart
+func (r *republisher) nextRepublish(now time.Time) time.Time {
+	return now.Add(r.interval - rand.N(r.interval/10))
+}
+
+// retryAt returns when a record that has failed to be republished the given number of times in a row is next retried.
+// The backoff doubles with each failure up to the interval, and is jittered by up to half so failed records drift apart.
+func (r *republisher) retryAt(now time.Time, failures int) time.Time {
+	backoff := republishBackoff
+	for i := 1; i < failures && backoff < r.interval; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, r.interval)
+	return now.Add(backoff - rand.N(backoff/2))
+}
+
+// schedule schedules the record with the given id to be republished an interval after it was published
+func (r *republisher) schedule(ctx context.Context, id string) error {
+	return r.svc.db.WriteNextRepublish(ctx, id, r.nextRepublish(time.Now()))
+}
+
+// run evicts expired records and republishes the records that are due, scheduling any records without a schedule
+// on its first run
+func (r *republisher) run() {
+	ctx, span := telemetry.GetTracer().Start(r.ctx, "DHTService.republish")
+	defer span.End()
+
+	if !r.scheduled {
+		if err := r.scheduleUnscheduledRecords(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("failed to schedule records for republishing")
+		} else {
+			r.scheduled = true
+		}
+	}
+
+	// evict records whose retention has expired so they are no longer republished
+	if time.Since(r.lastEviction) >= r.interval {
+		r.svc.evictExpiredRecords(ctx)
+		r.lastEviction = time.Now()
+	}
+
+	r.republishDueRecords(ctx, time.Now())
+}
+
+// scheduleUnscheduledRecords gives every record without a republish time one spread evenly across the next interval,
+// so that records are not all republished at once
+func (r *republisher) scheduleUnscheduledRecords(ctx context.Context) error {
+	var scheduledCnt int
+	for {
+		now := time.Now()
+		ids, err := r.svc.db.ListUnscheduledRecords(ctx, now, r.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err = r.svc.db.WriteNextRepublish(ctx, id, now.Add(rand.N(r.interval))); err != nil {
+				return errors.Wrapf(err, "failed to schedule record %s", id)
+			}
+			scheduledCnt++
+		}
+		if len(ids) < r.batchSize {
+			break
+		}
+	}
+	if scheduledCnt > 0 {
+		logrus.WithContext(ctx).WithField("record_count", scheduledCnt).Info("scheduled records for republishing")
+	}
+	return nil
+}
+
+// scheduleAllRecords schedules every stored record that is neither quarantined nor expired to be republished at the
+// given time
+func (r *republisher) scheduleAllRecords(ctx context.Context, next time.Time) error {
+	failedRecords, err := r.svc.db.ListFailedRecords(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list failed records")
+	}
+	quarantined := make(map[string]bool)
+	for _, record := range failedRecords {
+		if record.Quarantined {
+			quarantined[record.ID] = true
+		}
+	}
+
+	var scheduledCnt int
+	var pageToken []byte
+	for ctx.Err() == nil {
+		var records []dht.BEP44Record
+		if records, pageToken, err = r.svc.db.ListRecords(ctx, pageToken, r.batchSize); err != nil {
+			return errors.Wrap(err, "failed to list records")
+		}
+		for _, record := range records {
+			if quarantined[record.ID()] {
+				continue
+			}
+			expiry, err := r.svc.db.ReadRecordExpiry(ctx, record.ID())
+			if err != nil {
+				return errors.Wrapf(err, "failed to read expiry of record %s", record.ID())
+			}
+			if !expiry.IsZero() && expiry.Before(next) {
+				continue
+			}
+			if err = r.svc.db.WriteNextRepublish(ctx, record.ID(), next); err != nil {
+				return errors.Wrapf(err, "failed to schedule record %s", record.ID())
+			}
+			scheduledCnt++
+		}
+		if pageToken == nil {
+			break
+		}
+	}
+	logrus.WithContext(ctx).WithField("record_count", scheduledCnt).Info("scheduled all records for republishing")
+	return ctx.Err()
+}
+
+// republishResult is the outcome of republishing a record
+type republishResult struct {
+	id string
+	// record is the record republished, or nil if it was deleted after it was queued
+	record *dht.BEP44Record
+	// err is set if the record could not be put to the DHT
+	err error
+	// rescheduled is set once the record's next republish time has been written, or it has been quarantined or
+	// removed from the schedule, so it is not listed as due again
+	rescheduled bool
+	// quarantined is set if the record failed too many times in a row and is no longer republished
+	quarantined bool
+}
+
+// republishDueRecords republishes the records due before the given time, those due the longest first. Records are
+// read a batch at a time and queued for the workers, and the next batch is read only once the workers have finished
+// the last, so storage is read no faster than records can be put to the DHT.
+func (r *republisher) republishDueRecords(ctx context.Context, now time.Time) {
+	queue := make(chan string, r.batchSize)
+	results := make(chan republishResult, r.batchSize)
+	var wg sync.WaitGroup
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				results <- r.republishRecord(ctx, id)
+			}
+		}()
+	}
+	defer func() {
+		close(queue)
+		wg.Wait()
+	}()
+
+	republishStart := time.Now()
+	var dueCnt, failedCnt, quarantinedCnt int
+	for ctx.Err() == nil {
+		ids, err := r.svc.db.ListDueRecords(ctx, now, r.batchSize)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("failed to list records due for republishing")
+			break
+		}
+		dueCnt += len(ids)
+
+		r.metrics.queued.Add(ctx, int64(len(ids)))
+		for _, id := range ids {
+			queue <- id
+		}
+		var rescheduledCnt int
+		for range ids {
+			result := <-results
+			r.metrics.queued.Add(ctx, -1)
+			if result.err != nil {
+				failedCnt++
+			}
+			if result.quarantined {
+				quarantinedCnt++
+			}
+			if result.rescheduled {
+				rescheduledCnt++
+			}
+		}
+
+		// records that could not be rescheduled would be listed again
+		if len(ids) < r.batchSize || rescheduledCnt == 0 {
+			break
+		}
+	}
+	if dueCnt == 0 {
+		logrus.WithContext(ctx).Debug("no records due for republishing")
+		return
+	}
+
+	successRate := float64(dueCnt-failedCnt) / float64(dueCnt) * 100
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"success":     dueCnt - failedCnt,
+		"errors":      failedCnt,
+		"quarantined": quarantinedCnt,
+		"total":       dueCnt,
+		"duration":    time.Since(republishStart).String(),
+	}).Infof("republished [%d] due records with a [%.2f] percent success rate", dueCnt, successRate)
+
+	if failedCnt > 0 {
+		failedRecordCnt, err := r.svc.db.FailedRecordCount(ctx)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("failed to get failed record count")
+			return
+		}
+		logrus.WithContext(ctx).WithField("failed_record_count", failedRecordCnt).Warn("total count of records failing to republish")
+	}
+}
+
+// republishRecord puts the stored record with the given id to the DHT and reschedules it, clearing its failures.
+// Deactivated DIDs are left to expire from the DHT, so one still scheduled is removed from the schedule instead.
+func (r *republisher) republishRecord(ctx context.Context, id string) republishResult {
+	result := republishResult{id: id}
+	var deactivated bool
+	result.record, deactivated, result.err = r.putRecord(ctx, id)
+	switch {
+	case result.record == nil && result.err == nil:
+		// the record was deleted after it was listed
+		return result
+	case result.err != nil:
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(result.err).Debug("failed to republish record")
+		return r.recordFailure(ctx, result)
+	}
+
+	if err := r.svc.db.DeleteFailedRecord(ctx, id); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to clear record failures")
+	}
+	if deactivated {
+		if err := r.svc.db.DeleteNextRepublish(ctx, id); err != nil {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to unschedule deactivated record")
+			return result
+		}
+		result.rescheduled = true
+		return result
+	}
+	// records stored before every record had an expiry are retained for the default period from their next republish
+	if expiry, err := r.svc.db.ReadRecordExpiry(ctx, id); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to read record expiry")
+	} else if expiry.IsZero() {
+		if err = r.svc.db.WriteRecordExpiry(ctx, id, r.svc.defaultExpiry(time.Now())); err != nil {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to retain record")
+		}
+	}
+	if err := r.schedule(ctx, id); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to reschedule record")
+		return result
+	}
+	result.rescheduled = true
+	return result
+}
+
+// recordFailure counts a failure to republish a record, and either schedules it to be retried with backoff or, once it
+// has failed too many times in a row, quarantines it
+func (r *republisher) recordFailure(ctx context.Context, result republishResult) republishResult {
+	failures, err := r.svc.db.WriteFailedRecord(ctx, result.id)
+	if err != nil {
+		logrus.WithContext(ctx).WithField("record_id", result.id).WithError(err).Warn("failed to write failed record")
+		failures = 1
+	}
+
+	if failures >= r.maxFailures {
+		if err = r.svc.db.QuarantineRecord(ctx, result.id); err == nil {
+			logrus.WithContext(ctx).WithField("record_id", result.id).Warnf("quarantined record after [%d] failures in a row", failures)
+			r.metrics.quarantined.Add(ctx, 1)
+			result.quarantined = true
+			result.rescheduled = true
+			return result
+		}
+		logrus.WithContext(ctx).WithField("record_id", result.id).WithError(err).Warn("failed to quarantine record")
+	}
+
+	if err = r.svc.db.WriteNextRepublish(ctx, result.id, r.retryAt(time.Now(), failures)); err != nil {
+		logrus.WithContext(ctx).WithField("record_id", result.id).WithError(err).Warn("failed to reschedule record")
+		return result
+	}
+	result.rescheduled = true
+	return result
+}
+
+// putRecord puts the stored record with the given id to the DHT, returning the record, or nil if it is not found.
+// Records of deactivated DIDs scheduled before they were deactivated are not put, which is returned as true.
+func (r *republisher) putRecord(ctx context.Context, id string) (*dht.BEP44Record, bool, error) {
+	record, err := r.svc.db.ReadRecord(ctx, id)
+	if err != nil {
+		r.metrics.records.Add(ctx, 1, metric.WithAttributes(resultFailure))
+		return nil, false, errors.Wrap(err, "failed to read record")
+	}
+	if record == nil {
+		return nil, false, nil
+	}
+	if doc, err := decodeDocument(id, record.Value); err == nil && doc.Deactivated {
+		logrus.WithContext(ctx).WithField("record_id", id).Debug("skipping republish of deactivated record")
+		r.metrics.records.Add(ctx, 1, metric.WithAttributes(resultSkipped))
+		return record, true, nil
+	}
+
+	putStart := time.Now()
+	putCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err = r.svc.dht.Put(putCtx, record.Put())
+	r.metrics.putDuration.Record(ctx, time.Since(putStart).Seconds())
+	if err != nil {
+		r.metrics.records.Add(ctx, 1, metric.WithAttributes(resultFailure))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return record, false, errors.New("republish timeout exceeded")
+		}
+		return record, false, err
+	}
+	r.metrics.records.Add(ctx, 1, metric.WithAttributes(resultSuccess))
+	return record, false, nil
+}
+
+var (
+	resultSuccess = attribute.String("result", "success")
+	resultFailure = attribute.String("result", "failure")
+	resultSkipped = attribute.String("result", "skipped")
+)
+
+// republishMetrics are the metrics exported on the progress of republishing
+type republishMetrics struct {
+	// records counts the records republished, by result: success, failure or skipped
+	records metric.Int64Counter
+	// queued is the number of records queued for the workers or being republished
+	queued metric.Int64UpDownCounter
+	// putDuration is how long records take to be put to the DHT
+	putDuration metric.Float64Histogram
+	// quarantined counts the records quarantined after failing too many times in a row
+	quarantined metric.Int64Counter
+}
+
+// newRepublishMetrics creates the republish metrics with the given meter
+func newRepublishMetrics(meter metric.Meter) (*republishMetrics, error) {
+	records, err := meter.Int64Counter("republish.records",
+		metric.WithDescription("Records republished, by result"),
+		metric.WithUnit("{record}"))
+	if err != nil {
+		return nil, err
+	}
+	queued, err := meter.Int64UpDownCounter("republish.queued",
+		metric.WithDescription("Records queued for republishing or being republished"),
+		metric.WithUnit("{record}"))
+	if err != nil {
+		return nil, err
+	}
+	putDuration, err := meter.Float64Histogram("republish.put.duration",
+		metric.WithDescription("Time taken to put a record to the DHT"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	quarantined, err := meter.Int64Counter("republish.quarantined",
+		metric.WithDescription("Records quarantined after failing to republish too many times in a row"),
+		metric.WithUnit("{record}"))
+	if err != nil {
+		return nil, err
+	}
+	return &republishMetrics{records: records, queued: queued, putDuration: putDuration, quarantined: quarantined}, nil
+}
+
+// evictExpiredRecords evicts all records whose expiry has passed from the Retained DID Set, removing them from the
+// republish schedule. Evicted records are still stored and served, and are republished again once they are next
+// published.
+func (s *DHTService) evictExpiredRecords(ctx context.Context) {
+	expired, err := s.db.ListExpiredRecords(ctx, time.Now())
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("failed to list expired records")
+		return
+	}
+
+	var evictedCnt int
+	for _, id := range expired {
+		if err = s.db.DeleteNextRepublish(ctx, id); err != nil {
+			logrus.WithContext(ctx).WithField("record_id", id).WithError(err).Warn("failed to evict expired record")
+			continue
+		}
+		evictedCnt++
+	}
+	logrus.WithContext(ctx).WithField("evicted_count", evictedCnt).Info("evicted expired records")
+}
+
+// ErrRecordNotQuarantined is returned when retrying or purging a record that is not quarantined
+var ErrRecordNotQuarantined = errors.New("record is not quarantined")
+
+// ListQuarantinedRecords returns the records quarantined after failing to be republished too many times in a row
+func (s *DHTService) ListQuarantinedRecords(ctx context.Context) ([]dht.FailedRecord, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.ListQuarantinedRecords")
+	defer span.End()
+
+	failedRecords, err := s.db.ListFailedRecords(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list failed records")
+	}
+	quarantined := make([]dht.FailedRecord, 0, len(failedRecords))
+	for _, record := range failedRecords {
+		if record.Quarantined {
+			quarantined = append(quarantined, record)
+		}
+	}
+	return quarantined, nil
+}
+
+// RetryQuarantinedRecord clears the failures of a quarantined record and schedules it to be republished at once
+func (s *DHTService) RetryQuarantinedRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.RetryQuarantinedRecord")
+	defer span.End()
+
+	if err := s.checkQuarantined(ctx, id); err != nil {
+		return err
+	}
+	// scheduled before its failures are cleared, so a record is never left quarantined and unscheduled
+	if err := s.db.WriteNextRepublish(ctx, id, time.Now()); err != nil {
+		return errors.Wrapf(err, "failed to schedule record %s", id)
+	}
+	if err := s.db.DeleteFailedRecord(ctx, id); err != nil {
+		return errors.Wrapf(err, "failed to clear failures of record %s", id)
+	}
+	logrus.WithContext(ctx).WithField("record_id", id).Info("retrying quarantined record")
+	return nil
+}
+
+// PurgeQuarantinedRecord deletes a quarantined record, so it is no longer served or republished
+func (s *DHTService) PurgeQuarantinedRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "DHTService.PurgeQuarantinedRecord")
+	defer span.End()
+
+	if err := s.checkQuarantined(ctx, id); err != nil {
+		return err
+	}
+	return s.deleteRecord(ctx, id)
+}
+
+// checkQuarantined returns ErrRecordNotQuarantined unless the record with the given id is quarantined
+func (s *DHTService) checkQuarantined(ctx context.Context, id string) error {
+	failed, err := s.db.ReadFailedRecord(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read failures of record %s", id)
+	}
+	if failed == nil || !failed.Quarantined {
+		return ErrRecordNotQuarantined
+	}
+	return nil
+}
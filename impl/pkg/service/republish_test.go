@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/TBD54566975/did-dht/config"
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
+)
+
+func TestRepublisher(t *testing.T) {
+	svc := newDHTService(t, "republish")
+	// republish only when the tests do
+	svc.scheduler.Stop()
+	interval := time.Duration(svc.cfg.DHTConfig.RepublishIntervalSeconds) * time.Second
+
+	t.Run("test published records are scheduled", func(t *testing.T) {
+		record := dht.NewTestRecord(t)
+		start := time.Now().Truncate(time.Second)
+		require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+
+		next, err := svc.db.ReadNextRepublish(context.Background(), record.ID())
+		require.NoError(t, err)
+		assert.WithinRange(t, next, start.Add(interval*9/10), time.Now().Add(interval))
+	})
+
+	t.Run("test unscheduled records are spread across the interval", func(t *testing.T) {
+		// records stored without a schedule, as by an earlier version of the gateway
+		var ids []string
+		for i := 0; i < 10; i++ {
+			record := dht.NewTestRecord(t)
+			require.NoError(t, svc.db.WriteRecord(context.Background(), record))
+			ids = append(ids, record.ID())
+		}
+		unscheduled, err := svc.db.ListUnscheduledRecords(context.Background(), time.Now(), 100)
+		require.NoError(t, err)
+		assert.Subset(t, unscheduled, ids)
+
+		start := time.Now().Truncate(time.Second)
+		require.NoError(t, svc.republisher.scheduleUnscheduledRecords(context.Background()))
+		unscheduled, err = svc.db.ListUnscheduledRecords(context.Background(), time.Now(), 100)
+		require.NoError(t, err)
+		assert.Empty(t, unscheduled)
+
+		times := make(map[int64]bool)
+		for _, id := range ids {
+			next, err := svc.db.ReadNextRepublish(context.Background(), id)
+			require.NoError(t, err)
+			assert.WithinRange(t, next, start, time.Now().Add(interval))
+			times[next.Unix()] = true
+		}
+		assert.Greater(t, len(times), 1)
+	})
+
+	t.Run("test due records are republished and rescheduled", func(t *testing.T) {
+		var ids []string
+		for i := 0; i < 3; i++ {
+			record := dht.NewTestRecord(t)
+			require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+			ids = append(ids, record.ID())
+		}
+
+		// a restarted gateway finds the records overdue, the longest overdue listed first
+		now := time.Now()
+		for i, id := range ids {
+			require.NoError(t, svc.db.WriteNextRepublish(context.Background(), id, now.Add(-time.Duration(len(ids)-i)*time.Minute)))
+		}
+		due, err := svc.db.ListDueRecords(context.Background(), now, 100)
+		require.NoError(t, err)
+		assert.Equal(t, ids, due)
+		due, err = svc.db.ListDueRecords(context.Background(), now, 2)
+		require.NoError(t, err)
+		assert.Equal(t, ids[:2], due)
+
+		svc.republisher.republishDueRecords(context.Background(), now)
+
+		due, err = svc.db.ListDueRecords(context.Background(), now, 100)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+		for _, id := range ids {
+			next, err := svc.db.ReadNextRepublish(context.Background(), id)
+			require.NoError(t, err)
+			assert.True(t, next.After(now))
+		}
+	})
+
+	t.Run("test due records are republished in batches by the workers", func(t *testing.T) {
+		cfg := svc.cfg.DHTConfig
+		cfg.RepublishConcurrency = 2
+		cfg.RepublishBatchSize = 2
+		r, err := newRepublisher(&svc, cfg)
+		require.NoError(t, err)
+		reader := sdkmetric.NewManualReader()
+		r.metrics, err = newRepublishMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+		require.NoError(t, err)
+
+		now := time.Now()
+		var ids []string
+		for i := 0; i < 5; i++ {
+			record := dht.NewTestRecord(t)
+			require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+			require.NoError(t, svc.db.WriteNextRepublish(context.Background(), record.ID(), now.Add(-time.Minute)))
+			ids = append(ids, record.ID())
+		}
+
+		r.republishDueRecords(context.Background(), now)
+
+		due, err := svc.db.ListDueRecords(context.Background(), now, 100)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		assert.Equal(t, int64(len(ids)), metricSum(t, rm, "republish.records"))
+		assert.Equal(t, int64(0), metricSum(t, rm, "republish.queued"))
+	})
+
+	t.Run("test a stopped republisher republishes nothing", func(t *testing.T) {
+		r, err := newRepublisher(&svc, svc.cfg.DHTConfig)
+		require.NoError(t, err)
+		r.stop()
+
+		record := dht.NewTestRecord(t)
+		require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+		now := time.Now()
+		require.NoError(t, svc.db.WriteNextRepublish(context.Background(), record.ID(), now.Add(-time.Minute)))
+
+		r.run()
+		due, err := svc.db.ListDueRecords(context.Background(), now, 100)
+		require.NoError(t, err)
+		assert.Contains(t, due, record.ID())
+		require.NoError(t, svc.db.WriteNextRepublish(context.Background(), record.ID(), now.Add(time.Hour)))
+	})
+
+	t.Run("test failed records back off and are quarantined", func(t *testing.T) {
+		cfg := svc.cfg.DHTConfig
+		cfg.RepublishMaxFailures = 3
+		r, err := newRepublisher(&svc, cfg)
+		require.NoError(t, err)
+		// no put completes in time
+		r.timeout = time.Nanosecond
+
+		ctx := context.Background()
+		record := dht.NewTestRecord(t)
+		id := record.ID()
+		failRecord := func() republishResult {
+			result := r.republishRecord(ctx, id)
+			require.Error(t, result.err)
+			assert.True(t, result.rescheduled)
+			return result
+		}
+		quarantineRecord := func() {
+			require.NoError(t, svc.PublishDHT(ctx, id, record))
+			for i := 1; i < cfg.RepublishMaxFailures; i++ {
+				start := time.Now().Truncate(time.Second)
+				assert.False(t, failRecord().quarantined)
+
+				// each failure doubles the backoff
+				next, err := svc.db.ReadNextRepublish(ctx, id)
+				require.NoError(t, err)
+				backoff := republishBackoff << (i - 1)
+				assert.WithinRange(t, next, start.Add(backoff/2), time.Now().Add(backoff))
+			}
+			assert.True(t, failRecord().quarantined)
+		}
+
+		quarantineRecord()
+		quarantined, err := svc.ListQuarantinedRecords(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, quarantined, dht.FailedRecord{ID: id, Count: 3, Quarantined: true})
+		next, err := svc.db.ReadNextRepublish(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, next.IsZero())
+
+		// a retried record is due at once, and starts over without failures
+		require.NoError(t, svc.RetryQuarantinedRecord(ctx, id))
+		due, err := svc.db.ListDueRecords(ctx, time.Now().Add(time.Second), 100)
+		require.NoError(t, err)
+		assert.Contains(t, due, id)
+		quarantined, err = svc.ListQuarantinedRecords(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, quarantined)
+		assert.ErrorIs(t, svc.RetryQuarantinedRecord(ctx, id), ErrRecordNotQuarantined)
+		assert.ErrorIs(t, svc.PurgeQuarantinedRecord(ctx, id), ErrRecordNotQuarantined)
+		assert.False(t, failRecord().quarantined)
+
+		// a successful republish clears the failures
+		r.timeout = time.Duration(cfg.RepublishTimeoutSeconds) * time.Second
+		require.NoError(t, r.republishRecord(ctx, id).err)
+		failed, err := svc.db.ListFailedRecords(ctx)
+		require.NoError(t, err)
+		for _, f := range failed {
+			assert.NotEqual(t, id, f.ID)
+		}
+
+		// a purged record is deleted
+		r.timeout = time.Nanosecond
+		quarantineRecord()
+		require.NoError(t, svc.PurgeQuarantinedRecord(ctx, id))
+		got, err := svc.db.ReadRecord(ctx, id)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+		quarantined, err = svc.ListQuarantinedRecords(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, quarantined)
+	})
+
+	t.Run("test all records are scheduled at once", func(t *testing.T) {
+		ctx := context.Background()
+		var ids []string
+		for i := 0; i < 3; i++ {
+			record := dht.NewTestRecord(t)
+			require.NoError(t, svc.PublishDHT(ctx, record.ID(), record))
+			ids = append(ids, record.ID())
+		}
+		// quarantined records are left unscheduled
+		_, err := svc.db.WriteFailedRecord(ctx, ids[2])
+		require.NoError(t, err)
+		require.NoError(t, svc.db.QuarantineRecord(ctx, ids[2]))
+
+		now := time.Now()
+		require.NoError(t, svc.republisher.scheduleAllRecords(ctx, now))
+		due, err := svc.db.ListDueRecords(ctx, now.Add(time.Second), 1000)
+		require.NoError(t, err)
+		assert.Contains(t, due, ids[0])
+		assert.Contains(t, due, ids[1])
+		assert.NotContains(t, due, ids[2])
+
+		svc.republisher.republishDueRecords(ctx, now.Add(time.Second))
+		require.NoError(t, svc.PurgeQuarantinedRecord(ctx, ids[2]))
+	})
+
+	t.Run("test deactivated records are removed from the schedule", func(t *testing.T) {
+		sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		d := did.DHT(doc.ID)
+		packet, err := d.ToDNSPacket(*doc, nil, nil, nil)
+		require.NoError(t, err)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		record := dht.RecordFromBEP44(putMsg)
+		require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+
+		// a record deactivated while scheduled, as by an earlier version of the gateway
+		packet, err = d.CreateDeactivatedPacket()
+		require.NoError(t, err)
+		putMsg, err = dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
+		require.NoError(t, err)
+		putMsg.Seq = record.SequenceNumber + 1
+		require.NoError(t, signer.SignPut(signer.NewInMemorySigner(sk), putMsg))
+		require.NoError(t, svc.db.WriteRecord(context.Background(), dht.RecordFromBEP44(putMsg)))
+		next, err := svc.db.ReadNextRepublish(context.Background(), record.ID())
+		require.NoError(t, err)
+		require.False(t, next.IsZero())
+
+		result := svc.republisher.republishRecord(context.Background(), record.ID())
+		assert.NoError(t, result.err)
+		assert.True(t, result.rescheduled)
+		next, err = svc.db.ReadNextRepublish(context.Background(), record.ID())
+		require.NoError(t, err)
+		assert.True(t, next.IsZero())
+	})
+
+	t.Run("test deleted records are not rescheduled", func(t *testing.T) {
+		record := dht.NewTestRecord(t)
+		require.NoError(t, svc.PublishDHT(context.Background(), record.ID(), record))
+		require.NoError(t, svc.db.DeleteRecord(context.Background(), record.ID()))
+
+		next, err := svc.db.ReadNextRepublish(context.Background(), record.ID())
+		require.NoError(t, err)
+		assert.True(t, next.IsZero())
+	})
+}
+
+func TestNewRepublisher(t *testing.T) {
+	cfg := config.GetDefaultConfig().DHTConfig
+	r, err := newRepublisher(nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, r.interval)
+
+	for i := 0; i < 100; i++ {
+		next := r.nextRepublish(time.Unix(0, 0))
+		assert.WithinRange(t, next, time.Unix(0, 0).Add(81*time.Minute), time.Unix(0, 0).Add(90*time.Minute))
+	}
+
+	// retries back off from five minutes, doubling up to the interval
+	for failures, backoff := range map[int]time.Duration{1: 5 * time.Minute, 2: 10 * time.Minute, 4: 40 * time.Minute, 5: 80 * time.Minute, 6: 90 * time.Minute, 100: 90 * time.Minute} {
+		for i := 0; i < 100; i++ {
+			next := r.retryAt(time.Unix(0, 0), failures)
+			assert.WithinRange(t, next, time.Unix(0, 0).Add(backoff/2), time.Unix(0, 0).Add(backoff))
+		}
+	}
+
+	cfg.RepublishIntervalSeconds = 7200
+	_, err = newRepublisher(nil, cfg)
+	assert.EqualError(t, err, "republish interval of 7200s must be positive and under the 2h0m0s lifetime of a record")
+
+	cfg = config.GetDefaultConfig().DHTConfig
+	cfg.RepublishConcurrency = 0
+	_, err = newRepublisher(nil, cfg)
+	assert.EqualError(t, err, "republish concurrency of 0 must be positive")
+
+	cfg = config.GetDefaultConfig().DHTConfig
+	cfg.RepublishTimeoutSeconds = -1
+	_, err = newRepublisher(nil, cfg)
+	assert.EqualError(t, err, "republish timeout of -1s must be positive")
+
+	cfg = config.GetDefaultConfig().DHTConfig
+	cfg.RepublishBatchSize = 0
+	_, err = newRepublisher(nil, cfg)
+	assert.EqualError(t, err, "republish batch size of 0 must be positive")
+
+	cfg = config.GetDefaultConfig().DHTConfig
+	cfg.RepublishMaxFailures = 0
+	_, err = newRepublisher(nil, cfg)
+	assert.EqualError(t, err, "republish max failures of 0 must be positive")
+}
+
+// metricSum returns the sum of the data points of the integer sum metric with the given name
+func metricSum(t *testing.T, rm metricdata.ResourceMetrics, name string) int64 {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			require.True(t, ok, "metric %s is not an integer sum", name)
+			var total int64
+			for _, dp := range sum.DataPoints {
+				total += dp.Value
+			}
+			return total
+		}
+	}
+	require.Failf(t, "metric not found", "no metric named %s", name)
+	return 0
+}
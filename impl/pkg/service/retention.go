@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	ssiutil "github.com/TBD54566975/ssi-sdk/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TBD54566975/did-dht/config"
+	dhtint "github.com/TBD54566975/did-dht/internal/dht"
+	"github.com/TBD54566975/did-dht/internal/did"
+	"github.com/TBD54566975/did-dht/pkg/telemetry"
+)
+
+const (
+	// MinRetentionDifficulty is the minimum number of leading zero bits a retention challenge may require
+	// https://did-dht.com/#generating-a-retention-solution
+	MinRetentionDifficulty = 26
+
+	LocalHashSourceName   = "local"
+	BitcoinHashSourceName = "bitcoin"
+)
+
+var (
+	// ErrRetentionDisabled is returned when retention sets have been disabled on the gateway
+	ErrRetentionDisabled = errors.New("retention sets have been temporarily disabled")
+	// ErrInvalidRetentionSolution is returned when a retention solution does not solve a current challenge
+	ErrInvalidRetentionSolution = errors.New("invalid retention solution")
+)
+
+// HashSource supplies the hashes used as input for retention challenges
+// https://did-dht.com/registry/index.html#hash-source
+type HashSource interface {
+	// Name returns the name of the hash source as it appears in the Hash Source Registry
+	Name() string
+	// NextHash returns a fresh hash to issue challenges against
+	NextHash(ctx context.Context) (string, error)
+}
+
+// LocalHashSource is a deterministic hash source for offline use, producing a SHA-256 hash chain from a seed
+type LocalHashSource struct {
+	mu   sync.Mutex
+	last [sha256.Size]byte
+}
+
+// NewLocalHashSource returns a new local hash source seeded with the given value
+func NewLocalHashSource(seed string) *LocalHashSource {
+	return &LocalHashSource{last: sha256.Sum256([]byte(seed))}
+}
+
+func (*LocalHashSource) Name() string {
+	return LocalHashSourceName
+}
+
+// NextHash advances the hash chain and returns the hex-encoded result
+func (l *LocalHashSource) NextHash(context.Context) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last = sha256.Sum256(l.last[:])
+	return hex.EncodeToString(l.last[:]), nil
+}
+
+// BlockHashClient fetches the hash of the latest block from a Bitcoin node or block explorer
+type BlockHashClient interface {
+	LatestBlockHash(ctx context.Context) (string, error)
+}
+
+// BitcoinHashSource issues challenges against the latest Bitcoin block hash
+type BitcoinHashSource struct {
+	client BlockHashClient
+}
+
+// NewBitcoinHashSource returns a new Bitcoin hash source backed by the given client
+func NewBitcoinHashSource(client BlockHashClient) *BitcoinHashSource {
+	return &BitcoinHashSource{client: client}
+}
+
+func (*BitcoinHashSource) Name() string {
+	return BitcoinHashSourceName
+}
+
+// NextHash returns the hash of the latest Bitcoin block
+func (b *BitcoinHashSource) NextHash(ctx context.Context) (string, error) {
+	if b.client == nil {
+		return "", errors.New("no bitcoin block hash client configured")
+	}
+	return b.client.LatestBlockHash(ctx)
+}
+
+// RetentionChallenge is a challenge a client must solve to have its DID retained
+// https://did-dht.com/#get-the-current-challenge
+type RetentionChallenge struct {
+	Hash       string
+	HashSource string
+	Difficulty int
+	// Expiry is the approximate Unix Timestamp in seconds at which a DID retained against the challenge will be evicted
+	Expiry int64
+}
+
+// RetentionService issues retention challenges and validates retention solutions, periodically rotating the
+// challenge hash from its hash source
+type RetentionService struct {
+	cfg       *config.RetentionConfig
+	source    HashSource
+	scheduler *dhtint.Scheduler
+
+	mu           sync.RWMutex
+	current      string
+	previous     string
+	previousEnds time.Time
+}
+
+// NewRetentionService returns a new instance of the retention service, issuing challenges against the given hash source
+func NewRetentionService(cfg *config.Config, source HashSource) (*RetentionService, error) {
+	if cfg == nil {
+		return nil, ssiutil.LoggingNewError("config is required")
+	}
+	svc := RetentionService{cfg: &cfg.RetentionConfig, source: source}
+	if !svc.Enabled() {
+		logrus.Info("retention sets are disabled")
+		return &svc, nil
+	}
+
+	if source == nil {
+		return nil, ssiutil.LoggingNewError("hash source is required")
+	}
+	if svc.cfg.Difficulty < MinRetentionDifficulty {
+		logrus.WithField("difficulty", svc.cfg.Difficulty).Warnf("retention difficulty is below the minimum of %d", MinRetentionDifficulty)
+	}
+	if err := svc.rotate(context.Background()); err != nil {
+		return nil, ssiutil.LoggingErrorMsg(err, "failed to get initial challenge hash")
+	}
+
+	scheduler := dhtint.NewScheduler()
+	svc.scheduler = &scheduler
+	if err := scheduler.Schedule(svc.cfg.RefreshCRON, func() {
+		if err := svc.rotate(context.Background()); err != nil {
+			logrus.WithError(err).Error("failed to rotate challenge hash")
+		}
+	}); err != nil {
+		return nil, ssiutil.LoggingErrorMsg(err, "failed to start challenge hash rotation")
+	}
+	return &svc, nil
+}
+
+// NewHashSource returns the hash source named in the given config
+func NewHashSource(cfg config.RetentionConfig) (HashSource, error) {
+	switch cfg.HashSource {
+	case LocalHashSourceName:
+		seed := cfg.LocalHashSeed
+		if seed == "" {
+			// an unseeded chain would be public and restart from the same hash, letting solutions be precomputed
+			var randomSeed [sha256.Size]byte
+			if _, err := rand.Read(randomSeed[:]); err != nil {
+				return nil, errors.Wrap(err, "failed to generate local hash seed")
+			}
+			seed = hex.EncodeToString(randomSeed[:])
+			logrus.Info("local hash source has no seed, using a random seed")
+		}
+		return NewLocalHashSource(seed), nil
+	case BitcoinHashSourceName:
+		return nil, fmt.Errorf("hash source %q requires a block hash client", cfg.HashSource)
+	default:
+		return nil, fmt.Errorf("unsupported hash source: %q", cfg.HashSource)
+	}
+}
+
+// Enabled returns whether the gateway is accepting retention solutions
+func (s *RetentionService) Enabled() bool {
+	return s != nil && s.cfg != nil && s.cfg.Enabled
+}
+
+// GetChallenge returns the current retention challenge
+func (s *RetentionService) GetChallenge(ctx context.Context) (*RetentionChallenge, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "RetentionService.GetChallenge")
+	defer span.End()
+
+	if !s.Enabled() {
+		return nil, ErrRetentionDisabled
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &RetentionChallenge{
+		Hash:       s.current,
+		HashSource: s.source.Name(),
+		Difficulty: s.cfg.Difficulty,
+		Expiry:     s.RetentionExpiry(time.Now()).Unix(),
+	}, nil
+}
+
+// ValidateSolution checks that the given retention solution solves the current challenge for the DID, or the
+// previous challenge if it is still within its grace period
+func (s *RetentionService) ValidateSolution(ctx context.Context, didID, solution string) error {
+	_, span := telemetry.GetTracer().Start(ctx, "RetentionService.ValidateSolution")
+	defer span.End()
+
+	if !s.Enabled() {
+		return ErrRetentionDisabled
+	}
+
+	s.mu.RLock()
+	hashes := []string{s.current}
+	if s.previous != "" && time.Now().Before(s.previousEnds) {
+		hashes = append(hashes, s.previous)
+	}
+	s.mu.RUnlock()
+
+	for _, hash := range hashes {
+		if did.ValidateRetentionSolution(didID, hash, solution, s.cfg.Difficulty) {
+			return nil
+		}
+	}
+	return ErrInvalidRetentionSolution
+}
+
+// rotate replaces the current hash with a new one from the hash source, keeping the old one valid for the grace period
+func (s *RetentionService) rotate(ctx context.Context) error {
+	hash, err := s.source.NextHash(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hash == s.current {
+		return nil
+	}
+	s.previous = s.current
+	s.previousEnds = time.Now().Add(time.Duration(s.cfg.GracePeriodSeconds) * time.Second)
+	s.current = hash
+	logrus.WithFields(logrus.Fields{
+		"hash":        hash,
+		"hash_source": s.source.Name(),
+	}).Debug("rotated challenge hash")
+	return nil
+}
+
+// RetentionExpiry returns the time at which a DID retained at the given time will be evicted
+func (s *RetentionService) RetentionExpiry(from time.Time) time.Time {
+	return from.Add(time.Duration(s.cfg.RetentionPeriodSeconds) * time.Second)
+}
+
+// Close stops rotating the challenge hash
+func (s *RetentionService) Close() {
+	if s != nil && s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TBD54566975/did-dht/config"
+	"github.com/TBD54566975/did-dht/internal/did"
+)
+
+func TestLocalHashSource(t *testing.T) {
+	a := NewLocalHashSource("seed")
+	b := NewLocalHashSource("seed")
+	c := NewLocalHashSource("other seed")
+	assert.Equal(t, LocalHashSourceName, a.Name())
+
+	for i := 0; i < 3; i++ {
+		hashA, err := a.NextHash(context.Background())
+		require.NoError(t, err)
+		hashB, err := b.NextHash(context.Background())
+		require.NoError(t, err)
+		hashC, err := c.NextHash(context.Background())
+		require.NoError(t, err)
+
+		assert.Len(t, hashA, 64)
+		assert.Equal(t, hashA, hashB)
+		assert.NotEqual(t, hashA, hashC)
+	}
+}
+
+type testBlockHashClient string
+
+func (h testBlockHashClient) LatestBlockHash(context.Context) (string, error) {
+	return string(h), nil
+}
+
+func TestBitcoinHashSource(t *testing.T) {
+	blockHash := "000000000000000000022be0c55caae4152d023dd57e8d63dc1a55c1f6de46e7"
+	source := NewBitcoinHashSource(testBlockHashClient(blockHash))
+	assert.Equal(t, BitcoinHashSourceName, source.Name())
+
+	hash, err := source.NextHash(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, blockHash, hash)
+
+	_, err = NewBitcoinHashSource(nil).NextHash(context.Background())
+	assert.Error(t, err)
+}
+
+func TestNewHashSource(t *testing.T) {
+	source, err := NewHashSource(config.RetentionConfig{HashSource: LocalHashSourceName, LocalHashSeed: "seed"})
+	assert.NoError(t, err)
+	assert.Equal(t, LocalHashSourceName, source.Name())
+
+	// without a seed each source starts its chain from a random seed
+	a, err := NewHashSource(config.RetentionConfig{HashSource: LocalHashSourceName})
+	require.NoError(t, err)
+	b, err := NewHashSource(config.RetentionConfig{HashSource: LocalHashSourceName})
+	require.NoError(t, err)
+	aHash, err := a.NextHash(context.Background())
+	require.NoError(t, err)
+	bHash, err := b.NextHash(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, aHash, bHash)
+	unseededHash, err := NewLocalHashSource("").NextHash(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, unseededHash, aHash)
+
+	_, err = NewHashSource(config.RetentionConfig{HashSource: BitcoinHashSourceName})
+	assert.Error(t, err)
+
+	_, err = NewHashSource(config.RetentionConfig{HashSource: "unknown"})
+	assert.ErrorContains(t, err, "unsupported hash source")
+}
+
+func TestRetentionService(t *testing.T) {
+	t.Run("test no config", func(t *testing.T) {
+		svc, err := NewRetentionService(nil, nil)
+		assert.EqualError(t, err, "config is required")
+		assert.Empty(t, svc)
+	})
+
+	t.Run("test disabled", func(t *testing.T) {
+		cfg := config.GetDefaultConfig()
+		cfg.RetentionConfig.Enabled = false
+		svc, err := NewRetentionService(&cfg, nil)
+		require.NoError(t, err)
+		assert.False(t, svc.Enabled())
+
+		_, err = svc.GetChallenge(context.Background())
+		assert.ErrorIs(t, err, ErrRetentionDisabled)
+		assert.ErrorIs(t, svc.ValidateSolution(context.Background(), "did:dht:test", "abc:1"), ErrRetentionDisabled)
+
+		// a nil service is treated as disabled
+		var nilSvc *RetentionService
+		assert.ErrorIs(t, nilSvc.ValidateSolution(context.Background(), "did:dht:test", "abc:1"), ErrRetentionDisabled)
+	})
+
+	t.Run("test get challenge", func(t *testing.T) {
+		svc := newRetentionService(t, 8, 600)
+		defer svc.Close()
+
+		challenge, err := svc.GetChallenge(context.Background())
+		require.NoError(t, err)
+		assert.NotEmpty(t, challenge.Hash)
+		assert.Equal(t, LocalHashSourceName, challenge.HashSource)
+		assert.Equal(t, 8, challenge.Difficulty)
+		assert.NotEmpty(t, challenge.Expiry)
+	})
+
+	t.Run("test validate solution", func(t *testing.T) {
+		svc := newRetentionService(t, 8, 600)
+		defer svc.Close()
+
+		challenge, err := svc.GetChallenge(context.Background())
+		require.NoError(t, err)
+
+		didID := "did:dht:test"
+		solution, err := did.FindRetentionSolution(didID, challenge.Hash, challenge.Difficulty)
+		require.NoError(t, err)
+		assert.NoError(t, svc.ValidateSolution(context.Background(), didID, solution))
+
+		// the solution is bound to the did
+		assert.ErrorIs(t, svc.ValidateSolution(context.Background(), "did:dht:other", solution), ErrInvalidRetentionSolution)
+		assert.ErrorIs(t, svc.ValidateSolution(context.Background(), didID, "bad"), ErrInvalidRetentionSolution)
+
+		// the previous hash is still valid within the grace period
+		require.NoError(t, svc.rotate(context.Background()))
+		assert.NoError(t, svc.ValidateSolution(context.Background(), didID, solution))
+
+		// but not once it has been rotated out
+		require.NoError(t, svc.rotate(context.Background()))
+		assert.ErrorIs(t, svc.ValidateSolution(context.Background(), didID, solution), ErrInvalidRetentionSolution)
+	})
+
+	t.Run("test validate solution without grace period", func(t *testing.T) {
+		svc := newRetentionService(t, 8, 0)
+		defer svc.Close()
+
+		challenge, err := svc.GetChallenge(context.Background())
+		require.NoError(t, err)
+
+		didID := "did:dht:test"
+		solution, err := did.FindRetentionSolution(didID, challenge.Hash, challenge.Difficulty)
+		require.NoError(t, err)
+		require.NoError(t, svc.rotate(context.Background()))
+		assert.ErrorIs(t, svc.ValidateSolution(context.Background(), didID, solution), ErrInvalidRetentionSolution)
+	})
+}
+
+func newRetentionService(t *testing.T, difficulty, gracePeriodSeconds int) *RetentionService {
+	cfg := config.GetDefaultConfig()
+	cfg.RetentionConfig.Difficulty = difficulty
+	cfg.RetentionConfig.GracePeriodSeconds = gracePeriodSeconds
+	svc, err := NewRetentionService(&cfg, NewLocalHashSource(t.Name()))
+	require.NoError(t, err)
+	require.NotEmpty(t, svc)
+	return svc
+}
@@ -0,0 +1,45 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/pkg/errors"
+)
+
+// SignPut sets the key of the put request to the signer's public key and signs the request with the signer,
+// following https://www.bittorrent.org/beps/bep_0044.html#signature-verification
+func SignPut(s Signer, put *bep44.Put) error {
+	publicKey := s.PublicKey()
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid ed25519 public key length")
+	}
+	bv, err := bencode.Marshal(put.V)
+	if err != nil {
+		return errors.Wrap(err, "error bencoding bep44 value")
+	}
+	sig, err := s.Sign(bep44SignaturePayload(put.Salt, bv, put.Seq))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign bep44 payload")
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return errors.New("incorrect sig length for bep44 put")
+	}
+	put.K = (*[32]byte)(publicKey)
+	put.Sig = [64]byte(sig)
+	return nil
+}
+
+// bep44SignaturePayload returns the payload signed for a mutable BEP44 item: the bencoded salt, if any, sequence
+// number and value, without the surrounding dictionary
+func bep44SignaturePayload(salt, bv []byte, seq int64) []byte {
+	var payload []byte
+	if len(salt) != 0 {
+		payload = append(payload, "4:salt"...)
+		payload = append(payload, bencode.MustMarshal(salt)...)
+	}
+	payload = append(payload, fmt.Sprintf("3:seqi%de1:v", seq)...)
+	return append(payload, bv...)
+}
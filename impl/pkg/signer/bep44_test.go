@@ -0,0 +1,36 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignPut(t *testing.T) {
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	// signing through a signer matches signing with the private key directly
+	put := bep44.Put{V: []byte("hello mainline"), Seq: 1700000000}
+	require.NoError(t, SignPut(NewInMemorySigner(privKey), &put))
+	expected := bep44.Put{V: put.V, K: put.K, Seq: put.Seq}
+	expected.Sign(privKey)
+	assert.Equal(t, expected.Sig, put.Sig)
+
+	bv, err := bencode.Marshal(put.V)
+	require.NoError(t, err)
+	assert.True(t, bep44.Verify(put.K[:], nil, put.Seq, bv, put.Sig[:]))
+
+	salted := bep44.Put{V: []byte("hello mainline"), Salt: []byte("salt"), Seq: 1700000000}
+	require.NoError(t, SignPut(NewInMemorySigner(privKey), &salted))
+	expected = bep44.Put{V: salted.V, K: salted.K, Salt: salted.Salt, Seq: salted.Seq}
+	expected.Sign(privKey)
+	assert.Equal(t, expected.Sig, salted.Sig)
+
+	err = SignPut(NewInMemorySigner([]byte("bad")), &put)
+	assert.Error(t, err)
+}
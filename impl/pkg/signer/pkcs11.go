@@ -0,0 +1,79 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MechanismEdDSA is the PKCS#11 CKM_EDDSA mechanism, which signs with an Ed25519 key when given no parameters
+const MechanismEdDSA Mechanism = 0x1057
+
+type (
+	// Mechanism is a PKCS#11 mechanism type (CKM_*)
+	Mechanism uint
+	// ObjectHandle is a PKCS#11 object handle (CK_OBJECT_HANDLE) identifying a key held by a token
+	ObjectHandle uint
+)
+
+// Token is a session with a PKCS#11 token whose keys never leave it. Its methods mirror C_SignInit and C_Sign, so a
+// PKCS#11 binding such as github.com/miekg/pkcs11 can back it with a thin wrapper that supplies the session handle.
+type Token interface {
+	// SignInit starts a signing operation with the given mechanism and key
+	SignInit(mechanism Mechanism, key ObjectHandle) error
+	// Sign signs the message in a single part, completing the signing operation started by SignInit
+	Sign(message []byte) ([]byte, error)
+}
+
+// PKCS11Signer is a Signer backed by an Ed25519 key held by a PKCS#11 token
+type PKCS11Signer struct {
+	token     Token
+	key       ObjectHandle
+	publicKey ed25519.PublicKey
+
+	// a PKCS#11 session runs a single signing operation at a time
+	mu sync.Mutex
+}
+
+var _ Signer = (*PKCS11Signer)(nil)
+
+// NewPKCS11Signer returns a Signer for the private key with the given handle on the token. The public key is the
+// key's CKA_EC_POINT, which is checked against a test signature made by the token.
+func NewPKCS11Signer(token Token, key ObjectHandle, publicKey ed25519.PublicKey) (*PKCS11Signer, error) {
+	if token == nil {
+		return nil, errors.New("token cannot be nil")
+	}
+	s := &PKCS11Signer{
+		token:     token,
+		key:       key,
+		publicKey: publicKey,
+	}
+	if err := Verify(s); err != nil {
+		return nil, errors.Wrap(err, "failed to verify token key")
+	}
+	return s, nil
+}
+
+// PublicKey returns the Ed25519 public key of the token key
+func (s *PKCS11Signer) PublicKey() ed25519.PublicKey {
+	return s.publicKey
+}
+
+// Sign returns the Ed25519 signature of the message made by the token
+func (s *PKCS11Signer) Sign(message []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.token.SignInit(MechanismEdDSA, s.key); err != nil {
+		return nil, errors.Wrap(err, "failed to initialize signing")
+	}
+	signature, err := s.token.Sign(message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign")
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return nil, errors.Errorf("token returned a signature of length %d", len(signature))
+	}
+	return signature, nil
+}
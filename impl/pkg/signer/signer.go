@@ -0,0 +1,63 @@
+package signer
+
+import (
+	"crypto/ed25519"
+
+	"github.com/pkg/errors"
+)
+
+// Signer signs with the Ed25519 identity key of a did:dht DID. It plays the role of crypto.Signer for BEP44 payloads
+// and previous DID signatures, without requiring the private key to be held in process memory, so identity keys may
+// live in an HSM or KMS.
+type Signer interface {
+	// PublicKey returns the Ed25519 public key of the signer
+	PublicKey() ed25519.PublicKey
+	// Sign returns the 64 byte Ed25519 signature of the message
+	Sign(message []byte) ([]byte, error)
+}
+
+// InMemorySigner is a Signer holding an Ed25519 private key in process memory
+type InMemorySigner struct {
+	privateKey ed25519.PrivateKey
+}
+
+var _ Signer = (*InMemorySigner)(nil)
+
+// NewInMemorySigner returns a Signer for the given Ed25519 private key
+func NewInMemorySigner(privateKey ed25519.PrivateKey) *InMemorySigner {
+	return &InMemorySigner{privateKey: privateKey}
+}
+
+// PublicKey returns the Ed25519 public key of the signer, or nil if its private key is invalid
+func (s *InMemorySigner) PublicKey() ed25519.PublicKey {
+	if len(s.privateKey) != ed25519.PrivateKeySize {
+		return nil
+	}
+	return s.privateKey.Public().(ed25519.PublicKey)
+}
+
+// Sign returns the Ed25519 signature of the message
+func (s *InMemorySigner) Sign(message []byte) ([]byte, error) {
+	if len(s.privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key length")
+	}
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+// Verify signs a test message with the signer and verifies the signature against its public key, to catch a signer
+// whose key does not match its advertised public key before it is used to publish
+func Verify(s Signer) error {
+	publicKey := s.PublicKey()
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid ed25519 public key length")
+	}
+	message := []byte("did:dht signer check")
+	signature, err := s.Sign(message)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign test message")
+	}
+	if !ed25519.Verify(publicKey, message, signature) {
+		return errors.New("signature does not verify against the signer's public key")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemorySigner(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	s := NewInMemorySigner(privateKey)
+	assert.Equal(t, publicKey, s.PublicKey())
+	assert.NoError(t, Verify(s))
+
+	signature, err := s.Sign([]byte("hello mainline"))
+	require.NoError(t, err)
+	assert.True(t, ed25519.Verify(publicKey, []byte("hello mainline"), signature))
+
+	bad := NewInMemorySigner([]byte("bad"))
+	assert.Nil(t, bad.PublicKey())
+	_, err = bad.Sign([]byte("hello mainline"))
+	assert.Error(t, err)
+	assert.Error(t, Verify(bad))
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	token := newSoftToken(map[ObjectHandle]ed25519.PrivateKey{1: privateKey})
+
+	t.Run("test sign", func(t *testing.T) {
+		s, err := NewPKCS11Signer(token, 1, publicKey)
+		require.NoError(t, err)
+		assert.Equal(t, publicKey, s.PublicKey())
+
+		signature, err := s.Sign([]byte("hello mainline"))
+		require.NoError(t, err)
+		assert.True(t, ed25519.Verify(publicKey, []byte("hello mainline"), signature))
+	})
+
+	t.Run("test unknown key", func(t *testing.T) {
+		_, err := NewPKCS11Signer(token, 2, publicKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("test mismatched public key", func(t *testing.T) {
+		otherPublicKey, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		_, err = NewPKCS11Signer(token, 1, otherPublicKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("test nil token", func(t *testing.T) {
+		_, err := NewPKCS11Signer(nil, 1, publicKey)
+		assert.Error(t, err)
+	})
+}
+
+// softToken is a software PKCS#11-style token that holds its keys in memory, for tests
+type softToken struct {
+	keys   map[ObjectHandle]ed25519.PrivateKey
+	active *ed25519.PrivateKey
+}
+
+func newSoftToken(keys map[ObjectHandle]ed25519.PrivateKey) *softToken {
+	return &softToken{keys: keys}
+}
+
+func (t *softToken) SignInit(mechanism Mechanism, key ObjectHandle) error {
+	if mechanism != MechanismEdDSA {
+		return errors.New("CKR_MECHANISM_INVALID")
+	}
+	if t.active != nil {
+		return errors.New("CKR_OPERATION_ACTIVE")
+	}
+	privateKey, ok := t.keys[key]
+	if !ok {
+		return errors.New("CKR_KEY_HANDLE_INVALID")
+	}
+	t.active = &privateKey
+	return nil
+}
+
+func (t *softToken) Sign(message []byte) ([]byte, error) {
+	if t.active == nil {
+		return nil, errors.New("CKR_OPERATION_NOT_INITIALIZED")
+	}
+	signature := ed25519.Sign(*t.active, message)
+	t.active = nil
+	return signature, nil
+}
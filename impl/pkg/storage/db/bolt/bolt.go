@@ -17,8 +17,20 @@ import (
 )
 
 const (
-	dhtNamespace    = "dht"
-	failedNamespace = "failed"
+	dhtNamespace      = "dht"
+	failedNamespace   = "failed"
+	retainedNamespace = "retained"
+	historyNamespace  = "history"
+	// typesNamespace indexes records by type, keyed by type followed by record id
+	typesNamespace = "types"
+	// recordTypesNamespace holds the indexed types of each record so stale index entries can be removed
+	recordTypesNamespace = "record_types"
+	// republishNamespace schedules records for republishing, keyed by next republish time followed by record id
+	republishNamespace = "republish"
+	// recordRepublishNamespace holds the next republish time of each record so stale schedule entries can be removed
+	recordRepublishNamespace = "record_republish"
+	// blockedNamespace holds the ids of records the gateway refuses to store or serve
+	blockedNamespace = "blocked"
 )
 
 type Bolt struct {
@@ -41,19 +53,64 @@ func NewBolt(path string) (*Bolt, error) {
 	return &Bolt{db: db}, nil
 }
 
-// WriteRecord writes the given record to the storage
-// TODO: don't overwrite existing records, store unique seq numbers
+// WriteRecord writes the given record to the storage, keeping every version of the record by sequence number.
+// The record is compared against the stored record according to the conflict resolution rules, returning
+// dht.ErrStaleSequenceNumber or dht.ErrLowerPayload if it is rejected.
 func (b *Bolt) WriteRecord(ctx context.Context, record dht.BEP44Record) error {
-	ctx, span := telemetry.GetTracer().Start(ctx, "bolt.WriteRecord")
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.WriteRecord")
 	defer span.End()
 
+	record.Updated = time.Now()
 	encoded := encodeRecord(record)
 	recordBytes, err := json.Marshal(encoded)
 	if err != nil {
 		return err
 	}
 
-	return b.write(ctx, dhtNamespace, record.ID(), recordBytes)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		// checked in the same transaction as the write, so a record cannot be written once it is blocked
+		if blocked := tx.Bucket([]byte(blockedNamespace)); blocked != nil && blocked.Get([]byte(record.ID())) != nil {
+			return dht.ErrRecordBlocked
+		}
+
+		bucket, err := tx.CreateBucketIfNotExists([]byte(dhtNamespace))
+		if err != nil {
+			return err
+		}
+
+		var stored *dht.BEP44Record
+		if storedBytes := bucket.Get([]byte(record.ID())); storedBytes != nil {
+			var b64record base64BEP44Record
+			if err = json.Unmarshal(storedBytes, &b64record); err != nil {
+				return err
+			}
+			if stored, err = b64record.Decode(); err != nil {
+				return err
+			}
+		}
+		if _, err = record.ResolveConflict(stored); err != nil {
+			return err
+		}
+
+		if err = bucket.Put([]byte(record.ID()), recordBytes); err != nil {
+			return err
+		}
+
+		history, err := tx.CreateBucketIfNotExists([]byte(historyNamespace))
+		if err != nil {
+			return err
+		}
+		return history.Put(historyKey(record.ID(), record.SequenceNumber), recordBytes)
+	})
+}
+
+// historyKey returns the key of a version of a record, its id followed by its big-endian sequence number so versions
+// sort by sequence number
+func historyKey(id string, seq int64) []byte {
+	key := make([]byte, len(id)+8)
+	copy(key, id)
+	binary.BigEndian.PutUint64(key[len(id):], uint64(seq))
+	return key
 }
 
 // ReadRecord reads the record with the given id from the storage
@@ -116,6 +173,394 @@ func (b *Bolt) ListRecords(ctx context.Context, nextPageToken []byte, pageSize i
 	return records, nextPageToken, nil
 }
 
+// DeleteRecord removes the record with the given id, along with its expiry, indexed types and republish schedule, from
+// the storage
+func (b *Bolt) DeleteRecord(ctx context.Context, id string) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.DeleteRecord")
+	defer span.End()
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteRecordTypes(tx, id); err != nil {
+			return err
+		}
+		if err := deleteNextRepublish(tx, id); err != nil {
+			return err
+		}
+		for _, namespace := range []string{dhtNamespace, retainedNamespace, failedNamespace} {
+			bucket := tx.Bucket([]byte(namespace))
+			if bucket == nil {
+				continue
+			}
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+
+		history := tx.Bucket([]byte(historyNamespace))
+		if history == nil {
+			return nil
+		}
+		cursor := history.Cursor()
+		for k, _ := cursor.Seek([]byte(id)); k != nil && bytes.HasPrefix(k, []byte(id)); k, _ = cursor.Seek([]byte(id)) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListSequenceNumbers returns the sequence numbers of all stored versions of the record with the given id, in
+// ascending order
+func (b *Bolt) ListSequenceNumbers(ctx context.Context, id string) ([]int64, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ListSequenceNumbers")
+	defer span.End()
+
+	var result []int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyNamespace))
+		if bucket == nil {
+			logrus.WithContext(ctx).WithField("namespace", historyNamespace).Info("namespace does not exist")
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for k, _ := cursor.Seek([]byte(id)); k != nil && bytes.HasPrefix(k, []byte(id)); k, _ = cursor.Next() {
+			result = append(result, int64(binary.BigEndian.Uint64(k[len(id):])))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ReadRecordAtSeq reads the version of the record with the given id and sequence number from the storage
+func (b *Bolt) ReadRecordAtSeq(ctx context.Context, id string, seq int64) (*dht.BEP44Record, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ReadRecordAtSeq")
+	defer span.End()
+
+	var recordBytes []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyNamespace))
+		if bucket == nil {
+			logrus.WithContext(ctx).WithField("namespace", historyNamespace).Info("namespace does not exist")
+			return nil
+		}
+		recordBytes = bucket.Get(historyKey(id, seq))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(recordBytes) == 0 {
+		return nil, nil
+	}
+
+	var b64record base64BEP44Record
+	if err = json.Unmarshal(recordBytes, &b64record); err != nil {
+		return nil, err
+	}
+	return b64record.Decode()
+}
+
+// WriteRecordExpiry sets the time at which the record with the given id is to be evicted from the Retained DID Set
+func (b *Bolt) WriteRecordExpiry(ctx context.Context, id string, expiry time.Time) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "bolt.WriteRecordExpiry")
+	defer span.End()
+
+	expiryBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(expiryBytes, uint64(expiry.Unix()))
+	return b.write(ctx, retainedNamespace, id, expiryBytes)
+}
+
+// ReadRecordExpiry returns the time at which the record with the given id is to be evicted from the Retained DID Set,
+// or the zero time if the record is not retained
+func (b *Bolt) ReadRecordExpiry(ctx context.Context, id string) (time.Time, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "bolt.ReadRecordExpiry")
+	defer span.End()
+
+	expiryBytes, err := b.read(ctx, retainedNamespace, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(expiryBytes) != 8 {
+		return time.Time{}, nil
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(expiryBytes)), 0), nil
+}
+
+// ListExpiredRecords returns the ids of all records still scheduled to be republished with an expiry before the given
+// time
+func (b *Bolt) ListExpiredRecords(ctx context.Context, before time.Time) ([]string, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ListExpiredRecords")
+	defer span.End()
+
+	var result []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(retainedNamespace))
+		if bucket == nil {
+			logrus.WithContext(ctx).WithField("namespace", retainedNamespace).Info("namespace does not exist")
+			return nil
+		}
+		recordRepublish := tx.Bucket([]byte(recordRepublishNamespace))
+		if recordRepublish == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			if len(v) == 8 && int64(binary.BigEndian.Uint64(v)) < before.Unix() && recordRepublish.Get(k) != nil {
+				result = append(result, string(k))
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// WriteRecordTypes indexes the record with the given id under each of the given types, replacing any types previously
+// indexed for the record
+func (b *Bolt) WriteRecordTypes(ctx context.Context, id string, types []int) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.WriteRecordTypes")
+	defer span.End()
+
+	typesBytes, err := json.Marshal(types)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err = deleteRecordTypes(tx, id); err != nil {
+			return err
+		}
+		if len(types) == 0 {
+			return nil
+		}
+
+		index, err := tx.CreateBucketIfNotExists([]byte(typesNamespace))
+		if err != nil {
+			return err
+		}
+		for _, typ := range types {
+			if err = index.Put(typeKey(typ, id), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		recordTypes, err := tx.CreateBucketIfNotExists([]byte(recordTypesNamespace))
+		if err != nil {
+			return err
+		}
+		return recordTypes.Put([]byte(id), typesBytes)
+	})
+}
+
+// ListRecordsForType returns the ids of up to limit records indexed under the given type, skipping the first offset
+func (b *Bolt) ListRecordsForType(ctx context.Context, typ int, offset, limit int) ([]string, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ListRecordsForType")
+	defer span.End()
+
+	var result []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(typesNamespace))
+		if bucket == nil {
+			logrus.WithContext(ctx).WithField("namespace", typesNamespace).Info("namespace does not exist")
+			return nil
+		}
+
+		prefix := typeKey(typ, "")
+		cursor := bucket.Cursor()
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) && len(result) < limit; k, _ = cursor.Next() {
+			if offset > 0 {
+				offset--
+				continue
+			}
+			result = append(result, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// deleteRecordTypes removes all type index entries for the record with the given id
+func deleteRecordTypes(tx *bolt.Tx, id string) error {
+	recordTypes := tx.Bucket([]byte(recordTypesNamespace))
+	if recordTypes == nil {
+		return nil
+	}
+	typesBytes := recordTypes.Get([]byte(id))
+	if typesBytes == nil {
+		return nil
+	}
+
+	var types []int
+	if err := json.Unmarshal(typesBytes, &types); err != nil {
+		return err
+	}
+	if index := tx.Bucket([]byte(typesNamespace)); index != nil {
+		for _, typ := range types {
+			if err := index.Delete(typeKey(typ, id)); err != nil {
+				return err
+			}
+		}
+	}
+	return recordTypes.Delete([]byte(id))
+}
+
+// typeKey returns the key of a type index entry, the big-endian type followed by the record id so entries group by type
+func typeKey(typ int, id string) []byte {
+	key := make([]byte, 4+len(id))
+	binary.BigEndian.PutUint32(key, uint32(typ))
+	copy(key[4:], id)
+	return key
+}
+
+// WriteNextRepublish schedules the record with the given id to be republished at the given time, replacing any time
+// previously scheduled for the record
+func (b *Bolt) WriteNextRepublish(ctx context.Context, id string, next time.Time) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.WriteNextRepublish")
+	defer span.End()
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteNextRepublish(tx, id); err != nil {
+			return err
+		}
+
+		schedule, err := tx.CreateBucketIfNotExists([]byte(republishNamespace))
+		if err != nil {
+			return err
+		}
+		key := republishKey(next, id)
+		if err = schedule.Put(key, []byte{}); err != nil {
+			return err
+		}
+
+		recordRepublish, err := tx.CreateBucketIfNotExists([]byte(recordRepublishNamespace))
+		if err != nil {
+			return err
+		}
+		return recordRepublish.Put([]byte(id), key[:8])
+	})
+}
+
+// ReadNextRepublish returns the time at which the record with the given id is next to be republished, or the zero time
+// if the record is not scheduled
+func (b *Bolt) ReadNextRepublish(ctx context.Context, id string) (time.Time, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "bolt.ReadNextRepublish")
+	defer span.End()
+
+	nextBytes, err := b.read(ctx, recordRepublishNamespace, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(nextBytes) != 8 {
+		return time.Time{}, nil
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(nextBytes)), 0), nil
+}
+
+// DeleteNextRepublish removes the record with the given id from the republish schedule, so it is not republished until
+// it is rescheduled
+func (b *Bolt) DeleteNextRepublish(ctx context.Context, id string) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.DeleteNextRepublish")
+	defer span.End()
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return deleteNextRepublish(tx, id)
+	})
+}
+
+// ListDueRecords returns the ids of up to limit records scheduled to be republished before the given time, those due
+// the longest first
+func (b *Bolt) ListDueRecords(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ListDueRecords")
+	defer span.End()
+
+	var result []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(republishNamespace))
+		if bucket == nil {
+			logrus.WithContext(ctx).WithField("namespace", republishNamespace).Info("namespace does not exist")
+			return nil
+		}
+
+		end := republishKey(before, "")
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil && bytes.Compare(k, end) < 0 && len(result) < limit; k, _ = cursor.Next() {
+			result = append(result, string(k[8:]))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ListUnscheduledRecords returns the ids of up to limit records that are not scheduled to be republished, skipping
+// quarantined records and records whose expiry is before the given time
+func (b *Bolt) ListUnscheduledRecords(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ListUnscheduledRecords")
+	defer span.End()
+
+	var result []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(dhtNamespace))
+		if bucket == nil {
+			logrus.WithContext(ctx).WithField("namespace", dhtNamespace).Info("namespace does not exist")
+			return nil
+		}
+		recordRepublish := tx.Bucket([]byte(recordRepublishNamespace))
+		failed := tx.Bucket([]byte(failedNamespace))
+		retained := tx.Bucket([]byte(retainedNamespace))
+
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil && len(result) < limit; k, _ = cursor.Next() {
+			if recordRepublish != nil && recordRepublish.Get(k) != nil {
+				continue
+			}
+			// quarantined records are left unscheduled until they are retried
+			if failed != nil && decodeFailedRecord(string(k), failed.Get(k)).Quarantined {
+				continue
+			}
+			// expired records are no longer republished
+			if retained != nil {
+				if v := retained.Get(k); len(v) == 8 && int64(binary.BigEndian.Uint64(v)) < now.Unix() {
+					continue
+				}
+			}
+			result = append(result, string(k))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// deleteNextRepublish removes the republish schedule entry for the record with the given id
+func deleteNextRepublish(tx *bolt.Tx, id string) error {
+	recordRepublish := tx.Bucket([]byte(recordRepublishNamespace))
+	if recordRepublish == nil {
+		return nil
+	}
+	nextBytes := recordRepublish.Get([]byte(id))
+	if nextBytes == nil {
+		return nil
+	}
+
+	if schedule := tx.Bucket([]byte(republishNamespace)); schedule != nil {
+		key := append(append([]byte{}, nextBytes...), id...)
+		if err := schedule.Delete(key); err != nil {
+			return err
+		}
+	}
+	return recordRepublish.Delete([]byte(id))
+}
+
+// republishKey returns the key of a republish schedule entry, the big-endian unix time followed by the record id so
+// entries sort by time
+func republishKey(next time.Time, id string) []byte {
+	key := make([]byte, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(next.Unix()))
+	copy(key[8:], id)
+	return key
+}
+
 func (b *Bolt) Close() error {
 	return b.db.Close()
 }
@@ -222,28 +667,140 @@ func (b *Bolt) RecordCount(ctx context.Context) (int, error) {
 	return count, err
 }
 
-func (b *Bolt) WriteFailedRecord(ctx context.Context, id string) error {
-	_, span := telemetry.GetTracer().Start(ctx, "bolt.WriteFailedRecord")
+// BlockRecord adds the record with the given id to the block list
+func (b *Bolt) BlockRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "bolt.BlockRecord")
+	defer span.End()
+
+	return b.write(ctx, blockedNamespace, id, []byte{1})
+}
+
+// UnblockRecord removes the record with the given id from the block list
+func (b *Bolt) UnblockRecord(ctx context.Context, id string) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.UnblockRecord")
 	defer span.End()
 
 	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockedNamespace))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// IsRecordBlocked returns whether the record with the given id is on the block list
+func (b *Bolt) IsRecordBlocked(ctx context.Context, id string) (bool, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.IsRecordBlocked")
+	defer span.End()
+
+	var blocked bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockedNamespace))
+		blocked = bucket != nil && bucket.Get([]byte(id)) != nil
+		return nil
+	})
+	return blocked, err
+}
+
+// ListBlockedRecords returns the ids of the records on the block list
+func (b *Bolt) ListBlockedRecords(ctx context.Context) ([]string, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ListBlockedRecords")
+	defer span.End()
+
+	var result []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockedNamespace))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			result = append(result, string(k))
+			return nil
+		})
+	})
+	return result, err
+}
+
+// WriteFailedRecord records a failure to republish the record with the given id, returning the number of times in a
+// row it has failed
+func (b *Bolt) WriteFailedRecord(ctx context.Context, id string) (int, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.WriteFailedRecord")
+	defer span.End()
+
+	var count int
+	err := b.db.Update(func(tx *bolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte(failedNamespace))
 		if err != nil {
 			return err
 		}
 
-		var count int32 = 1
-		v := bucket.Get([]byte(id))
-		if v != nil {
-			count = int32(binary.LittleEndian.Uint32(v))
-			count++
+		record := decodeFailedRecord(id, bucket.Get([]byte(id)))
+		record.Count++
+		count = record.Count
+		return bucket.Put([]byte(id), encodeFailedRecord(record))
+	})
+	return count, err
+}
+
+// QuarantineRecord marks the failed record with the given id as quarantined and removes it from the republish
+// schedule, so it is not republished until it is rescheduled
+func (b *Bolt) QuarantineRecord(ctx context.Context, id string) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.QuarantineRecord")
+	defer span.End()
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(failedNamespace))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return nil
 		}
 
-		buf := new(bytes.Buffer)
-		if err = binary.Write(buf, binary.LittleEndian, count); err != nil {
+		record := decodeFailedRecord(id, bucket.Get([]byte(id)))
+		record.Quarantined = true
+		if err := bucket.Put([]byte(id), encodeFailedRecord(record)); err != nil {
 			return err
 		}
-		return bucket.Put([]byte(id), buf.Bytes())
+		return deleteNextRepublish(tx, id)
+	})
+}
+
+// ReadFailedRecord returns the failures of the record with the given id, or nil if it has not failed to be republished
+// since it was last republished
+func (b *Bolt) ReadFailedRecord(ctx context.Context, id string) (*dht.FailedRecord, error) {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.ReadFailedRecord")
+	defer span.End()
+
+	var result *dht.FailedRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(failedNamespace))
+		if bucket == nil {
+			return nil
+		}
+		if v := bucket.Get([]byte(id)); v != nil {
+			record := decodeFailedRecord(id, v)
+			result = &record
+		}
+		return nil
+	})
+	return result, err
+}
+
+// DeleteFailedRecord clears the failures, and any quarantine, of the record with the given id
+func (b *Bolt) DeleteFailedRecord(ctx context.Context, id string) error {
+	_, span := telemetry.GetTracer().Start(ctx, "bolt.DeleteFailedRecord")
+	defer span.End()
+
+	// records are cleared after every successful republish, so avoid a write when there is nothing to clear
+	var failed bool
+	if err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(failedNamespace))
+		failed = bucket != nil && bucket.Get([]byte(id)) != nil
+		return nil
+	}); err != nil || !failed {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(failedNamespace)).Delete([]byte(id))
 	})
 }
 
@@ -261,17 +818,35 @@ func (b *Bolt) ListFailedRecords(ctx context.Context) ([]dht.FailedRecord, error
 
 		cursor := bucket.Cursor()
 		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			var count int
-			if err := binary.Read(bytes.NewReader(v), binary.LittleEndian, &count); err != nil {
-				return err
-			}
-			result = append(result, dht.FailedRecord{ID: string(k), Count: count})
+			result = append(result, decodeFailedRecord(string(k), v))
 		}
 		return nil
 	})
 	return result, err
 }
 
+// encodeFailedRecord encodes a failed record as its failure count, followed by a byte set if it is quarantined
+func encodeFailedRecord(record dht.FailedRecord) []byte {
+	v := binary.LittleEndian.AppendUint32(nil, uint32(record.Count))
+	if record.Quarantined {
+		return append(v, 1)
+	}
+	return append(v, 0)
+}
+
+// decodeFailedRecord decodes the failed record with the given id, which has no failures if it is not stored. Records
+// written by earlier versions hold only their failure count.
+func decodeFailedRecord(id string, v []byte) dht.FailedRecord {
+	record := dht.FailedRecord{ID: id}
+	if len(v) >= 4 {
+		record.Count = int(binary.LittleEndian.Uint32(v))
+	}
+	if len(v) >= 5 {
+		record.Quarantined = v[4] == 1
+	}
+	return record
+}
+
 func (b *Bolt) FailedRecordCount(ctx context.Context) (int, error) {
 	_, span := telemetry.GetTracer().Start(ctx, "bolt.FailedRecordCount")
 	defer span.End()
@@ -3,6 +3,7 @@ package bolt
 import (
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/TBD54566975/ssi-sdk/util"
 
@@ -21,17 +22,27 @@ type base64BEP44Record struct {
 	// 64 byte base64URL encoded string
 	Sig string `json:"sig" validate:"required"`
 	Seq int64  `json:"seq" validate:"required"`
+	// Unix timestamp in seconds of when the record was last written
+	Updated int64 `json:"updated,omitempty"`
 }
 
 func encodeRecord(r dht.BEP44Record) base64BEP44Record {
 	return base64BEP44Record{
-		V:   encoding.EncodeToString(r.Value[:]),
-		K:   encoding.EncodeToString(r.Key[:]),
-		Sig: encoding.EncodeToString(r.Signature[:]),
-		Seq: r.SequenceNumber,
+		V:       encoding.EncodeToString(r.Value[:]),
+		K:       encoding.EncodeToString(r.Key[:]),
+		Sig:     encoding.EncodeToString(r.Signature[:]),
+		Seq:     r.SequenceNumber,
+		Updated: unixOrZero(r.Updated),
 	}
 }
 
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 func (b base64BEP44Record) Decode() (*dht.BEP44Record, error) {
 	v, err := encoding.DecodeString(b.V)
 	if err != nil {
@@ -53,5 +64,8 @@ func (b base64BEP44Record) Decode() (*dht.BEP44Record, error) {
 		// TODO: do something useful if this happens
 		return nil, util.LoggingErrorMsg(err, "error loading record from database, skipping")
 	}
+	if b.Updated != 0 {
+		record.Updated = time.Unix(b.Updated, 0)
+	}
 	return record, nil
 }
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE retained_records (
+    key BYTEA PRIMARY KEY,
+    expiry BIGINT NOT NULL
+);
+
+CREATE INDEX retained_records_expiry_idx ON retained_records (expiry);
+
+-- +goose Down
+DROP TABLE retained_records;
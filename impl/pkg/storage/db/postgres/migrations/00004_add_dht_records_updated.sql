@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE dht_records ADD COLUMN updated BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE dht_records DROP COLUMN updated;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE record_types (
+    type INTEGER NOT NULL,
+    key BYTEA NOT NULL,
+    PRIMARY KEY (type, key)
+);
+
+CREATE INDEX record_types_key_idx ON record_types (key);
+
+-- +goose Down
+DROP TABLE record_types;
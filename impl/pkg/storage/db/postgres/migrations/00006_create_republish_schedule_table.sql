@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE republish_schedule (
+    key BYTEA PRIMARY KEY,
+    next_republish BIGINT NOT NULL
+);
+
+CREATE INDEX republish_schedule_next_republish_idx ON republish_schedule (next_republish);
+
+-- +goose Down
+DROP TABLE republish_schedule;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- failure counts were keyed by encoded id and never read, so they are dropped rather than converted
+DELETE FROM failed_records;
+ALTER TABLE failed_records RENAME COLUMN id TO key;
+ALTER TABLE failed_records ADD COLUMN quarantined BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE failed_records DROP COLUMN quarantined;
+ALTER TABLE failed_records RENAME COLUMN key TO id;
@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE TABLE blocked_records (
+    key BYTEA PRIMARY KEY
+);
+
+-- +goose Down
+DROP TABLE blocked_records;
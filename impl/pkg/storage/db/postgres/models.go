@@ -5,14 +5,42 @@
 package postgres
 
 type DhtRecord struct {
-	ID    int32
+	ID      int32
+	Key     []byte
+	Value   []byte
+	Sig     []byte
+	Seq     int64
+	Updated int64
+}
+
+type DhtRecordHistory struct {
 	Key   []byte
+	Seq   int64
 	Value []byte
 	Sig   []byte
-	Seq   int64
 }
 
 type FailedRecord struct {
-	ID           []byte
+	Key          []byte
 	FailureCount int32
+	Quarantined  bool
+}
+
+type RetainedRecord struct {
+	Key    []byte
+	Expiry int64
+}
+
+type RecordType struct {
+	Type int32
+	Key  []byte
+}
+
+type RepublishSchedule struct {
+	Key           []byte
+	NextRepublish int64
+}
+
+type BlockedRecord struct {
+	Key []byte
 }
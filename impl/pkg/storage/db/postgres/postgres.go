@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -62,6 +64,9 @@ func (p Postgres) connect(ctx context.Context) (*Queries, *pgx.Conn, error) {
 	return New(conn), conn, nil
 }
 
+// WriteRecord writes the given record to the storage, keeping every version of the record by sequence number.
+// The record is compared against the stored record according to the conflict resolution rules, returning
+// dht.ErrStaleSequenceNumber or dht.ErrLowerPayload if it is rejected, and dht.ErrRecordBlocked if it is blocked.
 func (p Postgres) WriteRecord(ctx context.Context, record dht.BEP44Record) error {
 	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.WriteRecord")
 	defer span.End()
@@ -72,17 +77,62 @@ func (p Postgres) WriteRecord(ctx context.Context, record dht.BEP44Record) error
 	}
 	defer db.Close(ctx)
 
-	err = queries.WriteRecord(ctx, WriteRecordParams{
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// the block list is locked against changes until the write commits, so a record cannot be written once it is
+	// blocked
+	txQueries := queries.WithTx(tx)
+	if err = txQueries.LockBlockedRecords(ctx); err != nil {
+		return err
+	}
+	blocked, err := txQueries.IsRecordBlocked(ctx, record.Key[:])
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return dht.ErrRecordBlocked
+	}
+
+	// the write only applies if the record wins conflict resolution against the stored record
+	written, err := txQueries.WriteRecord(ctx, WriteRecordParams{
+		Key:     record.Key[:],
+		Value:   record.Value[:],
+		Sig:     record.Signature[:],
+		Seq:     record.SequenceNumber,
+		Updated: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		row, err := txQueries.ReadRecord(ctx, record.Key[:])
+		if err != nil {
+			return err
+		}
+		stored, err := row.Record()
+		if err != nil {
+			return err
+		}
+		if _, err = record.ResolveConflict(stored); err != nil {
+			return err
+		}
+		return errors.New("record was not written")
+	}
+	err = txQueries.WriteRecordHistory(ctx, WriteRecordHistoryParams{
 		Key:   record.Key[:],
+		Seq:   record.SequenceNumber,
 		Value: record.Value[:],
 		Sig:   record.Signature[:],
-		Seq:   record.SequenceNumber,
 	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func (p Postgres) ReadRecord(ctx context.Context, id string) (*dht.BEP44Record, error) {
@@ -101,6 +151,9 @@ func (p Postgres) ReadRecord(ctx context.Context, id string) (*dht.BEP44Record,
 	}
 	row, err := queries.ReadRecord(ctx, decodedID)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
 		return nil, err
 	}
 
@@ -137,7 +190,7 @@ func (p Postgres) ListRecords(ctx context.Context, nextPageToken []byte, limit i
 
 	var records []dht.BEP44Record
 	for _, row := range rows {
-		record, err := dht.NewBEP44Record(row.Key, row.Value, row.Sig, row.Seq)
+		record, err := row.Record()
 		if err != nil {
 			// TODO: do something useful if this happens
 			logrus.WithContext(ctx).WithError(err).WithField("record_id", row.ID).Warn("error loading record from database, skipping")
@@ -157,7 +210,14 @@ func (p Postgres) ListRecords(ctx context.Context, nextPageToken []byte, limit i
 }
 
 func (row DhtRecord) Record() (*dht.BEP44Record, error) {
-	return dht.NewBEP44Record(row.Key, row.Value, row.Sig, row.Seq)
+	record, err := dht.NewBEP44Record(row.Key, row.Value, row.Sig, row.Seq)
+	if err != nil {
+		return nil, err
+	}
+	if row.Updated != 0 {
+		record.Updated = time.Unix(row.Updated, 0)
+	}
+	return record, nil
 }
 
 func (p Postgres) RecordCount(ctx context.Context) (int, error) {
@@ -178,8 +238,101 @@ func (p Postgres) RecordCount(ctx context.Context) (int, error) {
 	return int(count), nil
 }
 
-func (p Postgres) WriteFailedRecord(ctx context.Context, id string) error {
-	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.WriteFailedRecord")
+// DeleteRecord removes the record with the given id, along with its expiry, indexed types and republish schedule, from
+// the storage
+func (p Postgres) DeleteRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.DeleteRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := queries.WithTx(tx)
+	if err = txQueries.DeleteRecord(ctx, decodedID); err != nil {
+		return err
+	}
+	if err = txQueries.DeleteRecordExpiry(ctx, decodedID); err != nil {
+		return err
+	}
+	if err = txQueries.DeleteRecordHistory(ctx, decodedID); err != nil {
+		return err
+	}
+	if err = txQueries.DeleteRecordTypes(ctx, decodedID); err != nil {
+		return err
+	}
+	if err = txQueries.DeleteNextRepublish(ctx, decodedID); err != nil {
+		return err
+	}
+	if err = txQueries.DeleteFailedRecord(ctx, decodedID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListSequenceNumbers returns the sequence numbers of all stored versions of the record with the given id, in
+// ascending order
+func (p Postgres) ListSequenceNumbers(ctx context.Context, id string) ([]int64, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ListSequenceNumbers")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return queries.ListSequenceNumbers(ctx, decodedID)
+}
+
+// ReadRecordAtSeq reads the version of the record with the given id and sequence number from the storage
+func (p Postgres) ReadRecordAtSeq(ctx context.Context, id string, seq int64) (*dht.BEP44Record, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ReadRecordAtSeq")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return nil, err
+	}
+	row, err := queries.ReadRecordAtSeq(ctx, ReadRecordAtSeqParams{Key: decodedID, Seq: seq})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return dht.NewBEP44Record(row.Key, row.Value, row.Sig, row.Seq)
+}
+
+// WriteRecordExpiry sets the time at which the record with the given id is to be evicted from the Retained DID Set
+func (p Postgres) WriteRecordExpiry(ctx context.Context, id string, expiry time.Time) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.WriteRecordExpiry")
 	defer span.End()
 
 	queries, db, err := p.connect(ctx)
@@ -188,15 +341,450 @@ func (p Postgres) WriteFailedRecord(ctx context.Context, id string) error {
 	}
 	defer db.Close(ctx)
 
-	err = queries.WriteFailedRecord(ctx, WriteFailedRecordParams{
-		ID:           []byte(id),
-		FailureCount: 1,
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return queries.WriteRecordExpiry(ctx, WriteRecordExpiryParams{
+		Key:    decodedID,
+		Expiry: expiry.Unix(),
 	})
+}
+
+// ReadRecordExpiry returns the time at which the record with the given id is to be evicted from the Retained DID Set,
+// or the zero time if the record is not retained
+func (p Postgres) ReadRecordExpiry(ctx context.Context, id string) (time.Time, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ReadRecordExpiry")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expiry, err := queries.ReadRecordExpiry(ctx, decodedID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	return time.Unix(expiry, 0), nil
+}
+
+// ListExpiredRecords returns the ids of all records still scheduled to be republished with an expiry before the given
+// time
+func (p Postgres) ListExpiredRecords(ctx context.Context, before time.Time) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ListExpiredRecords")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	keys, err := queries.ListExpiredRecords(ctx, before.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, zbase32.EncodeToString(key))
+	}
+
+	return ids, nil
+}
+
+// WriteRecordTypes indexes the record with the given id under each of the given types, replacing any types previously
+// indexed for the record
+func (p Postgres) WriteRecordTypes(ctx context.Context, id string, types []int) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.WriteRecordTypes")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := queries.WithTx(tx)
+	if err = txQueries.DeleteRecordTypes(ctx, decodedID); err != nil {
+		return err
+	}
+	for _, typ := range types {
+		if err = txQueries.WriteRecordType(ctx, WriteRecordTypeParams{Type: int32(typ), Key: decodedID}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListRecordsForType returns the ids of up to limit records indexed under the given type, skipping the first offset
+func (p Postgres) ListRecordsForType(ctx context.Context, typ int, offset, limit int) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ListRecordsForType")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	keys, err := queries.ListRecordsForType(ctx, ListRecordsForTypeParams{
+		Type:   int32(typ),
+		Offset: int32(offset),
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, zbase32.EncodeToString(key))
+	}
+
+	return ids, nil
+}
+
+// WriteNextRepublish schedules the record with the given id to be republished at the given time, replacing any time
+// previously scheduled for the record
+func (p Postgres) WriteNextRepublish(ctx context.Context, id string, next time.Time) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.WriteNextRepublish")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return queries.WriteNextRepublish(ctx, WriteNextRepublishParams{
+		Key:           decodedID,
+		NextRepublish: next.Unix(),
+	})
+}
+
+// ReadNextRepublish returns the time at which the record with the given id is next to be republished, or the zero time
+// if the record is not scheduled
+func (p Postgres) ReadNextRepublish(ctx context.Context, id string) (time.Time, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ReadNextRepublish")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next, err := queries.ReadNextRepublish(ctx, decodedID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	return time.Unix(next, 0), nil
+}
+
+// DeleteNextRepublish removes the record with the given id from the republish schedule, so it is not republished until
+// it is rescheduled
+func (p Postgres) DeleteNextRepublish(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.DeleteNextRepublish")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return queries.DeleteNextRepublish(ctx, decodedID)
+}
+
+// ListDueRecords returns the ids of up to limit records scheduled to be republished before the given time, those due
+// the longest first
+func (p Postgres) ListDueRecords(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ListDueRecords")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	keys, err := queries.ListDueRecords(ctx, ListDueRecordsParams{
+		NextRepublish: before.Unix(),
+		Limit:         int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, zbase32.EncodeToString(key))
+	}
+
+	return ids, nil
+}
+
+// ListUnscheduledRecords returns the ids of up to limit records that are not scheduled to be republished, skipping
+// quarantined records and records whose expiry is before the given time
+func (p Postgres) ListUnscheduledRecords(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ListUnscheduledRecords")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	keys, err := queries.ListUnscheduledRecords(ctx, ListUnscheduledRecordsParams{
+		Expiry: now.Unix(),
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, zbase32.EncodeToString(key))
+	}
+
+	return ids, nil
+}
+
+// BlockRecord adds the record with the given id to the block list
+func (p Postgres) BlockRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.BlockRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return queries.BlockRecord(ctx, decodedID)
+}
+
+// UnblockRecord removes the record with the given id from the block list
+func (p Postgres) UnblockRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.UnblockRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return queries.UnblockRecord(ctx, decodedID)
+}
+
+// IsRecordBlocked returns whether the record with the given id is on the block list
+func (p Postgres) IsRecordBlocked(ctx context.Context, id string) (bool, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.IsRecordBlocked")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return false, err
+	}
+
+	return queries.IsRecordBlocked(ctx, decodedID)
+}
+
+// ListBlockedRecords returns the ids of the records on the block list
+func (p Postgres) ListBlockedRecords(ctx context.Context) ([]string, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ListBlockedRecords")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	keys, err := queries.ListBlockedRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, zbase32.EncodeToString(key))
+	}
+
+	return ids, nil
+}
+
+// WriteFailedRecord records a failure to republish the record with the given id, returning the number of times in a
+// row it has failed
+func (p Postgres) WriteFailedRecord(ctx context.Context, id string) (int, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.WriteFailedRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := queries.WriteFailedRecord(ctx, decodedID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+// QuarantineRecord marks the failed record with the given id as quarantined and removes it from the republish
+// schedule, so it is not republished until it is rescheduled
+func (p Postgres) QuarantineRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.QuarantineRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := queries.WithTx(tx)
+	if err = txQueries.QuarantineRecord(ctx, decodedID); err != nil {
+		return err
+	}
+	if err = txQueries.DeleteNextRepublish(ctx, decodedID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ReadFailedRecord returns the failures of the record with the given id, or nil if it has not failed to be republished
+// since it was last republished
+func (p Postgres) ReadFailedRecord(ctx context.Context, id string) (*dht.FailedRecord, error) {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.ReadFailedRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := queries.ReadFailedRecord(ctx, decodedID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &dht.FailedRecord{
+		ID:          id,
+		Count:       int(row.FailureCount),
+		Quarantined: row.Quarantined,
+	}, nil
+}
+
+// DeleteFailedRecord clears the failures, and any quarantine, of the record with the given id
+func (p Postgres) DeleteFailedRecord(ctx context.Context, id string) error {
+	ctx, span := telemetry.GetTracer().Start(ctx, "postgres.DeleteFailedRecord")
+	defer span.End()
+
+	queries, db, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	decodedID, err := zbase32.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return queries.DeleteFailedRecord(ctx, decodedID)
 }
 
 func (p Postgres) ListFailedRecords(ctx context.Context) ([]dht.FailedRecord, error) {
@@ -217,8 +805,9 @@ func (p Postgres) ListFailedRecords(ctx context.Context) ([]dht.FailedRecord, er
 	var failedRecords []dht.FailedRecord
 	for _, row := range rows {
 		failedRecords = append(failedRecords, dht.FailedRecord{
-			ID:    string(row.ID),
-			Count: int(row.FailureCount),
+			ID:          zbase32.EncodeToString(row.Key),
+			Count:       int(row.FailureCount),
+			Quarantined: row.Quarantined,
 		})
 	}
 
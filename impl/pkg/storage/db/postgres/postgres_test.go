@@ -2,15 +2,20 @@ package postgres_test
 
 import (
 	"context"
+	"crypto/ed25519"
 	"net/url"
 	"os"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/anacrolix/dht/v2/bep44"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/TBD54566975/did-dht/internal/did"
 	"github.com/TBD54566975/did-dht/pkg/dht"
+	"github.com/TBD54566975/did-dht/pkg/signer"
 	"github.com/TBD54566975/did-dht/pkg/storage"
 	"github.com/TBD54566975/did-dht/pkg/storage/db/postgres"
 )
@@ -49,7 +54,7 @@ func TestReadWrite(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, packet)
 
-	putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+	putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	require.NoError(t, err)
 	require.NotEmpty(t, putMsg)
 
@@ -94,7 +99,7 @@ func TestDBPagination(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, packet)
 
-		putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+		putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 		require.NoError(t, err)
 		require.NotEmpty(t, putMsg)
 
@@ -115,7 +120,7 @@ func TestDBPagination(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, packet)
 
-	putMsg, err := dht.CreateDNSPublishRequest(sk, *packet)
+	putMsg, err := dht.CreateDNSPublishRequest(signer.NewInMemorySigner(sk), *packet)
 	require.NoError(t, err)
 	require.NotEmpty(t, putMsg)
 
@@ -139,3 +144,357 @@ func TestDBPagination(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, beforeCnt+11, afterCnt)
 }
+
+func TestRecordExpiry(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	r := dht.NewTestRecord(t)
+	require.NoError(t, db.WriteRecord(ctx, r))
+
+	// not retained yet
+	expiry, err := db.ReadRecordExpiry(ctx, r.ID())
+	require.NoError(t, err)
+	assert.True(t, expiry.IsZero())
+
+	now := time.Now()
+	require.NoError(t, db.WriteRecordExpiry(ctx, r.ID(), now.Add(time.Hour)))
+	expiry, err = db.ReadRecordExpiry(ctx, r.ID())
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour).Unix(), expiry.Unix())
+
+	expired, err := db.ListExpiredRecords(ctx, now)
+	require.NoError(t, err)
+	assert.NotContains(t, expired, r.ID())
+
+	// only records still scheduled to be republished are listed as expired
+	expired, err = db.ListExpiredRecords(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.NotContains(t, expired, r.ID())
+	require.NoError(t, db.WriteNextRepublish(ctx, r.ID(), now))
+	expired, err = db.ListExpiredRecords(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Contains(t, expired, r.ID())
+
+	// an expired record removed from the schedule is not listed again, nor rescheduled
+	require.NoError(t, db.DeleteNextRepublish(ctx, r.ID()))
+	next, err := db.ReadNextRepublish(ctx, r.ID())
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+	expired, err = db.ListExpiredRecords(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.NotContains(t, expired, r.ID())
+	unscheduled, err := db.ListUnscheduledRecords(ctx, now.Add(2*time.Hour), 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, unscheduled, r.ID())
+	unscheduled, err = db.ListUnscheduledRecords(ctx, now, 1000)
+	require.NoError(t, err)
+	assert.Contains(t, unscheduled, r.ID())
+
+	// deleting the record removes its expiry too
+	require.NoError(t, db.DeleteRecord(ctx, r.ID()))
+	got, err := db.ReadRecord(ctx, r.ID())
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	expiry, err = db.ReadRecordExpiry(ctx, r.ID())
+	require.NoError(t, err)
+	assert.True(t, expiry.IsZero())
+}
+
+func TestRepublishSchedule(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	var records []dht.BEP44Record
+	for i := 0; i < 2; i++ {
+		r := dht.NewTestRecord(t)
+		require.NoError(t, db.WriteRecord(ctx, r))
+		records = append(records, r)
+	}
+	first, second := records[0].ID(), records[1].ID()
+
+	// not scheduled yet
+	next, err := db.ReadNextRepublish(ctx, first)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+	unscheduled, err := db.ListUnscheduledRecords(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	assert.Contains(t, unscheduled, first)
+	assert.Contains(t, unscheduled, second)
+
+	now := time.Now()
+	require.NoError(t, db.WriteNextRepublish(ctx, first, now.Add(time.Hour)))
+	require.NoError(t, db.WriteNextRepublish(ctx, second, now.Add(time.Minute)))
+	next, err = db.ReadNextRepublish(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour).Unix(), next.Unix())
+	unscheduled, err = db.ListUnscheduledRecords(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, unscheduled, first)
+	assert.NotContains(t, unscheduled, second)
+
+	due, err := db.ListDueRecords(ctx, now, 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, due, first)
+	assert.NotContains(t, due, second)
+
+	// records are listed in the order they are due
+	due, err = db.ListDueRecords(ctx, now.Add(2*time.Hour), 1000)
+	require.NoError(t, err)
+	require.Contains(t, due, second)
+	assert.Less(t, slices.Index(due, second), slices.Index(due, first))
+
+	// rescheduling replaces the previous time
+	require.NoError(t, db.WriteNextRepublish(ctx, second, now.Add(3*time.Hour)))
+	due, err = db.ListDueRecords(ctx, now.Add(2*time.Hour), 1000)
+	require.NoError(t, err)
+	assert.Contains(t, due, first)
+	assert.NotContains(t, due, second)
+
+	// deleting the record removes its schedule too
+	require.NoError(t, db.DeleteRecord(ctx, first))
+	next, err = db.ReadNextRepublish(ctx, first)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+	due, err = db.ListDueRecords(ctx, now.Add(2*time.Hour), 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, due, first)
+}
+
+func TestFailedRecords(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	record := dht.NewTestRecord(t)
+	require.NoError(t, db.WriteRecord(ctx, record))
+	id := record.ID()
+	require.NoError(t, db.WriteNextRepublish(ctx, id, time.Now()))
+	got, err := db.ReadFailedRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// failures are counted in a row
+	for i := 1; i <= 3; i++ {
+		count, err := db.WriteFailedRecord(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, i, count)
+	}
+	failed, err := db.ListFailedRecords(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, failed, dht.FailedRecord{ID: id, Count: 3})
+	got, err = db.ReadFailedRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, &dht.FailedRecord{ID: id, Count: 3}, got)
+
+	// a quarantined record is unscheduled, and stays unscheduled
+	require.NoError(t, db.QuarantineRecord(ctx, id))
+	failed, err = db.ListFailedRecords(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, failed, dht.FailedRecord{ID: id, Count: 3, Quarantined: true})
+	got, err = db.ReadFailedRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, &dht.FailedRecord{ID: id, Count: 3, Quarantined: true}, got)
+	next, err := db.ReadNextRepublish(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+	unscheduled, err := db.ListUnscheduledRecords(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, unscheduled, id)
+
+	// clearing the failures lifts the quarantine
+	require.NoError(t, db.DeleteFailedRecord(ctx, id))
+	require.NoError(t, db.DeleteFailedRecord(ctx, id))
+	failed, err = db.ListFailedRecords(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, failed, dht.FailedRecord{ID: id, Count: 3, Quarantined: true})
+	got, err = db.ReadFailedRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	unscheduled, err = db.ListUnscheduledRecords(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	assert.Contains(t, unscheduled, id)
+	count, err := db.WriteFailedRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// deleting the record removes its failures too
+	require.NoError(t, db.DeleteRecord(ctx, id))
+	failed, err = db.ListFailedRecords(ctx)
+	require.NoError(t, err)
+	for _, f := range failed {
+		assert.NotEqual(t, id, f.ID)
+	}
+}
+
+func TestBlockedRecords(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+	require.NoError(t, err)
+	packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+	require.NoError(t, err)
+	v, err := packet.Pack()
+	require.NoError(t, err)
+	put := bep44.Put{V: v, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: 100}
+	put.Sign(sk)
+	record := dht.RecordFromBEP44(&put)
+	id := record.ID()
+
+	blocked, err := db.IsRecordBlocked(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	// blocking is idempotent
+	require.NoError(t, db.BlockRecord(ctx, id))
+	require.NoError(t, db.BlockRecord(ctx, id))
+	blocked, err = db.IsRecordBlocked(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, blocked)
+	ids, err := db.ListBlockedRecords(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, ids, id)
+
+	// a blocked record is not written
+	assert.ErrorIs(t, db.WriteRecord(ctx, record), dht.ErrRecordBlocked)
+	stored, err := db.ReadRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	require.NoError(t, db.UnblockRecord(ctx, id))
+	blocked, err = db.IsRecordBlocked(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+	ids, err = db.ListBlockedRecords(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, ids, id)
+	assert.NoError(t, db.WriteRecord(ctx, record))
+}
+
+func TestRecordHistory(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	sk, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+	require.NoError(t, err)
+	packet, err := did.DHT(doc.ID).ToDNSPacket(*doc, nil, nil, nil)
+	require.NoError(t, err)
+	v, err := packet.Pack()
+	require.NoError(t, err)
+
+	// write three versions of the same record
+	var records []dht.BEP44Record
+	for _, seq := range []int64{100, 200, 300} {
+		put := bep44.Put{V: v, K: (*[32]byte)(sk.Public().(ed25519.PublicKey)), Seq: seq}
+		put.Sign(sk)
+		record := dht.RecordFromBEP44(&put)
+		require.NoError(t, db.WriteRecord(ctx, record))
+		records = append(records, record)
+	}
+	id := records[0].ID()
+
+	seqs, err := db.ListSequenceNumbers(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{100, 200, 300}, seqs)
+
+	// writing the same version again does not duplicate it
+	require.NoError(t, db.WriteRecord(ctx, records[2]))
+	seqs, err = db.ListSequenceNumbers(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{100, 200, 300}, seqs)
+
+	got, err := db.ReadRecordAtSeq(ctx, id, 100)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, records[0].Signature, got.Signature)
+	assert.Equal(t, int64(100), got.SequenceNumber)
+
+	got, err = db.ReadRecordAtSeq(ctx, id, 150)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// deleting the record removes its history
+	require.NoError(t, db.DeleteRecord(ctx, id))
+	seqs, err = db.ListSequenceNumbers(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, seqs)
+}
+
+func TestConflictResolution(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	pk, sk, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	newRecord := func(v string, seq int64) dht.BEP44Record {
+		put := bep44.Put{V: []byte(v), K: (*[32]byte)(pk), Seq: seq}
+		put.Sign(sk)
+		return dht.RecordFromBEP44(&put)
+	}
+
+	stored := newRecord("b", 100)
+	require.NoError(t, db.WriteRecord(ctx, stored))
+	got, err := db.ReadRecord(ctx, stored.ID())
+	require.NoError(t, err)
+	assert.False(t, got.Updated.IsZero())
+
+	// a lower sequence number is rejected
+	assert.ErrorIs(t, db.WriteRecord(ctx, newRecord("c", 99)), dht.ErrStaleSequenceNumber)
+
+	// the same record is accepted again
+	assert.NoError(t, db.WriteRecord(ctx, stored))
+
+	// a lexicographically lower payload with the same sequence number is rejected
+	assert.ErrorIs(t, db.WriteRecord(ctx, newRecord("a", 100)), dht.ErrLowerPayload)
+	got, err = db.ReadRecord(ctx, stored.ID())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("b"), got.Value)
+
+	// a lexicographically higher payload with the same sequence number replaces the stored record
+	require.NoError(t, db.WriteRecord(ctx, newRecord("c", 100)))
+	got, err = db.ReadRecord(ctx, stored.ID())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c"), got.Value)
+	got, err = db.ReadRecordAtSeq(ctx, stored.ID(), 100)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c"), got.Value)
+}
+
+func TestRecordTypes(t *testing.T) {
+	db := getTestDB(t)
+	ctx := context.Background()
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		_, doc, err := did.GenerateDIDDHT(did.CreateDIDDHTOpts{})
+		require.NoError(t, err)
+		suffix, err := did.DHT(doc.ID).Suffix()
+		require.NoError(t, err)
+		require.NoError(t, db.WriteRecordTypes(ctx, suffix, []int{1, 7}))
+		ids = append(ids, suffix)
+	}
+
+	got, err := db.ListRecordsForType(ctx, 7, 0, 1000)
+	require.NoError(t, err)
+	assert.Contains(t, got, ids[0])
+	assert.Contains(t, got, ids[1])
+
+	got, err = db.ListRecordsForType(ctx, 7, 0, 1)
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	// rewriting a record's types removes its stale entries
+	require.NoError(t, db.WriteRecordTypes(ctx, ids[0], []int{1}))
+	got, err = db.ListRecordsForType(ctx, 7, 0, 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, got, ids[0])
+	got, err = db.ListRecordsForType(ctx, 1, 0, 1000)
+	require.NoError(t, err)
+	assert.Contains(t, got, ids[0])
+
+	// as does deleting the record
+	require.NoError(t, db.DeleteRecord(ctx, ids[1]))
+	got, err = db.ListRecordsForType(ctx, 1, 0, 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, got, ids[1])
+}
@@ -9,6 +9,70 @@ import (
 	"context"
 )
 
+const blockRecord = `-- name: BlockRecord :exec
+INSERT INTO blocked_records(key) VALUES($1)
+ON CONFLICT (key) DO NOTHING
+`
+
+func (q *Queries) BlockRecord(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, blockRecord, key)
+	return err
+}
+
+const deleteFailedRecord = `-- name: DeleteFailedRecord :exec
+DELETE FROM failed_records WHERE key = $1
+`
+
+func (q *Queries) DeleteFailedRecord(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, deleteFailedRecord, key)
+	return err
+}
+
+const deleteNextRepublish = `-- name: DeleteNextRepublish :exec
+DELETE FROM republish_schedule WHERE key = $1
+`
+
+func (q *Queries) DeleteNextRepublish(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, deleteNextRepublish, key)
+	return err
+}
+
+const deleteRecord = `-- name: DeleteRecord :exec
+DELETE FROM dht_records WHERE key = $1
+`
+
+func (q *Queries) DeleteRecord(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, deleteRecord, key)
+	return err
+}
+
+const deleteRecordExpiry = `-- name: DeleteRecordExpiry :exec
+DELETE FROM retained_records WHERE key = $1
+`
+
+func (q *Queries) DeleteRecordExpiry(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, deleteRecordExpiry, key)
+	return err
+}
+
+const deleteRecordHistory = `-- name: DeleteRecordHistory :exec
+DELETE FROM dht_record_history WHERE key = $1
+`
+
+func (q *Queries) DeleteRecordHistory(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, deleteRecordHistory, key)
+	return err
+}
+
+const deleteRecordTypes = `-- name: DeleteRecordTypes :exec
+DELETE FROM record_types WHERE key = $1
+`
+
+func (q *Queries) DeleteRecordTypes(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, deleteRecordTypes, key)
+	return err
+}
+
 const failedRecordCount = `-- name: FailedRecordCount :one
 SELECT count(*) AS exact_count FROM failed_records
 `
@@ -20,8 +84,98 @@ func (q *Queries) FailedRecordCount(ctx context.Context) (int64, error) {
 	return exact_count, err
 }
 
+const isRecordBlocked = `-- name: IsRecordBlocked :one
+SELECT EXISTS(SELECT 1 FROM blocked_records WHERE key = $1)
+`
+
+func (q *Queries) IsRecordBlocked(ctx context.Context, key []byte) (bool, error) {
+	row := q.db.QueryRow(ctx, isRecordBlocked, key)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listBlockedRecords = `-- name: ListBlockedRecords :many
+SELECT key FROM blocked_records ORDER BY key ASC
+`
+
+func (q *Queries) ListBlockedRecords(ctx context.Context) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, listBlockedRecords)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDueRecords = `-- name: ListDueRecords :many
+SELECT key FROM republish_schedule WHERE next_republish < $1 ORDER BY next_republish ASC LIMIT $2
+`
+
+type ListDueRecordsParams struct {
+	NextRepublish int64
+	Limit         int32
+}
+
+func (q *Queries) ListDueRecords(ctx context.Context, arg ListDueRecordsParams) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, listDueRecords, arg.NextRepublish, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExpiredRecords = `-- name: ListExpiredRecords :many
+SELECT retained_records.key FROM retained_records
+JOIN republish_schedule ON republish_schedule.key = retained_records.key
+WHERE retained_records.expiry < $1
+`
+
+func (q *Queries) ListExpiredRecords(ctx context.Context, expiry int64) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, listExpiredRecords, expiry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listFailedRecords = `-- name: ListFailedRecords :many
-SELECT id, failure_count FROM failed_records
+SELECT key, failure_count, quarantined FROM failed_records
 `
 
 func (q *Queries) ListFailedRecords(ctx context.Context) ([]FailedRecord, error) {
@@ -33,7 +187,7 @@ func (q *Queries) ListFailedRecords(ctx context.Context) ([]FailedRecord, error)
 	var items []FailedRecord
 	for rows.Next() {
 		var i FailedRecord
-		if err := rows.Scan(&i.ID, &i.FailureCount); err != nil {
+		if err := rows.Scan(&i.Key, &i.FailureCount, &i.Quarantined); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -45,7 +199,7 @@ func (q *Queries) ListFailedRecords(ctx context.Context) ([]FailedRecord, error)
 }
 
 const listRecords = `-- name: ListRecords :many
-SELECT id, key, value, sig, seq FROM dht_records WHERE id > (SELECT id FROM dht_records WHERE dht_records.key = $1) ORDER BY id ASC LIMIT $2
+SELECT id, key, value, sig, seq, updated FROM dht_records WHERE id > (SELECT id FROM dht_records WHERE dht_records.key = $1) ORDER BY id ASC LIMIT $2
 `
 
 type ListRecordsParams struct {
@@ -68,6 +222,7 @@ func (q *Queries) ListRecords(ctx context.Context, arg ListRecordsParams) ([]Dht
 			&i.Value,
 			&i.Sig,
 			&i.Seq,
+			&i.Updated,
 		); err != nil {
 			return nil, err
 		}
@@ -80,7 +235,7 @@ func (q *Queries) ListRecords(ctx context.Context, arg ListRecordsParams) ([]Dht
 }
 
 const listRecordsFirstPage = `-- name: ListRecordsFirstPage :many
-SELECT id, key, value, sig, seq FROM dht_records ORDER BY id ASC LIMIT $1
+SELECT id, key, value, sig, seq, updated FROM dht_records ORDER BY id ASC LIMIT $1
 `
 
 func (q *Queries) ListRecordsFirstPage(ctx context.Context, limit int32) ([]DhtRecord, error) {
@@ -98,6 +253,7 @@ func (q *Queries) ListRecordsFirstPage(ctx context.Context, limit int32) ([]DhtR
 			&i.Value,
 			&i.Sig,
 			&i.Seq,
+			&i.Updated,
 		); err != nil {
 			return nil, err
 		}
@@ -109,8 +265,136 @@ func (q *Queries) ListRecordsFirstPage(ctx context.Context, limit int32) ([]DhtR
 	return items, nil
 }
 
+const listRecordsForType = `-- name: ListRecordsForType :many
+SELECT key FROM record_types WHERE type = $1 ORDER BY key ASC OFFSET $2 LIMIT $3
+`
+
+type ListRecordsForTypeParams struct {
+	Type   int32
+	Offset int32
+	Limit  int32
+}
+
+func (q *Queries) ListRecordsForType(ctx context.Context, arg ListRecordsForTypeParams) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, listRecordsForType, arg.Type, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSequenceNumbers = `-- name: ListSequenceNumbers :many
+SELECT seq FROM dht_record_history WHERE key = $1 ORDER BY seq ASC
+`
+
+func (q *Queries) ListSequenceNumbers(ctx context.Context, key []byte) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listSequenceNumbers, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var seq int64
+		if err := rows.Scan(&seq); err != nil {
+			return nil, err
+		}
+		items = append(items, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnscheduledRecords = `-- name: ListUnscheduledRecords :many
+SELECT dht_records.key FROM dht_records
+LEFT JOIN republish_schedule ON republish_schedule.key = dht_records.key
+LEFT JOIN failed_records ON failed_records.key = dht_records.key AND failed_records.quarantined
+LEFT JOIN retained_records ON retained_records.key = dht_records.key AND retained_records.expiry < $1
+WHERE republish_schedule.key IS NULL AND failed_records.key IS NULL AND retained_records.key IS NULL
+ORDER BY dht_records.id ASC LIMIT $2
+`
+
+type ListUnscheduledRecordsParams struct {
+	Expiry int64
+	Limit  int32
+}
+
+func (q *Queries) ListUnscheduledRecords(ctx context.Context, arg ListUnscheduledRecordsParams) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, listUnscheduledRecords, arg.Expiry, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockBlockedRecords = `-- name: LockBlockedRecords :exec
+LOCK TABLE blocked_records IN SHARE MODE
+`
+
+func (q *Queries) LockBlockedRecords(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockBlockedRecords)
+	return err
+}
+
+const quarantineRecord = `-- name: QuarantineRecord :exec
+UPDATE failed_records SET quarantined = true WHERE key = $1
+`
+
+func (q *Queries) QuarantineRecord(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, quarantineRecord, key)
+	return err
+}
+
+const readFailedRecord = `-- name: ReadFailedRecord :one
+SELECT key, failure_count, quarantined FROM failed_records WHERE key = $1 LIMIT 1
+`
+
+func (q *Queries) ReadFailedRecord(ctx context.Context, key []byte) (FailedRecord, error) {
+	row := q.db.QueryRow(ctx, readFailedRecord, key)
+	var i FailedRecord
+	err := row.Scan(&i.Key, &i.FailureCount, &i.Quarantined)
+	return i, err
+}
+
+const readNextRepublish = `-- name: ReadNextRepublish :one
+SELECT next_republish FROM republish_schedule WHERE key = $1 LIMIT 1
+`
+
+func (q *Queries) ReadNextRepublish(ctx context.Context, key []byte) (int64, error) {
+	row := q.db.QueryRow(ctx, readNextRepublish, key)
+	var next_republish int64
+	err := row.Scan(&next_republish)
+	return next_republish, err
+}
+
 const readRecord = `-- name: ReadRecord :one
-SELECT id, key, value, sig, seq FROM dht_records WHERE key = $1 LIMIT 1
+SELECT id, key, value, sig, seq, updated FROM dht_records WHERE key = $1 LIMIT 1
 `
 
 func (q *Queries) ReadRecord(ctx context.Context, key []byte) (DhtRecord, error) {
@@ -122,10 +406,43 @@ func (q *Queries) ReadRecord(ctx context.Context, key []byte) (DhtRecord, error)
 		&i.Value,
 		&i.Sig,
 		&i.Seq,
+		&i.Updated,
 	)
 	return i, err
 }
 
+const readRecordAtSeq = `-- name: ReadRecordAtSeq :one
+SELECT key, seq, value, sig FROM dht_record_history WHERE key = $1 AND seq = $2 LIMIT 1
+`
+
+type ReadRecordAtSeqParams struct {
+	Key []byte
+	Seq int64
+}
+
+func (q *Queries) ReadRecordAtSeq(ctx context.Context, arg ReadRecordAtSeqParams) (DhtRecordHistory, error) {
+	row := q.db.QueryRow(ctx, readRecordAtSeq, arg.Key, arg.Seq)
+	var i DhtRecordHistory
+	err := row.Scan(
+		&i.Key,
+		&i.Seq,
+		&i.Value,
+		&i.Sig,
+	)
+	return i, err
+}
+
+const readRecordExpiry = `-- name: ReadRecordExpiry :one
+SELECT expiry FROM retained_records WHERE key = $1 LIMIT 1
+`
+
+func (q *Queries) ReadRecordExpiry(ctx context.Context, key []byte) (int64, error) {
+	row := q.db.QueryRow(ctx, readRecordExpiry, key)
+	var expiry int64
+	err := row.Scan(&expiry)
+	return expiry, err
+}
+
 const recordCount = `-- name: RecordCount :one
 SELECT count(*) AS exact_count FROM dht_records
 `
@@ -137,39 +454,121 @@ func (q *Queries) RecordCount(ctx context.Context) (int64, error) {
 	return exact_count, err
 }
 
-const writeFailedRecord = `-- name: WriteFailedRecord :exec
-INSERT INTO failed_records(id, failure_count)
-VALUES($1, $2)
-ON CONFLICT (id) DO UPDATE SET failure_count = failed_records.failure_count + 1
+const unblockRecord = `-- name: UnblockRecord :exec
+DELETE FROM blocked_records WHERE key = $1
 `
 
-type WriteFailedRecordParams struct {
-	ID           []byte
-	FailureCount int32
+func (q *Queries) UnblockRecord(ctx context.Context, key []byte) error {
+	_, err := q.db.Exec(ctx, unblockRecord, key)
+	return err
 }
 
-func (q *Queries) WriteFailedRecord(ctx context.Context, arg WriteFailedRecordParams) error {
-	_, err := q.db.Exec(ctx, writeFailedRecord, arg.ID, arg.FailureCount)
+const writeFailedRecord = `-- name: WriteFailedRecord :one
+INSERT INTO failed_records(key, failure_count)
+VALUES($1, 1)
+ON CONFLICT (key) DO UPDATE SET failure_count = failed_records.failure_count + 1
+RETURNING failure_count
+`
+
+func (q *Queries) WriteFailedRecord(ctx context.Context, key []byte) (int32, error) {
+	row := q.db.QueryRow(ctx, writeFailedRecord, key)
+	var failure_count int32
+	err := row.Scan(&failure_count)
+	return failure_count, err
+}
+
+const writeNextRepublish = `-- name: WriteNextRepublish :exec
+INSERT INTO republish_schedule(key, next_republish) VALUES($1, $2)
+ON CONFLICT (key) DO UPDATE SET next_republish = excluded.next_republish
+`
+
+type WriteNextRepublishParams struct {
+	Key           []byte
+	NextRepublish int64
+}
+
+func (q *Queries) WriteNextRepublish(ctx context.Context, arg WriteNextRepublishParams) error {
+	_, err := q.db.Exec(ctx, writeNextRepublish, arg.Key, arg.NextRepublish)
 	return err
 }
 
-const writeRecord = `-- name: WriteRecord :exec
-INSERT INTO dht_records(key, value, sig, seq) VALUES($1, $2, $3, $4)
+const writeRecord = `-- name: WriteRecord :execrows
+INSERT INTO dht_records(key, value, sig, seq, updated) VALUES($1, $2, $3, $4, $5)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, sig = excluded.sig, seq = excluded.seq, updated = excluded.updated
+WHERE dht_records.seq < excluded.seq OR (dht_records.seq = excluded.seq AND dht_records.value <= excluded.value)
 `
 
 type WriteRecordParams struct {
+	Key     []byte
+	Value   []byte
+	Sig     []byte
+	Seq     int64
+	Updated int64
+}
+
+func (q *Queries) WriteRecord(ctx context.Context, arg WriteRecordParams) (int64, error) {
+	result, err := q.db.Exec(ctx, writeRecord,
+		arg.Key,
+		arg.Value,
+		arg.Sig,
+		arg.Seq,
+		arg.Updated,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const writeRecordExpiry = `-- name: WriteRecordExpiry :exec
+INSERT INTO retained_records(key, expiry)
+VALUES($1, $2)
+ON CONFLICT (key) DO UPDATE SET expiry = excluded.expiry
+`
+
+type WriteRecordExpiryParams struct {
+	Key    []byte
+	Expiry int64
+}
+
+func (q *Queries) WriteRecordExpiry(ctx context.Context, arg WriteRecordExpiryParams) error {
+	_, err := q.db.Exec(ctx, writeRecordExpiry, arg.Key, arg.Expiry)
+	return err
+}
+
+const writeRecordHistory = `-- name: WriteRecordHistory :exec
+INSERT INTO dht_record_history(key, seq, value, sig) VALUES($1, $2, $3, $4)
+ON CONFLICT (key, seq) DO UPDATE SET value = excluded.value, sig = excluded.sig
+`
+
+type WriteRecordHistoryParams struct {
 	Key   []byte
+	Seq   int64
 	Value []byte
 	Sig   []byte
-	Seq   int64
 }
 
-func (q *Queries) WriteRecord(ctx context.Context, arg WriteRecordParams) error {
-	_, err := q.db.Exec(ctx, writeRecord,
+func (q *Queries) WriteRecordHistory(ctx context.Context, arg WriteRecordHistoryParams) error {
+	_, err := q.db.Exec(ctx, writeRecordHistory,
 		arg.Key,
+		arg.Seq,
 		arg.Value,
 		arg.Sig,
-		arg.Seq,
 	)
 	return err
 }
+
+const writeRecordType = `-- name: WriteRecordType :exec
+INSERT INTO record_types(type, key) VALUES($1, $2)
+ON CONFLICT (type, key) DO NOTHING
+`
+
+type WriteRecordTypeParams struct {
+	Type int32
+	Key  []byte
+}
+
+func (q *Queries) WriteRecordType(ctx context.Context, arg WriteRecordTypeParams) error {
+	_, err := q.db.Exec(ctx, writeRecordType, arg.Type, arg.Key)
+	return err
+}
@@ -1,5 +1,17 @@
--- name: WriteRecord :exec
-INSERT INTO dht_records(key, value, sig, seq) VALUES($1, $2, $3, $4);
+-- name: WriteRecord :execrows
+INSERT INTO dht_records(key, value, sig, seq, updated) VALUES($1, $2, $3, $4, $5)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, sig = excluded.sig, seq = excluded.seq, updated = excluded.updated
+WHERE dht_records.seq < excluded.seq OR (dht_records.seq = excluded.seq AND dht_records.value <= excluded.value);
+
+-- name: WriteRecordHistory :exec
+INSERT INTO dht_record_history(key, seq, value, sig) VALUES($1, $2, $3, $4)
+ON CONFLICT (key, seq) DO UPDATE SET value = excluded.value, sig = excluded.sig;
+
+-- name: ListSequenceNumbers :many
+SELECT seq FROM dht_record_history WHERE key = $1 ORDER BY seq ASC;
+
+-- name: ReadRecordAtSeq :one
+SELECT key, seq, value, sig FROM dht_record_history WHERE key = $1 AND seq = $2 LIMIT 1;
 
 -- name: ReadRecord :one
 SELECT * FROM dht_records WHERE key = $1 LIMIT 1;
@@ -13,13 +25,92 @@ SELECT * FROM dht_records ORDER BY id ASC LIMIT $1;
 -- name: RecordCount :one
 SELECT count(*) AS exact_count FROM dht_records;
 
--- name: WriteFailedRecord :exec
-INSERT INTO failed_records(id, failure_count)
-VALUES($1, $2)
-ON CONFLICT (id) DO UPDATE SET failure_count = failed_records.failure_count + 1;
+-- name: WriteFailedRecord :one
+INSERT INTO failed_records(key, failure_count)
+VALUES($1, 1)
+ON CONFLICT (key) DO UPDATE SET failure_count = failed_records.failure_count + 1
+RETURNING failure_count;
+
+-- name: QuarantineRecord :exec
+UPDATE failed_records SET quarantined = true WHERE key = $1;
+
+-- name: ReadFailedRecord :one
+SELECT * FROM failed_records WHERE key = $1 LIMIT 1;
+
+-- name: DeleteFailedRecord :exec
+DELETE FROM failed_records WHERE key = $1;
 
 -- name: ListFailedRecords :many
 SELECT * FROM failed_records;
 
 -- name: FailedRecordCount :one
-SELECT count(*) AS exact_count FROM failed_records;
\ No newline at end of file
+SELECT count(*) AS exact_count FROM failed_records;
+
+-- name: DeleteRecord :exec
+DELETE FROM dht_records WHERE key = $1;
+
+-- name: WriteRecordExpiry :exec
+INSERT INTO retained_records(key, expiry)
+VALUES($1, $2)
+ON CONFLICT (key) DO UPDATE SET expiry = excluded.expiry;
+
+-- name: ReadRecordExpiry :one
+SELECT expiry FROM retained_records WHERE key = $1 LIMIT 1;
+
+-- name: ListExpiredRecords :many
+SELECT retained_records.key FROM retained_records
+JOIN republish_schedule ON republish_schedule.key = retained_records.key
+WHERE retained_records.expiry < $1;
+
+-- name: DeleteRecordExpiry :exec
+DELETE FROM retained_records WHERE key = $1;
+
+-- name: DeleteRecordHistory :exec
+DELETE FROM dht_record_history WHERE key = $1;
+
+-- name: WriteRecordType :exec
+INSERT INTO record_types(type, key) VALUES($1, $2)
+ON CONFLICT (type, key) DO NOTHING;
+
+-- name: ListRecordsForType :many
+SELECT key FROM record_types WHERE type = $1 ORDER BY key ASC OFFSET $2 LIMIT $3;
+
+-- name: DeleteRecordTypes :exec
+DELETE FROM record_types WHERE key = $1;
+
+-- name: WriteNextRepublish :exec
+INSERT INTO republish_schedule(key, next_republish) VALUES($1, $2)
+ON CONFLICT (key) DO UPDATE SET next_republish = excluded.next_republish;
+
+-- name: ReadNextRepublish :one
+SELECT next_republish FROM republish_schedule WHERE key = $1 LIMIT 1;
+
+-- name: ListDueRecords :many
+SELECT key FROM republish_schedule WHERE next_republish < $1 ORDER BY next_republish ASC LIMIT $2;
+
+-- name: ListUnscheduledRecords :many
+SELECT dht_records.key FROM dht_records
+LEFT JOIN republish_schedule ON republish_schedule.key = dht_records.key
+LEFT JOIN failed_records ON failed_records.key = dht_records.key AND failed_records.quarantined
+LEFT JOIN retained_records ON retained_records.key = dht_records.key AND retained_records.expiry < $1
+WHERE republish_schedule.key IS NULL AND failed_records.key IS NULL AND retained_records.key IS NULL
+ORDER BY dht_records.id ASC LIMIT $2;
+
+-- name: DeleteNextRepublish :exec
+DELETE FROM republish_schedule WHERE key = $1;
+
+-- name: BlockRecord :exec
+INSERT INTO blocked_records(key) VALUES($1)
+ON CONFLICT (key) DO NOTHING;
+
+-- name: UnblockRecord :exec
+DELETE FROM blocked_records WHERE key = $1;
+
+-- name: LockBlockedRecords :exec
+LOCK TABLE blocked_records IN SHARE MODE;
+
+-- name: IsRecordBlocked :one
+SELECT EXISTS(SELECT 1 FROM blocked_records WHERE key = $1);
+
+-- name: ListBlockedRecords :many
+SELECT key FROM blocked_records ORDER BY key ASC;
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -18,8 +19,33 @@ type Storage interface {
 	ReadRecord(ctx context.Context, id string) (*dht.BEP44Record, error)
 	ListRecords(ctx context.Context, nextPageToken []byte, pageSize int) (records []dht.BEP44Record, nextPage []byte, err error)
 	RecordCount(ctx context.Context) (int, error)
+	DeleteRecord(ctx context.Context, id string) error
 
-	WriteFailedRecord(ctx context.Context, id string) error
+	ListSequenceNumbers(ctx context.Context, id string) ([]int64, error)
+	ReadRecordAtSeq(ctx context.Context, id string, seq int64) (*dht.BEP44Record, error)
+
+	WriteRecordExpiry(ctx context.Context, id string, expiry time.Time) error
+	ReadRecordExpiry(ctx context.Context, id string) (time.Time, error)
+	ListExpiredRecords(ctx context.Context, before time.Time) ([]string, error)
+
+	WriteNextRepublish(ctx context.Context, id string, next time.Time) error
+	ReadNextRepublish(ctx context.Context, id string) (time.Time, error)
+	DeleteNextRepublish(ctx context.Context, id string) error
+	ListDueRecords(ctx context.Context, before time.Time, limit int) ([]string, error)
+	ListUnscheduledRecords(ctx context.Context, now time.Time, limit int) ([]string, error)
+
+	WriteRecordTypes(ctx context.Context, id string, types []int) error
+	ListRecordsForType(ctx context.Context, typ int, offset, limit int) ([]string, error)
+
+	BlockRecord(ctx context.Context, id string) error
+	UnblockRecord(ctx context.Context, id string) error
+	IsRecordBlocked(ctx context.Context, id string) (bool, error)
+	ListBlockedRecords(ctx context.Context) ([]string, error)
+
+	WriteFailedRecord(ctx context.Context, id string) (int, error)
+	QuarantineRecord(ctx context.Context, id string) error
+	ReadFailedRecord(ctx context.Context, id string) (*dht.FailedRecord, error)
+	DeleteFailedRecord(ctx context.Context, id string) error
 	ListFailedRecords(ctx context.Context) ([]dht.FailedRecord, error)
 	FailedRecordCount(ctx context.Context) (int, error)
 
@@ -9,6 +9,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -25,6 +26,7 @@ const (
 
 var (
 	tracer        trace.Tracer
+	meter         metric.Meter
 	traceProvider *sdktrace.TracerProvider
 	meterProvider *sdkmetric.MeterProvider
 	propagator    propagation.TextMapPropagator
@@ -91,3 +93,11 @@ func GetTracer() trace.Tracer {
 	}
 	return tracer
 }
+
+// GetMeter returns the meter for the application. If the meter is not yet initialized, it will be created.
+func GetMeter() metric.Meter {
+	if meter == nil {
+		meter = otel.GetMeterProvider().Meter(scopeName, metric.WithInstrumentationVersion(config.Version))
+	}
+	return meter
+}